@@ -0,0 +1,110 @@
+package onkyoctl
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+const albumArtGroup ISCPGroup = "NJA"
+
+// NJA parameters start with two characters, image type and packet flag:
+//
+//	0 BMP     0 start
+//	1 JPEG    1 next
+//	2 URL     2 end
+//	n none    - single packet
+//
+// followed by the hex encoded image data.
+const (
+	artTypeBMP  = '0'
+	artTypeJPEG = '1'
+	artTypeURL  = '2'
+	artTypeNone = 'n'
+
+	artStart  = '0'
+	artNext   = '1'
+	artEnd    = '2'
+	artSingle = '-'
+)
+
+// AlbumArtCallback receives a complete album art image
+// together with its MIME type.
+type AlbumArtCallback func(image []byte, mime string)
+
+// artAssembler collects album art chunks until the image is complete.
+type artAssembler struct {
+	buf    bytes.Buffer
+	mime   string
+	active bool
+}
+
+// add adds a chunk from an NJA message.
+// It returns the image and its MIME type once the last chunk is added.
+func (a *artAssembler) add(param string) ([]byte, string, error) {
+	if len(param) < 2 {
+		return nil, "", fmt.Errorf("%w %q", ErrInvalidParam, param)
+	}
+
+	var mime string
+	switch param[0] {
+	case artTypeBMP:
+		mime = "image/bmp"
+	case artTypeJPEG:
+		mime = "image/jpeg"
+	case artTypeURL, artTypeNone:
+		a.reset()
+		return nil, "", nil
+	default:
+		return nil, "", fmt.Errorf("unknown image type %q", param[0])
+	}
+
+	data, err := hex.DecodeString(param[2:])
+	if err != nil {
+		a.reset()
+		return nil, "", fmt.Errorf("invalid image data: %v", err)
+	}
+
+	switch param[1] {
+	case artSingle:
+		a.reset()
+		return data, mime, nil
+	case artStart:
+		a.reset()
+		a.active = true
+		a.mime = mime
+		a.buf.Write(data)
+	case artNext, artEnd:
+		if !a.active {
+			return nil, "", fmt.Errorf("missing start of image")
+		}
+		if mime != a.mime {
+			a.reset()
+			return nil, "", fmt.Errorf("image type changed")
+		}
+		a.buf.Write(data)
+	default:
+		a.reset()
+		return nil, "", fmt.Errorf("unknown packet flag %q", param[1])
+	}
+
+	if param[1] != artEnd {
+		return nil, "", nil
+	}
+
+	image := make([]byte, a.buf.Len())
+	copy(image, a.buf.Bytes())
+	a.reset()
+	return image, mime, nil
+}
+
+func (a *artAssembler) reset() {
+	a.buf.Reset()
+	a.mime = ""
+	a.active = false
+}
+
+// isArtImage tells whether an NJA parameter contains image data.
+func isArtImage(param string) bool {
+	return len(param) > 0 && (param[0] == artTypeBMP || param[0] == artTypeJPEG)
+}
@@ -0,0 +1,41 @@
+package onkyoctl
+
+import (
+	"testing"
+)
+
+func TestAlbumArtAssembly(t *testing.T) {
+	a := &artAssembler{}
+
+	image, _, err := a.add("10FFD8")
+	assertNoErr(t, err)
+	assertEqual(t, len(image), 0)
+
+	image, _, err = a.add("11FFE0")
+	assertNoErr(t, err)
+	assertEqual(t, len(image), 0)
+
+	image, mime, err := a.add("12FFD9")
+	assertNoErr(t, err)
+	assertEqual(t, image, []byte{0xFF, 0xD8, 0xFF, 0xE0, 0xFF, 0xD9})
+	assertEqual(t, mime, "image/jpeg")
+
+	// single packet
+	image, mime, err = a.add("0-424D")
+	assertNoErr(t, err)
+	assertEqual(t, image, []byte("BM"))
+	assertEqual(t, mime, "image/bmp")
+
+	// URL and no image are ignored
+	image, _, err = a.add("2-http://example.com/art.jpg")
+	assertNoErr(t, err)
+	assertEqual(t, len(image), 0)
+
+	// chunk without start
+	_, _, err = a.add("11FFE0")
+	assertErr(t, err)
+
+	// broken data
+	_, _, err = a.add("10XX")
+	assertErr(t, err)
+}
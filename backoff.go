@@ -0,0 +1,57 @@
+package onkyoctl
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// backoff calculates exponentially growing delays for reconnect attempts.
+//
+// The delay doubles with every attempt until it reaches the maximum.
+// A random jitter of up to half the delay is subtracted so that several
+// clients do not reconnect at the same time.
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+	attempt int
+	lock    sync.Mutex
+}
+
+func newBackoff(initial, max time.Duration) *backoff {
+	if max < initial {
+		max = initial
+	}
+	return &backoff{
+		initial: initial,
+		max:     max,
+	}
+}
+
+// next returns the delay for the next attempt.
+func (b *backoff) next() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	delay := b.initial
+	for i := 0; i < b.attempt && delay < b.max; i++ {
+		delay *= 2
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+	b.attempt++
+
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return delay - time.Duration(rand.Int63n(half+1))
+}
+
+// reset starts over with the initial delay.
+func (b *backoff) reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.attempt = 0
+}
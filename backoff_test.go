@@ -0,0 +1,33 @@
+package onkyoctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(1*time.Second, 10*time.Second)
+
+	expected := []time.Duration{
+		1 * time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		10 * time.Second, // capped
+		10 * time.Second,
+	}
+	for _, max := range expected {
+		delay := b.next()
+		if delay > max || delay < max/2 {
+			t.Logf("Expected delay between %v and %v, got %v", max/2, max, delay)
+			t.Fail()
+		}
+	}
+
+	b.reset()
+	delay := b.next()
+	if delay > 1*time.Second {
+		t.Logf("Expected initial delay after reset, got %v", delay)
+		t.Fail()
+	}
+}
@@ -0,0 +1,251 @@
+package onkyoctl
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Captures are written as JSON lines, one record per eISCP frame:
+//
+//	{"time":"2021-03-01T20:15:04.123Z","direction":"send","frame":"4953435000..."}
+//
+// "direction" is either "send" or "recv",
+// "frame" holds the complete frame (header and payload) as hex.
+// For serial connections, "frame" holds the plain ISCP message.
+
+// Direction tells whether a frame was sent or received.
+type Direction string
+
+const (
+	// Sent frames went from the client to the device.
+	Sent Direction = "send"
+	// Received frames went from the device to the client.
+	Received Direction = "recv"
+)
+
+// CaptureRecord is a single frame from a capture.
+type CaptureRecord struct {
+	Time      time.Time
+	Direction Direction
+	Frame     []byte
+}
+
+type captureJSON struct {
+	Time      time.Time `json:"time"`
+	Direction Direction `json:"direction"`
+	Frame     string    `json:"frame"`
+}
+
+// Message parses the frame of a record.
+func (c *CaptureRecord) Message() (*EISCPMessage, error) {
+	if len(c.Frame) > 0 && c.Frame[0] == iscpStart[0] {
+		iscp, err := ParseISCP(c.Frame)
+		if err != nil {
+			return nil, err
+		}
+		return iscp.ToEISCP(), nil
+	}
+	return ParseEISCP(c.Frame)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c CaptureRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(captureJSON{
+		Time:      c.Time.UTC(),
+		Direction: c.Direction,
+		Frame:     hex.EncodeToString(c.Frame),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *CaptureRecord) UnmarshalJSON(data []byte) error {
+	var j captureJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+	frame, err := hex.DecodeString(j.Frame)
+	if err != nil {
+		return err
+	}
+	c.Time = j.Time
+	c.Direction = j.Direction
+	c.Frame = frame
+	return nil
+}
+
+// CaptureWriter writes frames to a capture.
+// It is safe for concurrent use.
+type CaptureWriter struct {
+	w    io.Writer
+	enc  *json.Encoder
+	lock sync.Mutex
+}
+
+// NewCaptureWriter creates a CaptureWriter that writes to w.
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{
+		w:   w,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// OpenCapture opens a capture file for writing.
+// New records are appended if the file exists.
+func OpenCapture(path string) (*CaptureWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewCaptureWriter(f), nil
+}
+
+// Write adds a frame to the capture.
+func (c *CaptureWriter) Write(dir Direction, frame []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.enc.Encode(CaptureRecord{
+		Time:      time.Now(),
+		Direction: dir,
+		Frame:     frame,
+	})
+}
+
+// Close closes the underlying writer if it is an io.Closer.
+func (c *CaptureWriter) Close() error {
+	closer, ok := c.w.(io.Closer)
+	if ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// CaptureReader reads records from a capture.
+type CaptureReader struct {
+	scanner *bufio.Scanner
+}
+
+// NewCaptureReader creates a CaptureReader that reads from r.
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*maxMessageSize+256)
+	return &CaptureReader{scanner: scanner}
+}
+
+// Next returns the next record from the capture.
+// io.EOF is returned after the last record.
+func (c *CaptureReader) Next() (*CaptureRecord, error) {
+	for c.scanner.Scan() {
+		line := c.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		record := &CaptureRecord{}
+		err := json.Unmarshal(line, record)
+		if err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+
+	err := c.scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return nil, err
+}
+
+// ReadCapture reads all records from the capture file at path.
+func ReadCapture(path string) ([]*CaptureRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := make([]*CaptureRecord, 0)
+	r := NewCaptureReader(f)
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+func (c *client) capture(dir Direction, frame []byte) {
+	if c.frameCB != nil {
+		record := CaptureRecord{
+			Time:      time.Now(),
+			Direction: dir,
+			Frame:     append([]byte(nil), frame...),
+		}
+		c.frameCB(record)
+	}
+	if c.captureWriter == nil {
+		return
+	}
+	err := c.captureWriter.Write(dir, frame)
+	if err != nil {
+		c.log.Warning("Error writing capture: %v", err)
+	}
+}
+
+// Replay calls fn for each record with the original delays between them.
+//
+// With a speed of 2, delays are halved; a speed of zero or less
+// replays without delays. Replay stops when ctx is done or fn fails.
+func Replay(ctx context.Context, records []*CaptureRecord, speed float64, fn func(*CaptureRecord) error) error {
+	for i, record := range records {
+		if i > 0 && speed > 0 {
+			delay := time.Duration(float64(record.Time.Sub(records[i-1].Time)) / speed)
+			if delay > 0 {
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := fn(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replay passes the received frames from a capture to the device
+// as if they came from the receiver, with the original timing.
+// The device does not need to be connected.
+//
+// Frames that cannot be parsed are skipped. See Replay for speed.
+func (d *Device) Replay(ctx context.Context, records []*CaptureRecord, speed float64) error {
+	return Replay(ctx, records, speed, func(record *CaptureRecord) error {
+		if record.Direction != Received {
+			return nil
+		}
+		msg, err := record.Message()
+		if err != nil {
+			d.log.Warning("Skip bad frame in capture: %v", err)
+			return nil
+		}
+		d.handleReceived(msg.Command())
+		return nil
+	})
+}
@@ -0,0 +1,77 @@
+package onkyoctl
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCapture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	w, err := OpenCapture(path)
+	assertNoErr(t, err)
+	assertNoErr(t, w.Write(Sent, NewEISCPMessage("PWRQSTN").Raw()))
+	assertNoErr(t, w.Write(Received, NewEISCPMessage("PWR01").Raw()))
+	assertNoErr(t, w.Close())
+
+	records, err := ReadCapture(path)
+	assertNoErr(t, err)
+	assertEqual(t, len(records), 2)
+
+	assertEqual(t, records[0].Direction, Sent)
+	assertEqual(t, records[1].Direction, Received)
+	assertEqual(t, records[1].Frame, NewEISCPMessage("PWR01").Raw())
+
+	msg, err := records[0].Message()
+	assertNoErr(t, err)
+	assertEqual(t, msg.Command(), ISCPCommand("PWRQSTN"))
+}
+
+func TestOnFrame(t *testing.T) {
+	device := NewDevice(testConfig())
+
+	var records []CaptureRecord
+	device.OnFrame(func(r CaptureRecord) {
+		records = append(records, r)
+	})
+
+	frame := NewEISCPMessage("PWR01").Raw()
+	device.client.capture(Received, frame)
+	frame[0] = 0
+
+	assertEqual(t, len(records), 1)
+	assertEqual(t, records[0].Direction, Received)
+	msg, err := records[0].Message()
+	assertNoErr(t, err)
+	assertEqual(t, msg.Command(), ISCPCommand("PWR01"))
+}
+
+func TestReplay(t *testing.T) {
+	start := time.Now()
+	records := []*CaptureRecord{
+		{Time: start, Direction: Sent, Frame: NewEISCPMessage("PWRQSTN").Raw()},
+		{Time: start.Add(10 * time.Millisecond), Direction: Received, Frame: NewEISCPMessage("PWR01").Raw()},
+		{Time: start.Add(20 * time.Millisecond), Direction: Received, Frame: []byte("garbage")},
+		{Time: start.Add(60 * time.Millisecond), Direction: Received, Frame: NewEISCPMessage("MVL20").Raw()},
+	}
+
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+	var received []string
+	device.OnMessage(func(name, value string) {
+		received = append(received, name+"="+value)
+	})
+
+	before := time.Now()
+	assertNoErr(t, device.Replay(context.Background(), records, 2))
+	elapsed := time.Since(before)
+	assertEqual(t, received, []string{"power=on", "volume=16"})
+	assertEqual(t, elapsed >= 30*time.Millisecond, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assertErr(t, device.Replay(ctx, records, 1))
+}
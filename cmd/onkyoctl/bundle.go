@@ -0,0 +1,240 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	onkyo "github.com/akeil/onkyoctl"
+	"github.com/go-ini/ini"
+)
+
+// A bundle is a gzipped tar archive with the configuration
+// and the command definitions:
+//
+//	onkyoctl.ini      configuration, CommandFile keys point to the bundled files
+//	commands.yaml     command definitions (optional)
+//	commands-N.yaml   more command definitions, e.g. for device profiles
+//
+// Scenes and profiles are sections of the configuration,
+// aliases are part of the command definitions.
+const (
+	bundleConfig   = "onkyoctl.ini"
+	bundleCommands = "commands.yaml"
+	commandFileKey = "CommandFile"
+)
+
+var errJSONBundle = errors.New("bundles support ini configuration only")
+
+func isJSON(p string) bool {
+	return strings.EqualFold(filepath.Ext(p), ".json")
+}
+
+func doExportBundle(cfgPath, target string) error {
+	if isJSON(cfgPath) {
+		return errJSONBundle
+	}
+	cfg, err := ini.Load(cfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+
+	files := make(map[string][]byte)
+
+	// the default section and device profiles may each have a CommandFile,
+	// files that are used by several sections are only added once
+	names := make(map[string]string)
+	for _, section := range cfg.Sections() {
+		if !section.HasKey(commandFileKey) {
+			continue
+		}
+		key := section.Key(commandFileKey)
+		if key.String() == "" {
+			continue
+		}
+		path := onkyo.ResolveCommandFile(key.String(), filepath.Dir(cfgPath))
+		name, ok := names[path]
+		if !ok {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read commands: %v", err)
+			}
+			name = bundleCommandsName(len(names))
+			names[path] = name
+			files[name] = data
+		}
+		key.SetValue(name)
+	}
+
+	var buf bytes.Buffer
+	_, err = cfg.WriteTo(&buf)
+	if err != nil {
+		return err
+	}
+	files[bundleConfig] = buf.Bytes()
+
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = writeBundle(f, files)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func doImportBundle(cfgPath, source string, force bool) error {
+	if isJSON(cfgPath) {
+		return errJSONBundle
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	files, err := readBundle(f)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle: %v", err)
+	}
+
+	data, ok := files[bundleConfig]
+	if !ok {
+		return errors.New("bundle does not contain a configuration")
+	}
+	cfg, err := ini.Load(data)
+	if err != nil {
+		return fmt.Errorf("invalid configuration in bundle: %v", err)
+	}
+
+	cfgPath, err = filepath.Abs(cfgPath)
+	if err != nil {
+		return err
+	}
+
+	write := make(map[string][]byte)
+	for _, section := range cfg.Sections() {
+		if !section.HasKey(commandFileKey) {
+			continue
+		}
+		key := section.Key(commandFileKey)
+		if key.String() == "" {
+			continue
+		}
+		commands, ok := files[key.String()]
+		if !ok {
+			return fmt.Errorf("bundle does not contain %v", key.String())
+		}
+		path := filepath.Join(filepath.Dir(cfgPath), "onkyoctl", key.String())
+		key.SetValue(path)
+		write[path] = commands
+	}
+
+	var buf bytes.Buffer
+	_, err = cfg.WriteTo(&buf)
+	if err != nil {
+		return err
+	}
+	write[cfgPath] = buf.Bytes()
+
+	if !force {
+		for path := range write {
+			_, err = os.Stat(path)
+			if err == nil {
+				return fmt.Errorf("%v exists, use --force to overwrite", path)
+			}
+		}
+	}
+
+	for path, data := range write {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(path, data, 0644)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %v\n", path)
+	}
+	return nil
+}
+
+// bundleCommandsName returns the name of the n-th command file in a bundle.
+func bundleCommandsName(n int) string {
+	if n == 0 {
+		return bundleCommands
+	}
+	return fmt.Sprintf("commands-%d.yaml", n)
+}
+
+func isBundleCommands(name string) bool {
+	matched, _ := filepath.Match("commands*.yaml", name)
+	return matched
+}
+
+func writeBundle(w io.Writer, files map[string][]byte) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for name, data := range files {
+		hdr := &tar.Header{
+			Name: name,
+			Mode: 0644,
+			Size: int64(len(data)),
+		}
+		err := tw.WriteHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func readBundle(r io.Reader) (map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// only accept known entries
+		if hdr.Name != bundleConfig && !isBundleCommands(hdr.Name) {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[hdr.Name] = data
+	}
+	return files, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+func writeTestFile(t *testing.T, path, data string) {
+	err := os.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "onkyoctl.ini"), `
+Host = 192.168.1.2
+CommandFile = main.yaml
+
+[device.zone2]
+Host = 192.168.1.3
+CommandFile = zone2.yaml
+
+[device.kitchen]
+CommandFile = main.yaml
+
+[scene.movie]
+Steps = power on, volume 40
+`)
+	writeTestFile(t, filepath.Join(src, "main.yaml"), `
+- name: power
+  group: PWR
+  paramtype: onOff
+- name: volume
+  group: MVL
+  paramtype: intRange
+  upper: 100
+`)
+	writeTestFile(t, filepath.Join(src, "zone2.yaml"), `
+- name: zone2-power
+  group: ZPW
+  paramtype: onOff
+  aliases:
+    standby: "off"
+`)
+
+	archive := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	err := doExportBundle(filepath.Join(src, "onkyoctl.ini"), archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "onkyoctl.ini")
+	err = doImportBundle(dst, archive, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the source directory must not be needed anymore
+	err = os.RemoveAll(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := onkyo.ReadConfig(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "192.168.1.2" {
+		t.Errorf("unexpected host %q", cfg.Host)
+	}
+	_, err = cfg.Commands.CreateCommand("volume", 40)
+	if err != nil {
+		t.Errorf("default commands not imported: %v", err)
+	}
+	_, err = cfg.Scene("movie")
+	if err != nil {
+		t.Errorf("scene not imported: %v", err)
+	}
+
+	zone2, err := cfg.Device("zone2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, err := zone2.Commands.CreateCommand("zone2-power", "standby")
+	if err != nil {
+		t.Errorf("profile commands not imported: %v", err)
+	}
+	if cmd != "ZPW00" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+
+	kitchen, err := cfg.Device("kitchen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = kitchen.Commands.CreateCommand("power", "on")
+	if err != nil {
+		t.Errorf("shared commands not imported: %v", err)
+	}
+
+	// importing again needs --force
+	err = doImportBundle(dst, archive, false)
+	if err == nil {
+		t.Error("expected error for existing files")
+	}
+	err = doImportBundle(dst, archive, true)
+	if err != nil {
+		t.Error(err)
+	}
+}
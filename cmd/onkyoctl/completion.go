@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+// Completion scripts call the hidden __complete command with the words
+// on the command line, the last one being the word to complete.
+
+const bashCompletion = `_onkyoctl() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local IFS=$'\n'
+    COMPREPLY=( $(onkyoctl __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null) )
+}
+complete -F _onkyoctl onkyoctl
+`
+
+const zshCompletion = `#compdef onkyoctl
+_onkyoctl() {
+    local -a candidates
+    candidates=(${(f)"$(onkyoctl __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    compadd -a candidates
+}
+compdef _onkyoctl onkyoctl
+`
+
+const fishCompletion = `function __onkyoctl_complete
+    set -l tokens (commandline -opc)
+    set -l cur (commandline -ct)
+    onkyoctl __complete -- $tokens[2..-1] "$cur" 2>/dev/null
+end
+complete -c onkyoctl -f -a '(__onkyoctl_complete)'
+`
+
+var completionScripts = map[string]string{
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+func doCompletion(shell string) error {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q", shell)
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// flags that take a value
+var valueFlags = map[string]bool{
+	"--host":   true,
+	"--port":   true,
+	"-p":       true,
+	"--config": true,
+	"-c":       true,
+	"--device": true,
+	"-d":       true,
+}
+
+// doComplete prints the completion candidates for the given words.
+func doComplete(subCommands, words []string) {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+
+	// collect positional args and the config flags
+	var cfgPath, deviceName string
+	args := make([]string, 0)
+	for i := 0; i < len(words)-1; i++ {
+		word := words[i]
+		if !strings.HasPrefix(word, "-") {
+			args = append(args, word)
+			continue
+		}
+		flag, value := word, ""
+		hasValue := strings.Contains(word, "=")
+		if hasValue {
+			parts := strings.SplitN(word, "=", 2)
+			flag, value = parts[0], parts[1]
+		}
+		if !hasValue && valueFlags[flag] && i+1 < len(words)-1 {
+			i++
+			value = words[i]
+		}
+		switch flag {
+		case "--config", "-c":
+			cfgPath = value
+		case "--device", "-d":
+			deviceName = value
+		}
+	}
+
+	for _, candidate := range completions(subCommands, args, cfgPath, deviceName) {
+		if strings.HasPrefix(candidate, cur) {
+			fmt.Println(candidate)
+		}
+	}
+}
+
+func completions(subCommands, args []string, cfgPath, deviceName string) []string {
+	if len(args) == 0 {
+		names := commandNames(loadCommands(cfgPath, deviceName))
+		return append(subCommands, names...)
+	}
+
+	switch args[0] {
+	case "status":
+		return commandNames(loadCommands(cfgPath, deviceName))
+	case "scene":
+		if len(args) == 1 {
+			cfg, err := onkyo.ReadConfig(configPath(cfgPath))
+			if err == nil {
+				return cfg.Scenes()
+			}
+		}
+		return nil
+	case "completion":
+		if len(args) == 1 {
+			return []string{"bash", "fish", "zsh"}
+		}
+		return nil
+	case "do":
+		args = args[1:]
+	default:
+		if contains(subCommands, args[0]) {
+			return nil
+		}
+	}
+
+	// pairs of <name> <value>
+	commands := loadCommands(cfgPath, deviceName)
+	if len(args)%2 == 0 {
+		return commandNames(commands)
+	}
+	name := args[len(args)-1]
+	for _, c := range onkyo.ListCommands(commands) {
+		if c.Name == name {
+			return c.Values()
+		}
+	}
+	return nil
+}
+
+func commandNames(commands onkyo.CommandSet) []string {
+	names := make([]string, 0)
+	for _, c := range onkyo.ListCommands(commands) {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// loadCommands reads the command set like setup, but ignores errors.
+func loadCommands(cfgPath, deviceName string) onkyo.CommandSet {
+	cfg, err := onkyo.ReadConfig(configPath(cfgPath))
+	if err != nil {
+		return onkyo.ExtendedCommands()
+	}
+	if deviceName == "" {
+		deviceName = cfg.DefaultDevice
+	}
+	if deviceName != "" {
+		p, err := cfg.Device(deviceName)
+		if err == nil {
+			cfg = p
+		}
+	}
+	if cfg.Commands == nil {
+		return onkyo.ExtendedCommands()
+	}
+	return cfg.Commands
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+	"github.com/akeil/onkyoctl/onkyotest"
+)
+
+// doEmulate runs a fake receiver for the given commands until interrupted.
+//
+// Every command starts with its first value (e.g. "off" or the lower bound).
+// With a broadcast interval, a random command is set to a random value
+// and sent to the client, like status changes from the remote.
+// A recorded session is replayed to the first client that connects.
+func doEmulate(commands onkyo.CommandSet, addr string, latency, broadcast time.Duration, replayPath string) error {
+	var records []*onkyo.CaptureRecord
+	if replayPath != "" {
+		var err error
+		records, err = onkyo.ReadCapture(replayPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	defs := onkyo.ListCommands(commands)
+	if defs == nil {
+		return fmt.Errorf("command set does not support listing")
+	}
+
+	r, err := onkyotest.NewReceiver(addr)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	r.SetLatency(latency)
+
+	emulated := make([]onkyo.Command, 0, len(defs))
+	for _, c := range defs {
+		cmd, err := sampleCommand(c, nil)
+		if err != nil {
+			continue
+		}
+		r.Set(cmd)
+		emulated = append(emulated, c)
+	}
+	log.Printf("Emulating %v commands on %v", len(emulated), r.Addr())
+
+	if records != nil {
+		go replayToClient(r, records)
+	}
+
+	if broadcast > 0 && len(emulated) > 0 {
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		ticker := time.NewTicker(broadcast)
+		defer ticker.Stop()
+		go func() {
+			for range ticker.C {
+				c := emulated[rnd.Intn(len(emulated))]
+				cmd, err := sampleCommand(c, rnd)
+				if err != nil {
+					continue
+				}
+				// ignore if no client is connected
+				r.Send(cmd)
+			}
+		}()
+	}
+
+	waitInterrupt()
+	return nil
+}
+
+// replayToClient waits for a client and replays the session to it.
+func replayToClient(r *onkyotest.Receiver, records []*onkyo.CaptureRecord) {
+	for r.WaitConnected(time.Minute) != nil {
+	}
+	log.Printf("Replaying %v frames", len(records))
+	err := r.Replay(context.Background(), records, 1)
+	if err != nil {
+		log.Printf("Replay failed: %v", err)
+		return
+	}
+	log.Printf("Replay complete")
+}
+
+// sampleCommand creates a command with a value the command accepts,
+// the first value if rnd is nil or a random value.
+// Binary commands are not supported, text commands start empty.
+func sampleCommand(c onkyo.Command, rnd *rand.Rand) (onkyo.ISCPCommand, error) {
+	var value interface{}
+	pick := func(n int) int {
+		if rnd == nil || n <= 0 {
+			return 0
+		}
+		return rnd.Intn(n)
+	}
+
+	switch c.ParamType {
+	case onkyo.Binary:
+		return "", fmt.Errorf("cannot emulate binary command %q", c.Name)
+	case onkyo.Text:
+		// the format depends on the command, e.g. "01:23/04:56" for the time
+		if rnd != nil {
+			return "", fmt.Errorf("no random values for text command %q", c.Name)
+		}
+		value = ""
+	case onkyo.IntRange, onkyo.IntRangeEnum:
+		value = c.Lower + pick(c.Upper-c.Lower+1)
+	case onkyo.Milliseconds:
+		step := c.Step
+		if step < 1 {
+			step = 1
+		}
+		value = c.Lower + pick((c.Upper-c.Lower)/step+1)*step
+	case onkyo.SignedRange:
+		value = c.Lower + pick(c.Upper-c.Lower+1)
+	case onkyo.Tone:
+		value = fmt.Sprintf("bass %d treble %d", c.Lower+pick(c.Upper-c.Lower+1), c.Lower+pick(c.Upper-c.Lower+1))
+	case onkyo.Frequency:
+		// FM band in 100 kHz steps
+		value = fmt.Sprintf("%.1f MHz", 87.5+float64(pick(206))/10)
+	default:
+		values := make([]string, 0)
+		for _, v := range c.Values() {
+			if !isRelative(c, v) {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			return "", fmt.Errorf("no values for command %q", c.Name)
+		}
+		value = values[pick(len(values))]
+	}
+	return c.CreateCommand(value)
+}
+
+// isRelative tells if value changes the current state (e.g. "up" or
+// "toggle") rather than setting it.
+func isRelative(c onkyo.Command, value string) bool {
+	cmd, err := c.CreateCommand(value)
+	if err != nil {
+		return true
+	}
+	_, param := onkyo.SplitISCP(cmd)
+	switch param {
+	case "UP", "DOWN", "TG", "QSTN", "MOVIE", "MUSIC", "GAME":
+		return true
+	}
+	return false
+}
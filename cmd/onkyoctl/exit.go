@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net"
+	"os"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+// Exit codes, so that scripts can tell failures apart.
+const (
+	exitError          = 1
+	exitConnection     = 3
+	exitUnknownCommand = 4
+	exitInvalidParam   = 5
+	exitTimeout        = 6
+)
+
+// exitCode classifies an error.
+func exitCode(err error) int {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, onkyo.ErrUnknownCommand):
+		return exitUnknownCommand
+	case errors.Is(err, onkyo.ErrInvalidParam):
+		return exitInvalidParam
+	case errors.Is(err, onkyo.ErrTimeout):
+		return exitTimeout
+	case errors.Is(err, onkyo.ErrNotConnected), errors.As(err, &netErr):
+		return exitConnection
+	default:
+		return exitError
+	}
+}
+
+// fatal prints the error and exits with the matching exit code.
+func fatal(err error) {
+	log.Print(err)
+	os.Exit(exitCode(err))
+}
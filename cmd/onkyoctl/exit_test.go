@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+	"github.com/akeil/onkyoctl/onkyotest"
+)
+
+const testTimeout = 300 * time.Millisecond
+
+// receiver states for the exit code tests
+const (
+	receiverUp     = "up"
+	receiverSlow   = "slow"
+	receiverClosed = "closed"
+)
+
+func startReceiver(t *testing.T, state string) (string, int) {
+	r, err := onkyotest.NewReceiver("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range []onkyo.ISCPCommand{"PWR01", "MVL20", "PRS03"} {
+		r.Set(cmd)
+	}
+	switch state {
+	case receiverClosed:
+		// nothing listens on the port
+		r.Close()
+	case receiverSlow:
+		r.SetLatency(3 * testTimeout)
+		t.Cleanup(func() { r.Close() })
+	default:
+		t.Cleanup(func() { r.Close() })
+	}
+	return r.Host(), r.Port()
+}
+
+func TestExitCodes(t *testing.T) {
+	cases := []struct {
+		name     string
+		receiver string
+		run      func(d *onkyo.Device, out *output) error
+		expected int
+	}{
+		{"do", receiverUp, func(d *onkyo.Device, out *output) error {
+			return doCommands(d, out, []string{"power", "on"}, testTimeout)
+		}, 0},
+		{"do unknown", receiverUp, func(d *onkyo.Device, out *output) error {
+			return doCommands(d, out, []string{"warp", "on"}, testTimeout)
+		}, exitUnknownCommand},
+		{"do invalid", receiverUp, func(d *onkyo.Device, out *output) error {
+			return doCommands(d, out, []string{"volume", "loud"}, testTimeout)
+		}, exitInvalidParam},
+		{"do closed", receiverClosed, func(d *onkyo.Device, out *output) error {
+			return doCommands(d, out, []string{"power", "on"}, testTimeout)
+		}, exitConnection},
+
+		{"status", receiverUp, func(d *onkyo.Device, out *output) error {
+			return doStatus(d, out, []string{"power", "volume"}, testTimeout)
+		}, 0},
+		{"status unknown", receiverUp, func(d *onkyo.Device, out *output) error {
+			return doStatus(d, out, []string{"warp"}, testTimeout)
+		}, exitUnknownCommand},
+		{"status slow", receiverSlow, func(d *onkyo.Device, out *output) error {
+			return doStatus(d, out, []string{"power"}, testTimeout)
+		}, exitTimeout},
+		{"status closed", receiverClosed, func(d *onkyo.Device, out *output) error {
+			return doStatus(d, out, []string{"power"}, testTimeout)
+		}, exitConnection},
+		{"status --all closed", receiverClosed, func(d *onkyo.Device, out *output) error {
+			return doStatusAll(d, out, testTimeout)
+		}, exitConnection},
+		{"status --every closed", receiverClosed, func(d *onkyo.Device, out *output) error {
+			return doStatusEvery(d, out, nil, time.Second, false, testTimeout)
+		}, exitConnection},
+
+		{"wait-for", receiverUp, func(d *onkyo.Device, out *output) error {
+			return doWaitFor(d, "power", "on", testTimeout)
+		}, 0},
+		{"wait-for unknown", receiverUp, func(d *onkyo.Device, out *output) error {
+			return doWaitFor(d, "warp", "on", testTimeout)
+		}, exitUnknownCommand},
+		{"wait-for invalid", receiverUp, func(d *onkyo.Device, out *output) error {
+			return doWaitFor(d, "power", "maybe", testTimeout)
+		}, exitInvalidParam},
+		{"wait-for slow", receiverSlow, func(d *onkyo.Device, out *output) error {
+			return doWaitFor(d, "power", "on", testTimeout)
+		}, exitTimeout},
+		{"wait-for closed", receiverClosed, func(d *onkyo.Device, out *output) error {
+			return doWaitFor(d, "power", "on", testTimeout)
+		}, exitConnection},
+
+		{"preset", receiverUp, func(d *onkyo.Device, out *output) error {
+			return doPreset(d, out, 3, false, testTimeout)
+		}, 0},
+		{"preset invalid", receiverUp, func(d *onkyo.Device, out *output) error {
+			return doPreset(d, out, 99, false, testTimeout)
+		}, exitInvalidParam},
+		{"preset closed", receiverClosed, func(d *onkyo.Device, out *output) error {
+			return doPreset(d, out, 3, false, testTimeout)
+		}, exitConnection},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			host, port := startReceiver(t, c.receiver)
+			cfg := onkyo.DefaultConfig()
+			cfg.Host = host
+			cfg.Port = port
+			cfg.Commands = onkyo.ExtendedCommands()
+			cfg.Log = onkyo.NewLogger(onkyo.NoLog)
+			device := onkyo.NewDevice(cfg)
+			device.Start()
+			defer device.Stop()
+
+			code := 0
+			err := c.run(device, newOutput(device, formatText))
+			if err != nil {
+				code = exitCode(err)
+			}
+			if code != c.expected {
+				t.Errorf("expected exit code %d, got %d (%v)", c.expected, code, err)
+			}
+		})
+	}
+}
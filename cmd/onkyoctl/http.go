@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	onkyo "github.com/akeil/onkyoctl"
+	"github.com/akeil/onkyoctl/httpapi"
+)
+
+// httpBridge serves the REST API on address
+// or on a listener from socket activation.
+type httpBridge struct {
+	address  string
+	listener net.Listener
+	limiter  *onkyo.RateLimiter
+	origins  []string
+}
+
+func (b *httpBridge) name() string {
+	if b.listener != nil {
+		return "HTTP API on " + b.listener.Addr().String()
+	}
+	return "HTTP API on " + b.address
+}
+
+func (b *httpBridge) run(ctx context.Context, device *onkyo.Device) error {
+	handler := httpapi.NewServer(device, b.limiter)
+	handler.AllowOrigins(b.origins...)
+	server := &http.Server{
+		Addr:    b.address,
+		Handler: handler,
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	var err error
+	if b.listener != nil {
+		err = server.Serve(b.listener)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// splitList splits a comma separated list from the config.
+func splitList(s string) []string {
+	values := make([]string, 0)
+	for _, value := range strings.Split(s, ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"context"
+
+	onkyo "github.com/akeil/onkyoctl"
+	"github.com/akeil/onkyoctl/influx"
+)
+
+// influxBridge writes state changes in InfluxDB line protocol.
+type influxBridge struct {
+	sink   *influx.Sink
+	target string
+}
+
+func (b *influxBridge) name() string {
+	return "InfluxDB output to " + b.target
+}
+
+func (b *influxBridge) run(ctx context.Context, device *onkyo.Device) error {
+	return b.sink.Run(ctx, device)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+// commandInfo describes a command for list-commands.
+type commandInfo struct {
+	Name      string          `json:"name"`
+	Group     onkyo.ISCPGroup `json:"group"`
+	Category  string          `json:"category,omitempty"`
+	ParamType onkyo.ParamType `json:"paramType"`
+	Values    []string        `json:"values,omitempty"`
+	Lower     *int            `json:"lower,omitempty"`
+	Upper     *int            `json:"upper,omitempty"`
+}
+
+func newCommandInfo(c onkyo.Command) commandInfo {
+	info := commandInfo{
+		Name:      c.Name,
+		Group:     c.Group,
+		Category:  c.Category,
+		ParamType: c.ParamType,
+		Values:    c.Values(),
+	}
+	switch c.ParamType {
+	case onkyo.IntRange, onkyo.IntRangeEnum, onkyo.SignedRange, onkyo.Tone, onkyo.Milliseconds:
+		lower, upper := c.Lower, c.Upper
+		info.Lower = &lower
+		info.Upper = &upper
+	}
+	return info
+}
+
+// accepted describes the accepted values in a single line.
+func (c commandInfo) accepted() string {
+	values := c.Values
+	if c.Lower != nil {
+		values = append([]string{fmt.Sprintf("%v..%v", *c.Lower, *c.Upper)}, values...)
+	}
+	return strings.Join(values, ", ")
+}
+
+func doListCommands(device *onkyo.Device, asJSON bool, category string) error {
+	commands := onkyo.ListCommands(device.Commands())
+	if commands == nil {
+		return fmt.Errorf("command set does not support listing")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if !asJSON {
+		fmt.Fprintln(w, "NAME\tGROUP\tCATEGORY\tTYPE\tVALUES")
+	}
+
+	for _, c := range commands {
+		if category != "" && c.Category != category {
+			continue
+		}
+		info := newCommandInfo(c)
+		if asJSON {
+			err := enc.Encode(info)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", info.Name, info.Group, info.Category, info.ParamType, info.accepted())
+	}
+
+	if asJSON {
+		return nil
+	}
+	return w.Flush()
+}
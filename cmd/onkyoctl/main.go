@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -15,21 +18,33 @@ import (
 	onkyo "github.com/akeil/onkyoctl"
 )
 
+// Default timeouts for the connection and responses, see --timeout.
+const (
+	defaultTimeout        = 5 * time.Second
+	defaultWaitForTimeout = 30 * time.Second
+)
+
 func main() {
 	// command line interface is:
 	// PROG watch
 	// PROG status
 	// PROG <name> <param>
 	//
-	// with optional args --host and --port
+	// with optional args --host, --port and --device
 	app := kingpin.New("onkyo", "Control Onkyo receiver.")
 	app.HelpFlag.Short('h')
 
 	var (
-		host    = app.Flag("host", "Hostname or IP address").String()
-		port    = app.Flag("port", "Port number").Default("60128").Short('p').Int()
-		cfgPath = app.Flag("config", "Path to configuration file").Short('c').String()
-		verbose = app.Flag("verbose", "Verbose output").Short('v').Bool()
+		host       = app.Flag("host", "Hostname or IP address").String()
+		port       = app.Flag("port", "Port number (default: 60128)").Short('p').Int()
+		cfgPath    = app.Flag("config", "Path to configuration file").Short('c').String()
+		deviceName = app.Flag("device", "Name of a device profile from the configuration").Short('d').String()
+		verbose    = app.Flag("verbose", "Verbose output").Short('v').Bool()
+		trace      = app.Flag("trace", "Log a hex dump of every frame (implies --verbose)").Bool()
+		record     = app.Flag("record", "Record all frames with timestamps to this file, see replay").String()
+		jsonOut    = app.Flag("json", "Print newline-delimited JSON objects, same as --format json").Bool()
+		timeout    = app.Flag("timeout", "Time to wait for the connection and responses (default: 5s, 30s for wait-for)").Duration()
+		format     = app.Flag("format", "Output format: text, json, csv or tsv").Default(formatText).Enum(formatText, formatJSON, formatCSV, formatTSV)
 	)
 
 	do := app.Command("do", "Execute a command").Default()
@@ -37,69 +52,257 @@ func main() {
 
 	status := app.Command("status", "Show device status")
 	var names = status.Arg("names", "Status items to query, e.g. 'power volume'. Leave empty to query defaults").Strings()
+	var (
+		statusAll         = status.Flag("all", "Query all known commands").Bool()
+		statusEvery       = status.Flag("every", "Query again at this interval until interrupted, e.g. '10s'").Duration()
+		statusChangesOnly = status.Flag("changes-only", "With --every, print values only if they changed").Bool()
+	)
 
 	watch := app.Command("watch", "Watch device status")
+	var (
+		watchOnly        = watch.Flag("only", "Show only these commands, e.g. 'power,volume'").Strings()
+		watchExclude     = watch.Flag("exclude", "Do not show these commands, e.g. 'net-time'").Strings()
+		watchRaw         = watch.Flag("raw", "Show raw ISCP messages, filters apply to the ISCP group").Bool()
+		watchSinceChange = watch.Flag("since-change", "Show values only if they changed").Bool()
+	)
+	raw := app.Command("raw", "Send an ISCP command verbatim, e.g. 'MVL2E'")
+	var (
+		rawCommand = raw.Arg("command", "ISCP command to send").Required().String()
+		rawExpect  = raw.Flag("expect", "Print responses for this ISCP group, e.g. 'MVL'").String()
+		rawWait    = raw.Flag("wait", "How long to wait for responses").Default("2s").Duration()
+	)
+
+	waitFor := app.Command("wait-for", "Wait until the device reports a value, e.g. 'power on'")
+	var (
+		waitName  = waitFor.Arg("name", "Command name").Required().String()
+		waitValue = waitFor.Arg("value", "Value to wait for").Required().String()
+	)
+
+	toggle := app.Command("toggle", "Switch commands to the opposite state")
+	var toggleNames = toggle.Arg("names", "Commands to toggle, e.g. 'mute power'").Required().Strings()
+
+	preset := app.Command("preset", "Select a tuner preset, e.g. 'preset 3'")
+	var (
+		presetNumber = preset.Arg("number", "Number of the preset").Required().Int()
+		presetStore  = preset.Flag("store", "Store the current station as this preset").Bool()
+	)
+
+	scene := app.Command("scene", "Run a scene from the configuration")
+	var sceneName = scene.Arg("name", "Name of the scene, e.g. 'movie-night'").Required().String()
+
+	tui := app.Command("tui", "Show a live dashboard")
+
+	serve := app.Command("serve", "Keep a connection to the device and run the configured bridges")
+
+	emulate := app.Command("emulate", "Run a fake receiver for testing without hardware")
+	var (
+		emulateListen    = emulate.Flag("listen", "Address to listen on").Default(":60128").String()
+		emulateLatency   = emulate.Flag("latency", "Delay before each reply, e.g. '50ms'").Duration()
+		emulateBroadcast = emulate.Flag("broadcast", "Send a random status change at this interval, e.g. '10s'").Duration()
+		emulateReplay    = emulate.Flag("replay", "Replay a recorded session to the first client").String()
+	)
+
+	replay := app.Command("replay", "Print the messages from a recorded session with the original timing")
+	var (
+		replayPath  = replay.Arg("file", "Recorded session, see --record").Required().String()
+		replaySpeed = replay.Flag("speed", "Replay faster (2) or slower (0.5), 0 for no delays").Default("1").Float64()
+	)
+
+	monitor := app.Command("monitor", "Print every frame with timestamp and hex dump")
+
+	listCommands := app.Command("list-commands", "List the known commands")
+	var listCategory = listCommands.Flag("category", "Show only commands from this category, e.g. 'audio'").String()
+
 	version := app.Command("version", "Print version")
 
+	completion := app.Command("completion", "Print a shell completion script, e.g. 'source <(onkyoctl completion bash)'")
+	var completionShell = completion.Arg("shell", "bash, zsh or fish").Required().Enum("bash", "zsh", "fish")
+
+	complete := app.Command("__complete", "Print completion candidates").Hidden()
+	var completeWords = complete.Arg("words", "Words on the command line").Strings()
+
+	exportBundle := app.Command("export-bundle", "Export configuration and commands to an archive")
+	var exportPath = exportBundle.Arg("archive", "Path to the archive to create").Required().String()
+
+	importBundle := app.Command("import-bundle", "Import configuration and commands from an archive")
+	var importPath = importBundle.Arg("archive", "Path to the archive to import").Required().String()
+	var importForce = importBundle.Flag("force", "Overwrite existing files").Bool()
+
 	subCommand := kingpin.MustParse(app.Parse(os.Args[1:]))
 
-	if subCommand == version.FullCommand() {
+	switch subCommand {
+	case version.FullCommand():
 		fmt.Println(onkyo.Version)
 		return
+	case completion.FullCommand():
+		err := doCompletion(*completionShell)
+		if err != nil {
+			fatal(err)
+		}
+		return
+	case complete.FullCommand():
+		subCommands := make([]string, 0)
+		for _, c := range app.Model().Commands {
+			if !c.Hidden {
+				subCommands = append(subCommands, c.Name)
+			}
+		}
+		doComplete(subCommands, *completeWords)
+		return
+	case exportBundle.FullCommand():
+		err := doExportBundle(configPath(*cfgPath), *exportPath)
+		if err != nil {
+			fatal(err)
+		}
+		return
+	case importBundle.FullCommand():
+		err := doImportBundle(configPath(*cfgPath), *importPath, *importForce)
+		if err != nil {
+			fatal(err)
+		}
+		return
 	}
 
 	logLevel := onkyo.Error
 	if *verbose {
 		logLevel = onkyo.Debug
 	}
+	if *trace {
+		logLevel = onkyo.Trace
+	}
 
-	device := setup(logLevel, *cfgPath, *host, *port)
+	device, cfg := setup(logLevel, *cfgPath, *deviceName, *host, *port, *record)
+	if subCommand == listCommands.FullCommand() {
+		err := doListCommands(device, *jsonOut || *format == formatJSON, *listCategory)
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if subCommand == emulate.FullCommand() {
+		err := doEmulate(cfg.Commands, *emulateListen, *emulateLatency, *emulateBroadcast, *emulateReplay)
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if subCommand == serve.FullCommand() {
+		err := doServe(cfg)
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if *jsonOut {
+		*format = formatJSON
+	}
+	out := newOutput(device, *format)
+	out.onMessage(func(m *onkyo.ParsedMessage) {
+		out.print(m, " = ")
+	})
+	if subCommand == monitor.FullCommand() {
+		doMonitor(device, out)
+	}
+	if subCommand == replay.FullCommand() {
+		err := doReplay(device, *replayPath, *replaySpeed)
+		if err != nil {
+			fatal(err)
+		}
+		return
+	}
 	device.Start()
 	defer device.Stop()
 
+	responseTimeout := *timeout
+	if responseTimeout <= 0 {
+		responseTimeout = defaultTimeout
+	}
+
 	var err error
 	switch subCommand {
 	case do.FullCommand():
-		err = doCommands(device, *commands)
+		err = doCommands(device, out, *commands, responseTimeout)
 
 	case status.FullCommand():
-		err = doStatus(device, *names)
+		if *statusAll {
+			err = doStatusAll(device, out, responseTimeout)
+		} else if *statusEvery > 0 {
+			err = doStatusEvery(device, out, *names, *statusEvery, *statusChangesOnly, responseTimeout)
+		} else {
+			err = doStatus(device, out, *names, responseTimeout)
+		}
+
+	case monitor.FullCommand():
+		waitInterrupt()
+
+	case tui.FullCommand():
+		err = doTUI(device)
+
+	case waitFor.FullCommand():
+		wait := *timeout
+		if wait <= 0 {
+			wait = defaultWaitForTimeout
+		}
+		err = doWaitFor(device, *waitName, *waitValue, wait)
+
+	case toggle.FullCommand():
+		err = doToggle(device, out, *toggleNames)
+
+	case preset.FullCommand():
+		err = doPreset(device, out, *presetNumber, *presetStore, responseTimeout)
+
+	case scene.FullCommand():
+		err = doScene(device, cfg, out, *sceneName)
+
+	case raw.FullCommand():
+		err = doRaw(device, out, onkyo.ISCPCommand(*rawCommand), *rawExpect, *rawWait)
 
 	case watch.FullCommand():
-		err = doWatch(device)
+		filter := newWatchFilter(*watchOnly, *watchExclude, *watchSinceChange)
+		err = doWatch(device, out, filter, *watchRaw)
 	}
 
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 }
 
-func doStatus(device *onkyo.Device, names []string) error {
-	fmt.Printf("Status [%v]:\n", device.Host)
+// defaultStatusNames are queried by status without arguments.
+var defaultStatusNames = []string{
+	"power",
+	"volume",
+	"mute",
+	"speaker-a",
+	"speaker-b",
+	"input",
+}
+
+func doStatus(device *onkyo.Device, out *output, names []string, timeout time.Duration) error {
+	// a connection failure is not a timeout
+	err := device.WaitConnect(timeout)
+	if err != nil {
+		return err
+	}
+	out.heading("Status [%v]:", device.Host)
 
 	if len(names) == 0 {
-		names = []string{
-			"power",
-			"volume",
-			"mute",
-			"speaker-a",
-			"speaker-b",
-			"input",
-		}
+		names = defaultStatusNames
 	}
 
 	// expect a reply for every query we send
 	var wait sync.WaitGroup
 
-	device.OnMessage(func(name, value string) {
-		fmt.Printf("%v: %v\n", name, value)
+	out.onMessage(func(m *onkyo.ParsedMessage) {
+		out.print(m, ": ")
 		// note: not *quite* correct - we accept duplicate responses
-		if contains(names, name) {
+		if contains(names, m.Name) {
 			wait.Done()
 		}
 	})
 
-	var err error
 	for _, name := range names {
 		wait.Add(1)
 		err = device.Query(name)
@@ -118,20 +321,102 @@ func doStatus(device *onkyo.Device, names []string) error {
 	select {
 	case <-done:
 		return nil
-	case <-time.After(5 * time.Second):
-		return errors.New("Timeout waiting for response")
+	case <-time.After(timeout):
+		return fmt.Errorf("%w waiting for response", onkyo.ErrTimeout)
 	}
 }
 
-func doWatch(device *onkyo.Device) error {
+// doWaitFor waits until the device reports the value for name.
+// The timeout includes the time to connect.
+func doWaitFor(device *onkyo.Device, name, value string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := device.WaitConnect(timeout)
+	if err != nil {
+		return err
+	}
+	return device.WaitFor(ctx, name, value)
+}
+
+func doWatch(device *onkyo.Device, out *output, filter *watchFilter, raw bool) error {
+	if raw {
+		device.OnMessage(nil)
+		device.OnRaw(func(cmd onkyo.ISCPCommand) {
+			group, param := onkyo.SplitISCP(cmd)
+			if filter.accept(string(group), param) {
+				out.printRaw(cmd)
+			}
+		})
+	} else {
+		out.onMessage(func(m *onkyo.ParsedMessage) {
+			if filter.accept(m.Name, m.Value) {
+				out.print(m, " = ")
+			}
+		})
+	}
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
-	<-stop // wait for SIGINT
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	for {
+		select {
+		case <-stop: // wait for SIGINT
+			return nil
+		case <-reload:
+			err := device.Reload()
+			if err != nil {
+				log.Printf("Reload failed: %v", err)
+			}
+		}
+	}
+}
 
+func doRaw(device *onkyo.Device, out *output, cmd onkyo.ISCPCommand, expect string, wait time.Duration) error {
+	if len(cmd) < 3 {
+		return fmt.Errorf("invalid ISCP command %q", cmd)
+	}
+
+	device.OnMessage(nil)
+	device.OnRaw(func(received onkyo.ISCPCommand) {
+		group, _ := onkyo.SplitISCP(received)
+		if expect != "" && string(group) == expect {
+			out.printRaw(received)
+		}
+	})
+
+	err := device.SendISCP(cmd, wait)
+	if err != nil {
+		return err
+	}
+
+	if expect != "" {
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+func doToggle(device *onkyo.Device, out *output, names []string) error {
+	// print the new values
+	device.OnRaw(nil)
+	for _, name := range names {
+		value, err := device.Toggle(name)
+		if err != nil {
+			return err
+		}
+		m := &onkyo.ParsedMessage{Name: name, Value: value, Time: time.Now()}
+		cmd, err := device.Preview(name, value)
+		if err == nil {
+			m.Group, _ = onkyo.SplitISCP(cmd)
+			m.Raw = cmd
+		}
+		out.print(m, " = ")
+	}
 	return nil
 }
 
-func doCommands(device *onkyo.Device, pairs []string) error {
+func doCommands(device *onkyo.Device, out *output, pairs []string, timeout time.Duration) error {
 	if len(pairs)%2 != 0 {
 		return errors.New("number of arguments must be even")
 	}
@@ -139,26 +424,45 @@ func doCommands(device *onkyo.Device, pairs []string) error {
 	for i := 0; i < len(pairs); i += 2 {
 		name := pairs[i]
 		value := pairs[i+1]
-		err := device.SendCommand(name, value)
+		if value == "toggle" {
+			// also works for commands without a toggle parameter
+			_, err := device.Toggle(name)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		cmd, err := device.Preview(name, value)
+		if err != nil {
+			return err
+		}
+		// wait until sent, to report connection errors
+		err = device.SendISCP(cmd, timeout)
 		if err != nil {
 			return err
 		}
+		if out.json {
+			out.printRaw(cmd)
+		}
 	}
 
 	return nil
 }
 
-func setup(logLevel onkyo.LogLevel, cfgPath, host string, port int) *onkyo.Device {
+func doPreset(device *onkyo.Device, out *output, number int, store bool, timeout time.Duration) error {
+	name := "preset"
+	if store {
+		name = "preset-store"
+	}
+	return doCommands(device, out, []string{name, strconv.Itoa(number)}, timeout)
+}
+
+func setup(logLevel onkyo.LogLevel, cfgPath, deviceName, host string, port int, record string) (*onkyo.Device, *onkyo.Config) {
 	var err error
 	cfg := onkyo.DefaultConfig()
 
-	// explicit param or default
-	if cfgPath == "" {
-		cfgBase, err := os.UserConfigDir()
-		if err == nil {
-			cfgPath = path.Join(cfgBase, "onkyoctl.ini")
-		}
-	}
+	cfgPath = configPath(cfgPath)
 	if cfgPath != "" {
 		cfg, err = onkyo.ReadConfig(cfgPath)
 		if err != nil {
@@ -167,7 +471,17 @@ func setup(logLevel onkyo.LogLevel, cfgPath, host string, port int) *onkyo.Devic
 		}
 	}
 
-	cfg.Log = onkyo.NewLogger(logLevel)
+	if deviceName == "" {
+		deviceName = cfg.DefaultDevice
+	}
+	if deviceName != "" {
+		cfg, err = cfg.Device(deviceName)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	cfg.Log = newLogger(logLevel, cfg)
 
 	// override some config settings from command line
 	if host != "" {
@@ -176,16 +490,50 @@ func setup(logLevel onkyo.LogLevel, cfgPath, host string, port int) *onkyo.Devic
 	if port != 0 {
 		cfg.Port = port
 	}
+	if record != "" {
+		cfg.CaptureFile = record
+	}
 
 	if cfg.Commands == nil {
-		cfg.Commands = onkyo.BasicCommands()
+		cfg.Commands = onkyo.ExtendedCommands()
 	}
 
-	device := onkyo.NewDevice(cfg)
-	device.OnMessage(func(name, value string) {
-		fmt.Printf("%v = %v\n", name, value)
-	})
-	return device
+	return onkyo.NewDevice(cfg), cfg
+}
+
+// newLogger logs to the LogFile from the config, or to stderr.
+func newLogger(logLevel onkyo.LogLevel, cfg *onkyo.Config) onkyo.Logger {
+	if cfg.LogFile == "" {
+		return onkyo.NewLogger(logLevel)
+	}
+	maxSize := int64(cfg.LogMaxSize) << 20
+	l, err := onkyo.NewFileLogger(logLevel, cfg.LogFile, maxSize, cfg.LogMaxAge, cfg.LogBackups)
+	if err != nil {
+		log.Printf("Error opening log file %q: %v", cfg.LogFile, err)
+		return onkyo.NewLogger(logLevel)
+	}
+	return l
+}
+
+// configPath returns the explicit config path or the default location.
+// The default is onkyoctl.ini, or onkyoctl.json if only that exists.
+func configPath(cfgPath string) string {
+	if cfgPath == "" {
+		cfgBase, err := os.UserConfigDir()
+		if err == nil {
+			cfgPath = path.Join(cfgBase, "onkyoctl.ini")
+			jsonPath := path.Join(cfgBase, "onkyoctl.json")
+			if !exists(cfgPath) && exists(jsonPath) {
+				cfgPath = jsonPath
+			}
+		}
+	}
+	return cfgPath
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
 }
 
 func contains(haystack []string, needle string) bool {
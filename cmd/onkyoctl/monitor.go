@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+// monitorRecord is the JSON output for a frame.
+type monitorRecord struct {
+	Time      time.Time       `json:"timestamp"`
+	Direction onkyo.Direction `json:"direction"`
+	Frame     string          `json:"frame"`
+	Raw       string          `json:"raw,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Value     string          `json:"value,omitempty"`
+}
+
+// doMonitor prints every frame with timestamp, direction and a hex dump,
+// followed by the interpretation if the command is known.
+// The callback must be installed before the device is started.
+func doMonitor(device *onkyo.Device, out *output) {
+	device.OnRaw(nil)
+	device.OnFrame(func(record onkyo.CaptureRecord) {
+		r := monitorRecord{
+			Time:      record.Time,
+			Direction: record.Direction,
+			Frame:     hex.EncodeToString(record.Frame),
+		}
+		msg, err := record.Message()
+		if err == nil {
+			r.Raw = string(msg.Command())
+			m, err := device.ParseMessage(msg.Command())
+			if err == nil {
+				r.Name = m.Name
+				r.Value = m.Value
+			}
+		}
+
+		if out.json {
+			out.encode(r)
+			return
+		}
+
+		line := fmt.Sprintf("%v %v %v", r.Time.Format("2006-01-02T15:04:05.000Z07:00"), r.Direction, r.Raw)
+		if r.Name != "" {
+			line += fmt.Sprintf(" (%v = %v)", r.Name, r.Value)
+		}
+		dump := strings.TrimRight(hex.Dump(record.Frame), "\n")
+		out.text(line + "\n" + dump)
+	})
+}
+
+func waitInterrupt() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+}
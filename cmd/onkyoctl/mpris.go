@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	onkyo "github.com/akeil/onkyoctl"
+	"github.com/akeil/onkyoctl/mpris"
+	"github.com/godbus/dbus/v5"
+)
+
+// mprisBridge registers the network player on D-Bus.
+type mprisBridge struct {
+	bus string
+}
+
+func (b *mprisBridge) name() string {
+	return "MPRIS player on the " + b.bus + " bus"
+}
+
+func (b *mprisBridge) run(ctx context.Context, device *onkyo.Device) error {
+	var conn *dbus.Conn
+	var err error
+	switch b.bus {
+	case "session":
+		conn, err = dbus.ConnectSessionBus()
+	case "system":
+		conn, err = dbus.ConnectSystemBus()
+	default:
+		return fmt.Errorf("unknown bus %q, use session or system", b.bus)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return mpris.NewPlayer(device, "onkyoctl").Run(ctx, conn)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+// Output formats
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatCSV  = "csv"
+	formatTSV  = "tsv"
+)
+
+// output writes messages as text, newline-delimited JSON
+// or as CSV/TSV rows with timestamp, name and value.
+type output struct {
+	json   bool
+	device *onkyo.Device
+	enc    *json.Encoder
+	csv    *csv.Writer
+	header bool
+	lock   sync.Mutex
+}
+
+func newOutput(device *onkyo.Device, format string) *output {
+	o := &output{
+		json:   format == formatJSON,
+		device: device,
+		enc:    json.NewEncoder(os.Stdout),
+	}
+	if format == formatCSV || format == formatTSV {
+		o.csv = csv.NewWriter(os.Stdout)
+		if format == formatTSV {
+			o.csv.Comma = '\t'
+		}
+	}
+	return o
+}
+
+// onMessage passes all received messages for known commands to callback.
+func (o *output) onMessage(callback func(*onkyo.ParsedMessage)) {
+	o.device.OnMessage(nil)
+	o.device.OnRaw(func(cmd onkyo.ISCPCommand) {
+		m, err := o.device.ParseMessage(cmd)
+		if err == nil {
+			callback(m)
+		}
+	})
+}
+
+// print writes a message as "<name><sep><value>" or as JSON object.
+func (o *output) print(m *onkyo.ParsedMessage, sep string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.json {
+		o.enc.Encode(m)
+	} else if o.csv != nil {
+		if !o.header {
+			o.csv.Write([]string{"timestamp", "name", "value"})
+			o.header = true
+		}
+		o.csv.Write([]string{m.Time.Format(time.RFC3339Nano), m.Name, m.Value})
+		o.csv.Flush()
+	} else {
+		fmt.Printf("%v%v%v\n", m.Name, sep, m.Value)
+	}
+}
+
+// encode writes v as JSON object.
+func (o *output) encode(v interface{}) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.enc.Encode(v)
+}
+
+// printRaw writes an ISCP command as it was received.
+func (o *output) printRaw(cmd onkyo.ISCPCommand) {
+	if !o.json && o.csv == nil {
+		o.lock.Lock()
+		defer o.lock.Unlock()
+		fmt.Println(cmd)
+		return
+	}
+
+	m, err := o.device.ParseMessage(cmd)
+	if err != nil {
+		group, param := onkyo.SplitISCP(cmd)
+		m = &onkyo.ParsedMessage{Group: group, Raw: cmd, Time: time.Now()}
+		if o.csv != nil {
+			m.Name, m.Value = string(group), param
+		}
+	}
+	o.print(m, "")
+}
+
+// text writes a line of text.
+func (o *output) text(line string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	fmt.Println(line)
+}
+
+// heading writes a line of text, it is omitted for JSON and CSV.
+func (o *output) heading(format string, v ...interface{}) {
+	if !o.json && o.csv == nil {
+		fmt.Printf(format+"\n", v...)
+	}
+}
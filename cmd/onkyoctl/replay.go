@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+// doReplay passes the received frames from a recorded session to the device
+// with the original timing; messages are printed by the output callback.
+func doReplay(device *onkyo.Device, path string, speed float64) error {
+	records, err := onkyo.ReadCapture(path)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	err = device.Replay(ctx, records, speed)
+	if err == context.Canceled {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+// stepResult is the JSON output for a scene step.
+type stepResult struct {
+	Step  string `json:"step"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func doScene(device *onkyo.Device, cfg *onkyo.Config, out *output, name string) error {
+	scene, err := cfg.Scene(name)
+	if err != nil {
+		return err
+	}
+	// only report the steps, not the responses
+	device.OnRaw(nil)
+
+	return device.RunScene(scene, func(step onkyo.SceneStep, err error) {
+		if out.json {
+			result := stepResult{Step: step.String(), OK: err == nil}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			out.encode(result)
+		} else if err != nil {
+			fmt.Printf("FAIL %v: %v\n", step, err)
+		} else {
+			fmt.Printf("ok   %v\n", step)
+		}
+	})
+}
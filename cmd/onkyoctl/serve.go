@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	onkyo "github.com/akeil/onkyoctl"
+	"github.com/akeil/onkyoctl/influx"
+)
+
+// A bridge makes the device available to other programs,
+// e.g. over HTTP or MQTT.
+type bridge interface {
+	// name is used in log messages.
+	name() string
+	// run serves until ctx is done.
+	run(ctx context.Context, device *onkyo.Device) error
+}
+
+// configuredBridges returns the bridges enabled in the config.
+// With socket activation, the HTTP API uses the socket from systemd.
+func configuredBridges(cfg *onkyo.Config) ([]bridge, error) {
+	bridges := make([]bridge, 0)
+	listener, err := systemdListener()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.HTTPAddress != "" || listener != nil {
+		limiter := onkyo.NewRateLimiter(cfg.RateLimit, cfg.RateBurst)
+		limiter.SetClock(cfg.Clock)
+		bridges = append(bridges, &httpBridge{
+			address:  cfg.HTTPAddress,
+			listener: listener,
+			limiter:  limiter,
+			origins:  splitList(cfg.HTTPOrigins),
+		})
+	}
+	if cfg.MPRISBus != "" {
+		bridges = append(bridges, &mprisBridge{bus: cfg.MPRISBus})
+	}
+	if cfg.InfluxTarget != "" {
+		bridges = append(bridges, &influxBridge{
+			sink:   influx.NewSink(cfg.InfluxTarget, cfg.InfluxToken, cfg.InfluxInterval),
+			target: cfg.InfluxTarget,
+		})
+	}
+	for _, name := range cfg.Webhooks() {
+		w, err := cfg.Webhook(name)
+		if err != nil {
+			return nil, err
+		}
+		bridges = append(bridges, &webhookBridge{w})
+	}
+	return bridges, nil
+}
+
+// webhookBridge sends a configured webhook.
+type webhookBridge struct {
+	webhook *onkyo.Webhook
+}
+
+func (b *webhookBridge) name() string {
+	return "webhook " + b.webhook.Name
+}
+
+func (b *webhookBridge) run(ctx context.Context, device *onkyo.Device) error {
+	return b.webhook.Run(ctx, device)
+}
+
+// doServe keeps a persistent connection to the device and runs the
+// configured bridges until SIGINT or SIGTERM is received.
+// SIGHUP reloads the command definitions.
+//
+// Under systemd, readiness, reloads and shutdown are reported with sd_notify
+// and the watchdog is notified while the daemon runs.
+func doServe(cfg *onkyo.Config) error {
+	bridges, err := configuredBridges(cfg)
+	if err != nil {
+		return err
+	}
+
+	cfg.AllowReconnect = true
+	device := onkyo.NewDevice(cfg)
+	device.OnConnected(func() {
+		log.Printf("Connected to %v:%v", device.Host, device.Port)
+	})
+	device.OnDisconnected(func() {
+		log.Printf("Disconnected from %v:%v", device.Host, device.Port)
+	})
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	device.StartContext(ctx)
+	defer device.Stop()
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+
+	var wait sync.WaitGroup
+	errs := make(chan error, 1)
+	for _, b := range bridges {
+		wait.Add(1)
+		go func(b bridge) {
+			defer wait.Done()
+			log.Printf("Start %v", b.name())
+			err := b.run(ctx, device)
+			if err != nil {
+				log.Printf("%v failed: %v", b.name(), err)
+				select {
+				case errs <- err:
+				default:
+				}
+				// a failed bridge shuts down the daemon
+				cancel()
+			}
+		}(b)
+	}
+
+	sdNotify("READY=1")
+	go sdWatchdog(ctx)
+
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-reload:
+			sdNotify("RELOADING=1")
+			err := device.Reload()
+			if err != nil {
+				log.Printf("Reload failed: %v", err)
+			}
+			sdNotify("READY=1")
+		}
+	}
+
+	log.Print("Shutting down")
+	sdNotify("STOPPING=1")
+	wait.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
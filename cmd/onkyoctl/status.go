@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+const (
+	// queryInterval limits the rate of queries for status --all.
+	queryInterval = 100 * time.Millisecond
+	// collectTime is the time to wait for responses after the last query.
+	collectTime = 3 * time.Second
+)
+
+// doStatusAll queries every command and prints a snapshot of all values,
+// sorted by name.
+// Commands that are not supported by the device do not respond
+// and are left out.
+func doStatusAll(device *onkyo.Device, out *output, timeout time.Duration) error {
+	err := device.WaitConnect(timeout)
+	if err != nil {
+		return err
+	}
+	out.heading("Status [%v]:", device.Host)
+
+	var lock sync.Mutex
+	values := make(map[string]*onkyo.ParsedMessage)
+	out.onMessage(func(m *onkyo.ParsedMessage) {
+		lock.Lock()
+		defer lock.Unlock()
+		values[m.Name] = m
+	})
+
+	for _, c := range onkyo.ListCommands(device.Commands()) {
+		if c.ParamType == onkyo.Binary {
+			continue
+		}
+		err := device.Query(c.Name)
+		if err != nil {
+			return err
+		}
+		time.Sleep(queryInterval)
+	}
+	time.Sleep(collectTime)
+
+	lock.Lock()
+	defer lock.Unlock()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out.print(values[name], ": ")
+	}
+	return nil
+}
+
+// doStatusEvery queries the given items at a fixed interval
+// until interrupted.
+func doStatusEvery(device *onkyo.Device, out *output, names []string, every time.Duration, changesOnly bool, timeout time.Duration) error {
+	err := device.WaitConnect(timeout)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names = defaultStatusNames
+	}
+
+	filter := newWatchFilter(names, nil, changesOnly)
+	out.onMessage(func(m *onkyo.ParsedMessage) {
+		if filter.accept(m.Name, m.Value) {
+			out.print(m, ": ")
+		}
+	})
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		for _, name := range names {
+			err := device.Query(name)
+			if errors.Is(err, onkyo.ErrUnknownCommand) {
+				return err
+			} else if err != nil {
+				log.Printf("Query %q failed: %v", name, err)
+			}
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Support for running under systemd, see examples/onkyoctl.service:
+// socket activation (sd_listen_fds) and readiness and watchdog
+// notifications (sd_notify), without linking libsystemd.
+
+// listenFdsStart is the first file descriptor passed by systemd.
+const listenFdsStart = 3
+
+// systemdListener returns the listening socket passed by systemd,
+// or nil if the process was not socket activated.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	// not passed on to child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if n > 1 {
+		return nil, fmt.Errorf("expected one socket from systemd, got %v", n)
+	}
+	f := os.NewFile(listenFdsStart, "systemd socket")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// sdNotify sends a state like "READY=1" to systemd.
+// It does nothing if NOTIFY_SOCKET is not set.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		// abstract namespace
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns the interval for "WATCHDOG=1" notifications,
+// half of WatchdogSec from the unit, or zero if the watchdog is disabled.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.Atoi(os.Getenv("WATCHDOG_USEC"))
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	pid, err := strconv.Atoi(os.Getenv("WATCHDOG_PID"))
+	if err == nil && pid != os.Getpid() {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// sdWatchdog notifies the systemd watchdog until ctx is done.
+func sdWatchdog(ctx context.Context) {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sdNotify("WATCHDOG=1")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+// dashboard is a live view of the device state in the terminal.
+//
+// The terminal is switched to cbreak mode with stty to read single keys
+// and redrawn with ANSI escape sequences whenever a value changes.
+type dashboard struct {
+	device *onkyo.Device
+	values map[string]string
+	status string
+	lock   sync.Mutex
+}
+
+// dashboard rows: label and command name
+var dashboardRows = [][2]string{
+	{"Power", "power"},
+	{"Volume", "volume"},
+	{"Mute", "mute"},
+	{"Input", "input"},
+	{"Mode", "listen-mode"},
+	{"Title", "title"},
+	{"Artist", "artist"},
+	{"Album", "album"},
+}
+
+const dashboardHelp = "+/- volume   m mute   i input   p power   o menu   h/j/k/l/enter/x navigate   q quit"
+
+// keys to navigate the on-screen menu of the receiver
+var osdKeys = map[byte]string{
+	'o':  "menu",
+	'h':  "left",
+	'j':  "down",
+	'k':  "up",
+	'l':  "right",
+	'\n': "enter",
+	'x':  "exit",
+}
+
+func doTUI(device *onkyo.Device) error {
+	info, err := os.Stdin.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return errors.New("tui requires a terminal")
+	}
+	restore, err := cbreak()
+	if err != nil {
+		return fmt.Errorf("failed to set up terminal: %v", err)
+	}
+	defer restore()
+
+	d := &dashboard{
+		device: device,
+		values: make(map[string]string),
+		status: "connecting",
+	}
+	device.OnRaw(nil)
+	device.OnMessage(d.update)
+	device.OnConnected(func() {
+		d.setStatus("connected")
+		d.queryAll()
+	})
+	device.OnDisconnected(func() {
+		d.setStatus("disconnected")
+	})
+	d.queryAll()
+	d.draw()
+
+	keys := make([]byte, 1)
+	for {
+		_, err := os.Stdin.Read(keys)
+		if err != nil {
+			return err
+		}
+		if keys[0] == 'q' || keys[0] == 3 { // 3: ctrl+c
+			fmt.Print("\033[2J\033[H")
+			return nil
+		}
+		go d.handleKey(keys[0])
+	}
+}
+
+// cbreak switches the terminal to read single keys without echo.
+func cbreak() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	_, err = stty("cbreak", "-echo")
+	if err != nil {
+		return nil, err
+	}
+	fmt.Print("\033[?25l") // hide cursor
+	return func() {
+		fmt.Print("\033[?25h")
+		stty(strings.TrimSpace(saved))
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+func (d *dashboard) handleKey(key byte) {
+	var err error
+	switch key {
+	case '+':
+		err = d.device.SendCommand("volume", "up")
+	case '-':
+		err = d.device.SendCommand("volume", "down")
+	case 'm':
+		_, err = d.device.Toggle("mute")
+	case 'p':
+		_, err = d.device.Toggle("power")
+	case 'i':
+		err = d.nextInput()
+	default:
+		osd, ok := osdKeys[key]
+		if !ok {
+			return
+		}
+		err = d.device.SendCommand("osd", osd)
+	}
+	if err != nil {
+		d.setStatus(err.Error())
+	}
+}
+
+// nextInput selects the input that follows the current one.
+func (d *dashboard) nextInput() error {
+	d.lock.Lock()
+	current := d.values["input"]
+	d.lock.Unlock()
+
+	for _, c := range onkyo.ListCommands(d.device.Commands()) {
+		if c.Name != "input" {
+			continue
+		}
+		values := c.Values()
+		if len(values) == 0 {
+			break
+		}
+		next := values[0]
+		for i, v := range values {
+			if v == current && i+1 < len(values) {
+				next = values[i+1]
+			}
+		}
+		return d.device.SendCommand("input", next)
+	}
+	return errors.New("no input command")
+}
+
+func (d *dashboard) queryAll() {
+	for _, row := range dashboardRows {
+		d.device.Query(row[1])
+	}
+}
+
+func (d *dashboard) update(name, value string) {
+	d.lock.Lock()
+	d.values[name] = value
+	d.lock.Unlock()
+	d.draw()
+}
+
+func (d *dashboard) setStatus(status string) {
+	d.lock.Lock()
+	d.status = status
+	d.lock.Unlock()
+	d.draw()
+}
+
+func (d *dashboard) draw() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var b strings.Builder
+	b.WriteString("\033[2J\033[H") // clear screen
+	fmt.Fprintf(&b, "onkyoctl  %v:%v  [%v]\r\n\r\n", d.device.Host, d.device.Port, d.status)
+	for _, row := range dashboardRows {
+		value, ok := d.values[row[1]]
+		if !ok {
+			continue
+		}
+		if row[1] == "volume" {
+			value = d.volumeBar(value)
+		}
+		fmt.Fprintf(&b, "  %-8v %v\r\n", row[0]+":", value)
+	}
+	fmt.Fprintf(&b, "\r\n%v\r\n", dashboardHelp)
+	fmt.Print(b.String())
+}
+
+// volumeBar draws the volume as a bar, relative to the maximum volume.
+func (d *dashboard) volumeBar(value string) string {
+	volume, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return value
+	}
+	upper := 100.0
+	for _, c := range onkyo.ListCommands(d.device.Commands()) {
+		if c.Name == "volume" && c.Upper > 0 {
+			upper = float64(c.Upper)
+		}
+	}
+
+	const width = 30
+	filled := int(volume / upper * width)
+	if filled > width {
+		filled = width
+	}
+	return fmt.Sprintf("[%v%v] %v", strings.Repeat("#", filled), strings.Repeat("-", width-filled), value)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+)
+
+// watchFilter decides which messages are shown by the watch command.
+type watchFilter struct {
+	only        map[string]bool
+	exclude     map[string]bool
+	sinceChange bool
+	last        map[string]string
+}
+
+// newWatchFilter creates a filter from the command line options.
+// only and exclude may contain comma separated lists.
+func newWatchFilter(only, exclude []string, sinceChange bool) *watchFilter {
+	return &watchFilter{
+		only:        nameSet(only),
+		exclude:     nameSet(exclude),
+		sinceChange: sinceChange,
+		last:        make(map[string]string),
+	}
+}
+
+func nameSet(values []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				set[name] = true
+			}
+		}
+	}
+	return set
+}
+
+// accept returns true if the message should be shown.
+func (w *watchFilter) accept(name, value string) bool {
+	if len(w.only) > 0 && !w.only[name] {
+		return false
+	}
+	if w.exclude[name] {
+		return false
+	}
+	if w.sinceChange {
+		last, ok := w.last[name]
+		if ok && last == value {
+			return false
+		}
+		w.last[name] = value
+	}
+	return true
+}
@@ -1,10 +1,14 @@
 package onkyoctl
 
 import (
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ISCPGroup is the 3-digit ISCP command group, e.g. "PWR" or "MVL".
@@ -14,6 +18,13 @@ type ISCPGroup string
 // or MVLUP (master volume up).
 type ISCPCommand string
 
+var (
+	// ErrUnknownCommand is returned for names that are not in the CommandSet.
+	ErrUnknownCommand = errors.New("unknown command")
+	// ErrInvalidParam is returned for parameters a command does not accept.
+	ErrInvalidParam = errors.New("invalid parameter")
+)
+
 // ParamType is the kind of parameter expcted by a Command.
 type ParamType string
 
@@ -30,6 +41,28 @@ const (
 	IntRange ParamType = "intRange"
 	// IntRangeEnum accepts integers and additional values from a list.
 	IntRangeEnum ParamType = "intRangeEnum"
+	// Binary commands carry hex encoded binary data, e.g. album art.
+	// An optional prefix (see Command.Prefix) precedes the data.
+	Binary ParamType = "binary"
+	// Text commands carry a free text, e.g. the title of the current track.
+	Text ParamType = "text"
+	// Frequency commands accept a tuner frequency like "101.1 MHz" or
+	// "576 kHz" and additional values from a list.
+	Frequency ParamType = "frequency"
+	// SignedRange accepts positive and negative numbers with min and max
+	// values, e.g. a level from -12 to +12 dB, and additional values from
+	// a list. They are sent with a sign, e.g. "+A" or "-4".
+	SignedRange ParamType = "signedRange"
+	// Milliseconds accepts a delay in ms from Lower to Upper, e.g. "120ms",
+	// and additional values from a list. It is sent as four decimal digits.
+	Milliseconds ParamType = "milliseconds"
+	// EnumIndex accepts a value from a list followed by a number,
+	// e.g. "spotify 1" for a network service and the account to use.
+	// The number is optional and defaults to Lower.
+	EnumIndex ParamType = "enumIndex"
+	// Tone commands combine bass and treble with a signed range each,
+	// e.g. "bass +2 treble -4" or "bass up".
+	Tone ParamType = "tone"
 
 	queryParam = "QSTN"
 )
@@ -44,14 +77,35 @@ func SplitISCP(command ISCPCommand) (ISCPGroup, string) {
 }
 
 // Command is the "friendly" wrapper around an ISCP command group.
+//
+// Category is used to group related commands, e.g. "audio" or "network".
+//
+// ResponseTimeout is the time to wait for the response to a command
+// or query, e.g. "5s". If zero, a default timeout is used.
+//
+// Aliases maps alternative names to parameter values, e.g. "dolby-surround"
+// to "plii-movie" for models that use a different name for a mode.
+//
+// Step is the difference between valid values for signed ranges and
+// milliseconds, e.g. 2 for receivers that change the tone in 2 dB steps.
+//
+// Priority decides whether the command is sent before other waiting
+// commands ("high") or after them ("low"). Queries are sent with low
+// priority unless the command has a priority.
 type Command struct {
-	Name      string
-	Group     ISCPGroup
-	ParamType ParamType
-	Lookup    map[string]string
-	Lower     int
-	Upper     int
-	Scale     int
+	Name            string
+	Group           ISCPGroup
+	Category        string
+	ParamType       ParamType
+	Lookup          map[string]string
+	Aliases         map[string]string
+	Lower           int
+	Upper           int
+	Scale           int
+	Step            int
+	Prefix          int
+	ResponseTimeout time.Duration
+	Priority        Priority
 }
 
 // CreateQuery generates the "xxxQSTN" command for this Command.
@@ -71,6 +125,13 @@ func (c *Command) CreateCommand(param interface{}) (ISCPCommand, error) {
 
 // formatParam converts a go value to a string that is used as part of the ISCP Command.
 func (c *Command) formatParam(raw interface{}) (string, error) {
+	if s, ok := raw.(string); ok {
+		alias, ok := c.Aliases[strings.ToLower(s)]
+		if ok {
+			raw = alias
+		}
+	}
+
 	switch c.ParamType {
 	case OnOff:
 		return formatOnOff(raw)
@@ -84,6 +145,20 @@ func (c *Command) formatParam(raw interface{}) (string, error) {
 		return formatIntRange(c.Lower, c.Upper, c.Scale, raw)
 	case IntRangeEnum:
 		return formatIntRangeEnum(c.Lower, c.Upper, c.Scale, c.Lookup, raw)
+	case Binary:
+		return formatBinary(raw)
+	case Text:
+		return formatText(raw)
+	case Frequency:
+		return formatFrequency(c.Lookup, raw)
+	case SignedRange:
+		return formatSignedRangeEnum(c.Lower, c.Upper, c.Scale, c.Step, c.Lookup, raw)
+	case Tone:
+		return formatTone(c.Lower, c.Upper, c.Step, raw)
+	case Milliseconds:
+		return formatMilliseconds(c.Lower, c.Upper, c.Step, c.Lookup, raw)
+	case EnumIndex:
+		return formatEnumIndex(c.Lower, c.Upper, c.Lookup, c.Aliases, raw)
 	}
 
 	return "", fmt.Errorf("unsupported param type %q", c.ParamType)
@@ -104,10 +179,70 @@ func (c *Command) ParseParam(raw string) (string, error) {
 		return parseIntRange(c.Lower, c.Upper, c.Scale, raw)
 	case IntRangeEnum:
 		return parseIntRangeEnum(c.Lower, c.Upper, c.Scale, c.Lookup, raw)
+	case Frequency:
+		return parseFrequency(c.Lookup, raw)
+	case SignedRange:
+		result, err := parseSignedRange(c.Lower, c.Upper, c.Scale, raw)
+		if err == nil {
+			return result, err
+		}
+		return parseEnum(c.Lookup, raw)
+	case Tone:
+		return parseTone(c.Lower, c.Upper, raw)
+	case Milliseconds:
+		return parseMilliseconds(c.Lower, c.Upper, c.Lookup, raw)
+	case EnumIndex:
+		return parseEnumIndex(c.Lower, c.Upper, c.Lookup, raw)
+	case Binary, Text:
+		// keep the raw payload, use ParseBinary to decode binary data
+		return raw, nil
 	}
 	return "", fmt.Errorf("unsupported param type %q", c.ParamType)
 }
 
+// ParseBinary splits the ISCP param value for a binary command
+// into the prefix and the decoded binary data.
+func (c *Command) ParseBinary(raw string) (string, []byte, error) {
+	if c.ParamType != Binary {
+		return "", nil, fmt.Errorf("not a binary command %q", c.Name)
+	}
+	if len(raw) < c.Prefix {
+		return "", nil, fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+
+	data, err := hex.DecodeString(raw[c.Prefix:])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid binary data: %v", err)
+	}
+	return raw[:c.Prefix], data, nil
+}
+
+// Values returns the parameters accepted by the command, e.g. "on" and "off".
+// Numeric ranges, binary data and text are not included.
+func (c *Command) Values() []string {
+	values := make([]string, 0)
+	switch c.ParamType {
+	case OnOff:
+		values = append(values, "on", "off")
+	case OnOffToggle:
+		values = append(values, "on", "off", "toggle")
+	case Enum, EnumToggle, IntRangeEnum, Frequency, SignedRange, Milliseconds, EnumIndex:
+		// several ISCP values may map to the same friendly value
+		seen := make(map[string]bool)
+		for _, v := range c.Lookup {
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+		sort.Strings(values)
+		if c.ParamType == EnumToggle {
+			values = append(values, "toggle")
+		}
+	}
+	return values
+}
+
 // formatOnOff converts an onOff type parameter.
 func formatOnOff(raw interface{}) (string, error) {
 	var result string
@@ -155,7 +290,7 @@ func formatOnOff(raw interface{}) (string, error) {
 	}
 
 	if result == "" {
-		return "", fmt.Errorf("invalid parameter %q", raw)
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
 	}
 	return result, nil
 }
@@ -167,7 +302,7 @@ func parseOnOff(raw string) (string, error) {
 	case "01":
 		return "on", nil
 	default:
-		return "", fmt.Errorf("invalid parameter %q", raw)
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
 	}
 }
 
@@ -190,12 +325,19 @@ func parseOnOffToggle(raw string) (string, error) {
 func formatEnum(lookup map[string]string, raw interface{}) (string, error) {
 	s := fmt.Sprintf("%v", raw)
 	s = strings.ToLower(s)
-	for key, value := range lookup {
-		if value == s {
+	// several ISCP values may map to the same friendly value,
+	// always use the same one
+	keys := make([]string, 0, len(lookup))
+	for key := range lookup {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if lookup[key] == s {
 			return key, nil
 		}
 	}
-	return "", fmt.Errorf("invalid parameter %q", raw)
+	return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
 }
 
 func parseEnum(lookup map[string]string, raw string) (string, error) {
@@ -203,7 +345,7 @@ func parseEnum(lookup map[string]string, raw string) (string, error) {
 	if ok {
 		return value, nil
 	}
-	return "", fmt.Errorf("invalid parameter %q", raw)
+	return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
 }
 
 func formatEnumToggle(lookup map[string]string, raw interface{}) (string, error) {
@@ -223,37 +365,14 @@ func parseEnumToggle(lookup map[string]string, raw string) (string, error) {
 }
 
 func formatIntRange(lower, upper, scale int, raw interface{}) (string, error) {
-	// conversion
-	var numeric float64
-	switch val := raw.(type) {
-	case int,
-		int8,
-		int16,
-		int32,
-		int64,
-		uint,
-		uint8,
-		uint16,
-		uint32,
-		uint64,
-		float32:
-		numeric, _ = val.(float64)
-	case float64:
-		numeric = val
-
-	case string:
-		var convErr error
-		numeric, convErr = strconv.ParseFloat(val, 64)
-		if convErr != nil {
-			return "", convErr
-		}
-	default:
-		return "", fmt.Errorf("invalid parameter %q", raw)
+	numeric, exact, err := numericParam(raw)
+	if err != nil {
+		return "", err
 	}
 
 	// bounds check
 	if numeric < float64(lower) || numeric > float64(upper) {
-		return "", fmt.Errorf("invalid parameter %q", raw)
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
 	}
 
 	if scale == 0 {
@@ -261,6 +380,11 @@ func formatIntRange(lower, upper, scale int, raw interface{}) (string, error) {
 	}
 	scaled := numeric * float64(scale)
 	rounded := math.Round(scaled)
+	// as for signed ranges, numbers must match a step,
+	// e.g. 11.3 with a scale of 2 is invalid
+	if exact && math.Abs(scaled-rounded) > 1e-9 {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
 
 	hex := fmt.Sprintf("%X", int(rounded))
 	if len(hex)%2 != 0 {
@@ -270,6 +394,51 @@ func formatIntRange(lower, upper, scale int, raw interface{}) (string, error) {
 	return hex, nil
 }
 
+// numericParam converts a numeric parameter to float.
+// Parameters given as strings are not exact and may be rounded.
+func numericParam(raw interface{}) (float64, bool, error) {
+	var numeric float64
+	exact := true
+	switch val := raw.(type) {
+	case int:
+		numeric = float64(val)
+	case int8:
+		numeric = float64(val)
+	case int16:
+		numeric = float64(val)
+	case int32:
+		numeric = float64(val)
+	case int64:
+		numeric = float64(val)
+	case uint:
+		numeric = float64(val)
+	case uint8:
+		numeric = float64(val)
+	case uint16:
+		numeric = float64(val)
+	case uint32:
+		numeric = float64(val)
+	case uint64:
+		numeric = float64(val)
+	case float32:
+		numeric = float64(val)
+	case float64:
+		numeric = val
+
+	case string:
+		// strings usually come from user input, round to the nearest step
+		exact = false
+		var convErr error
+		numeric, convErr = strconv.ParseFloat(val, 64)
+		if convErr != nil {
+			return 0, false, fmt.Errorf("%w %q", ErrInvalidParam, raw)
+		}
+	default:
+		return 0, false, fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+	return numeric, exact, nil
+}
+
 func parseIntRange(lower, upper, scale int, raw string) (string, error) {
 	// expect a hex-representation of an integer value
 	numeric, err := strconv.ParseInt(raw, 16, 64)
@@ -284,7 +453,7 @@ func parseIntRange(lower, upper, scale int, raw string) (string, error) {
 
 	// bounds check
 	if downscaled < float64(lower) || downscaled > float64(upper) {
-		return "", fmt.Errorf("invalid parameter %q", raw)
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
 	}
 
 	return fmt.Sprintf("%v", downscaled), nil
@@ -306,6 +475,327 @@ func parseIntRangeEnum(lower, upper, scale int, lookup map[string]string, raw st
 	return parseEnum(lookup, raw)
 }
 
+func formatBinary(raw interface{}) (string, error) {
+	switch val := raw.(type) {
+	case []byte:
+		return strings.ToUpper(hex.EncodeToString(val)), nil
+	case string:
+		// strings must already be hex encoded
+		_, err := hex.DecodeString(val)
+		if err != nil {
+			return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+		}
+		return strings.ToUpper(val), nil
+	}
+	return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+}
+
+func formatText(raw interface{}) (string, error) {
+	val, ok := raw.(string)
+	if !ok || strings.ContainsAny(val, "\r\n\x1a") {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+	return val, nil
+}
+
+func formatSignedRangeEnum(lower, upper, scale, step int, lookup map[string]string, raw interface{}) (string, error) {
+	result, err := formatSignedRange(lower, upper, scale, step, raw)
+	if err == nil {
+		return result, err
+	}
+	return formatEnum(lookup, raw)
+}
+
+// formatSignedRange converts a number to the signed hex format,
+// e.g. 10 to "+A", -4 to "-4" and 0 to "00".
+func formatSignedRange(lower, upper, scale, step int, raw interface{}) (string, error) {
+	numeric, exact, err := numericParam(raw)
+	if err != nil {
+		return "", err
+	}
+	if numeric < float64(lower) || numeric > float64(upper) {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+
+	if step > 1 {
+		steps := numeric / float64(step)
+		rounded := math.Round(steps)
+		if exact && math.Abs(steps-rounded) > 1e-9 {
+			return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+		}
+		numeric = rounded * float64(step)
+	}
+
+	if scale == 0 {
+		scale = 1
+	}
+	scaled := numeric * float64(scale)
+	n := int(math.Round(scaled))
+	if exact && math.Abs(scaled-float64(n)) > 1e-9 {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+
+	switch {
+	case n == 0:
+		return "00", nil
+	case n > 0:
+		return fmt.Sprintf("+%X", n), nil
+	default:
+		return fmt.Sprintf("-%X", -n), nil
+	}
+}
+
+func parseSignedRange(lower, upper, scale int, raw string) (string, error) {
+	// expect a signed hex value, e.g. "+A" or "-4"
+	numeric, err := strconv.ParseInt(raw, 16, 64)
+	if err != nil {
+		return "", err
+	}
+
+	if scale == 0 {
+		scale = 1
+	}
+	downscaled := float64(numeric) / float64(scale)
+	if downscaled < float64(lower) || downscaled > float64(upper) {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+	return fmt.Sprintf("%v", downscaled), nil
+}
+
+// formatMilliseconds converts a delay like 120, "120ms" or a time.Duration
+// to four decimal digits, e.g. "0120".
+func formatMilliseconds(lower, upper, step int, lookup map[string]string, raw interface{}) (string, error) {
+	var ms int
+	switch val := raw.(type) {
+	case time.Duration:
+		ms = int(val / time.Millisecond)
+		if val%time.Millisecond != 0 {
+			return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+		}
+	case string:
+		s := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(val)), "ms")
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return formatEnum(lookup, raw)
+		}
+		ms = n
+	default:
+		numeric, _, err := numericParam(raw)
+		if err != nil || numeric != math.Trunc(numeric) {
+			return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+		}
+		ms = int(numeric)
+	}
+
+	if ms < lower || ms > upper || (step > 1 && ms%step != 0) {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+	return fmt.Sprintf("%04d", ms), nil
+}
+
+func parseMilliseconds(lower, upper int, lookup map[string]string, raw string) (string, error) {
+	ms, err := strconv.Atoi(raw)
+	if err != nil {
+		return parseEnum(lookup, raw)
+	}
+	if ms < lower || ms > upper {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+	return fmt.Sprintf("%dms", ms), nil
+}
+
+// formatEnumIndex converts e.g. "spotify 1" or "spotify:1" to "0A1".
+func formatEnumIndex(lower, upper int, lookup, aliases map[string]string, raw interface{}) (string, error) {
+	s, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+	fields := strings.Fields(strings.Replace(s, ":", " ", 1))
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+
+	// aliases for the whole parameter are applied by formatParam
+	value := fields[0]
+	alias, ok := aliases[strings.ToLower(value)]
+	if ok {
+		value = alias
+	}
+	key, err := formatEnum(lookup, value)
+	if err != nil {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+
+	index := lower
+	if len(fields) == 2 {
+		index, err = strconv.Atoi(fields[1])
+		if err != nil || index < lower || index > upper {
+			return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+		}
+	}
+	return key + strconv.Itoa(index), nil
+}
+
+// parseEnumIndex converts e.g. "0A1" to "spotify 1".
+// The index is left out if it is Lower.
+func parseEnumIndex(lower, upper int, lookup map[string]string, raw string) (string, error) {
+	for key, value := range lookup {
+		if !strings.HasPrefix(raw, key) {
+			continue
+		}
+		index, err := strconv.Atoi(raw[len(key):])
+		if err != nil || index < lower || index > upper {
+			continue
+		}
+		if index == lower {
+			return value, nil
+		}
+		return fmt.Sprintf("%v %d", value, index), nil
+	}
+	return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+}
+
+// toneParts are the parts of a tone command.
+var toneParts = map[string]string{
+	"bass":   "B",
+	"treble": "T",
+}
+
+// formatTone converts e.g. "bass +2 treble -4" to "B+2T-4"
+// and "bass up" to "BUP".
+func formatTone(lower, upper, step int, raw interface{}) (string, error) {
+	s, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+	s = strings.NewReplacer(",", " ", ":", " ").Replace(strings.ToLower(s))
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(fields); i += 2 {
+		part, ok := toneParts[fields[i]]
+		if !ok {
+			return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+		}
+		b.WriteString(part)
+		switch fields[i+1] {
+		case "up", "down":
+			b.WriteString(strings.ToUpper(fields[i+1]))
+		default:
+			value, err := formatSignedRange(lower, upper, 1, step, fields[i+1])
+			if err != nil {
+				return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+			}
+			b.WriteString(value)
+		}
+	}
+	return b.String(), nil
+}
+
+// parseTone converts e.g. "B+2T-4" to "bass 2 treble -4".
+// Each part has a fixed length of three characters.
+func parseTone(lower, upper int, raw string) (string, error) {
+	if raw == "" || len(raw)%3 != 0 {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+
+	parts := make([]string, 0, 4)
+	for i := 0; i < len(raw); i += 3 {
+		name := ""
+		for n, part := range toneParts {
+			if part == raw[i:i+1] {
+				name = n
+			}
+		}
+		if name == "" {
+			return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+		}
+		value, err := parseSignedRange(lower, upper, 1, raw[i+1:i+3])
+		if err != nil {
+			return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+		}
+		parts = append(parts, name, value)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// Tuner frequencies are sent as five decimal digits,
+// FM in steps of 10 kHz (10110 is 101.1 MHz) and AM in kHz (00576).
+const (
+	fmLower = 76.0
+	fmUpper = 108.0
+	amLower = 522
+	amUpper = 1710
+)
+
+func formatFrequency(lookup map[string]string, raw interface{}) (string, error) {
+	var value float64
+	unit := ""
+	switch val := raw.(type) {
+	case int:
+		value = float64(val)
+	case float32:
+		value = float64(val)
+	case float64:
+		value = val
+	case string:
+		s := strings.ToLower(strings.TrimSpace(val))
+		for _, u := range []string{"mhz", "khz"} {
+			if strings.HasSuffix(s, u) {
+				unit = u
+				s = strings.TrimSpace(strings.TrimSuffix(s, u))
+				break
+			}
+		}
+		var convErr error
+		value, convErr = strconv.ParseFloat(s, 64)
+		if convErr != nil {
+			return formatEnum(lookup, raw)
+		}
+	default:
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+
+	// without a unit, small values are MHz (FM) and large values kHz (AM)
+	if unit == "" {
+		unit = "khz"
+		if value <= fmUpper {
+			unit = "mhz"
+		}
+	}
+
+	if unit == "mhz" {
+		if value < fmLower || value > fmUpper {
+			return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+		}
+		return fmt.Sprintf("%05d", int(math.Round(value*100))), nil
+	}
+
+	if value < amLower || value > amUpper || value != math.Trunc(value) {
+		return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+	}
+	return fmt.Sprintf("%05d", int(value)), nil
+}
+
+func parseFrequency(lookup map[string]string, raw string) (string, error) {
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return parseEnum(lookup, raw)
+	}
+
+	if n >= amLower && n <= amUpper {
+		return fmt.Sprintf("%d kHz", n), nil
+	}
+	mhz := float64(n) / 100
+	if mhz >= fmLower && mhz <= fmUpper {
+		return strconv.FormatFloat(mhz, 'f', -1, 64) + " MHz", nil
+	}
+	return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
+}
+
 func formatToggle(raw interface{}) (string, error) {
 	s, ok := raw.(string)
 	if ok {
@@ -314,14 +804,14 @@ func formatToggle(raw interface{}) (string, error) {
 			return "TG", nil
 		}
 	}
-	return "", fmt.Errorf("invalid parameter %q", raw)
+	return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
 }
 
 func parseToggle(raw string) (string, error) {
 	if raw == "TG" {
 		return "toggle", nil
 	}
-	return "", fmt.Errorf("invalid parameter %q", raw)
+	return "", fmt.Errorf("%w %q", ErrInvalidParam, raw)
 }
 
 // A CommandSet represents a set of known/supported commands
@@ -379,10 +869,85 @@ func (b *basicCommandSet) ReadCommand(command ISCPCommand) (string, string, erro
 	return c.Name, value, nil
 }
 
+// Commands returns all command definitions, sorted by name.
+func (b *basicCommandSet) Commands() []Command {
+	commands := make([]Command, 0, len(b.byName))
+	for _, c := range b.byName {
+		commands = append(commands, c)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name < commands[j].Name
+	})
+	return commands
+}
+
+// commandLister is implemented by command sets that can list
+// their command definitions.
+type commandLister interface {
+	Commands() []Command
+}
+
+// ListCommands returns the definitions of all commands in the given set,
+// sorted by name. It returns nil if the set cannot list its commands.
+func ListCommands(commands CommandSet) []Command {
+	lister, ok := commands.(commandLister)
+	if !ok {
+		return nil
+	}
+	return lister.Commands()
+}
+
+// RenameValues returns a copy of the command set where values of the named
+// command are renamed, e.g. labels maps "game" to "ps5" to match the label
+// on the receiver. The old names still work as aliases.
+// The command set is returned as it is if it cannot list its commands.
+func RenameValues(commands CommandSet, name string, labels map[string]string) CommandSet {
+	list := ListCommands(commands)
+	if list == nil || len(labels) == 0 {
+		return commands
+	}
+
+	for i, c := range list {
+		if c.Name != name {
+			continue
+		}
+		lookup := make(map[string]string, len(c.Lookup))
+		aliases := make(map[string]string, len(c.Aliases)+len(labels))
+		for key, value := range c.Lookup {
+			label, ok := labels[value]
+			if ok {
+				label = strings.ToLower(label)
+				aliases[value] = label
+				value = label
+			}
+			lookup[key] = value
+		}
+		for alias, value := range c.Aliases {
+			label, ok := labels[value]
+			if ok {
+				value = strings.ToLower(label)
+			}
+			aliases[alias] = value
+		}
+		c.Lookup = lookup
+		c.Aliases = aliases
+		list[i] = c
+	}
+	return NewBasicCommandSet(list)
+}
+
+func (b *basicCommandSet) ForGroup(group ISCPGroup) (Command, error) {
+	c, ok := b.byGroup[group]
+	if !ok {
+		return Command{}, fmt.Errorf("unknown ISCP group %q", group)
+	}
+	return c, nil
+}
+
 func (b *basicCommandSet) ForName(name string) (Command, error) {
 	c, ok := b.byName[name]
 	if !ok {
-		return Command{}, fmt.Errorf("unknown command %q", name)
+		return Command{}, fmt.Errorf("%w %q", ErrUnknownCommand, name)
 	}
 	return c, nil
 }
@@ -1,7 +1,9 @@
 package onkyoctl
 
 import (
+	"errors"
 	"testing"
+	"time"
 )
 
 func TestISCPSplit(t *testing.T) {
@@ -534,3 +536,369 @@ func TestBasicQuery(t *testing.T) {
 	_, err = cs.CreateQuery("unknown")
 	assertErr(t, err)
 }
+
+func TestParseBinary(t *testing.T) {
+	c := Command{
+		Name:      "jacket-art",
+		Group:     "NJA",
+		ParamType: "binary",
+		Prefix:    2,
+	}
+
+	// raw value is preserved
+	value, err := c.ParseParam("10FFD8FF")
+	assertNoErr(t, err)
+	assertEqual(t, value, "10FFD8FF")
+
+	prefix, data, err := c.ParseBinary("10FFD8FF")
+	assertNoErr(t, err)
+	assertEqual(t, prefix, "10")
+	assertEqual(t, data, []byte{0xFF, 0xD8, 0xFF})
+
+	_, _, err = c.ParseBinary("1")
+	assertErr(t, err)
+	_, _, err = c.ParseBinary("10XYZ")
+	assertErr(t, err)
+
+	actual, err := c.CreateCommand([]byte{0x01, 0xAB})
+	assertNoErr(t, err)
+	assertEqual(t, actual, ISCPCommand("NJA01AB"))
+
+	actual, err = c.CreateCommand("01ab")
+	assertNoErr(t, err)
+	assertEqual(t, actual, ISCPCommand("NJA01AB"))
+
+	_, err = c.CreateCommand("01XY")
+	assertEqual(t, errors.Is(err, ErrInvalidParam), true)
+	_, err = c.CreateCommand("1")
+	assertEqual(t, errors.Is(err, ErrInvalidParam), true)
+
+	c.ParamType = "onOff"
+	_, _, err = c.ParseBinary("10FFD8FF")
+	assertErr(t, err)
+}
+
+func TestText(t *testing.T) {
+	c := Command{
+		Name:      "title",
+		Group:     "NTI",
+		ParamType: "text",
+	}
+
+	value, err := c.ParseParam("Smells Like Teen Spirit")
+	assertNoErr(t, err)
+	assertEqual(t, value, "Smells Like Teen Spirit")
+
+	actual, err := c.CreateCommand("Nevermind")
+	assertNoErr(t, err)
+	assertEqual(t, actual, ISCPCommand("NTINevermind"))
+
+	_, err = c.CreateCommand(12)
+	assertErr(t, err)
+	_, err = c.CreateCommand("two\r\nlines")
+	assertErr(t, err)
+}
+
+func TestListCommands(t *testing.T) {
+	commands := ListCommands(NewBasicCommandSet([]Command{
+		{Name: "power", Group: "PWR", ParamType: OnOff},
+		{Name: "input", Group: "SLI", ParamType: EnumToggle, Lookup: map[string]string{"01": "cbl", "00": "dvr", "02": "dvr"}},
+		{Name: "volume", Group: "MVL", ParamType: IntRange, Upper: 100},
+	}))
+	assertEqual(t, len(commands), 3)
+	assertEqual(t, commands[0].Name, "input")
+	assertEqual(t, commands[0].Category, "")
+	assertEqual(t, commands[0].Values(), []string{"cbl", "dvr", "toggle"})
+	assertEqual(t, commands[1].Values(), []string{"on", "off"})
+	assertEqual(t, commands[2].Values(), []string{})
+}
+
+func TestFrequency(t *testing.T) {
+	c := Command{
+		Name:      "tuning",
+		Group:     "TUN",
+		ParamType: Frequency,
+		Lookup:    map[string]string{"UP": "up", "DOWN": "down"},
+	}
+
+	valid := map[interface{}]ISCPCommand{
+		"101.1 MHz": "TUN10110",
+		"87.5mhz":   "TUN08750",
+		"101.1":     "TUN10110",
+		101.1:       "TUN10110",
+		"576 kHz":   "TUN00576",
+		"1710":      "TUN01710",
+		576:         "TUN00576",
+		"up":        "TUNUP",
+	}
+	for raw, expected := range valid {
+		actual, err := c.CreateCommand(raw)
+		assertNoErr(t, err)
+		assertEqual(t, actual, expected)
+	}
+
+	invalid := []interface{}{"120 MHz", "50 kHz", "576.5 kHz", "abc", true}
+	for _, raw := range invalid {
+		_, err := c.CreateCommand(raw)
+		assertErr(t, err)
+	}
+
+	parsed := map[string]string{
+		"10110": "101.1 MHz",
+		"08750": "87.5 MHz",
+		"00576": "576 kHz",
+		"UP":    "up",
+	}
+	for raw, expected := range parsed {
+		actual, err := c.ParseParam(raw)
+		assertNoErr(t, err)
+		assertEqual(t, actual, expected)
+	}
+	_, err := c.ParseParam("00010")
+	assertErr(t, err)
+}
+
+func TestAliases(t *testing.T) {
+	c := Command{
+		Name:      "listen-mode",
+		Group:     "LMD",
+		ParamType: Enum,
+		Lookup:    map[string]string{"00": "stereo", "STEREO": "stereo", "80": "plii-movie"},
+		Aliases:   map[string]string{"dolby-surround": "plii-movie"},
+	}
+
+	actual, err := c.CreateCommand("Dolby-Surround")
+	assertNoErr(t, err)
+	assertEqual(t, actual, ISCPCommand("LMD80"))
+
+	// the first of several ISCP values is used
+	for i := 0; i < 10; i++ {
+		actual, err = c.CreateCommand("stereo")
+		assertNoErr(t, err)
+		assertEqual(t, actual, ISCPCommand("LMD00"))
+	}
+
+	// aliases are not reported as values
+	assertEqual(t, c.Values(), []string{"plii-movie", "stereo"})
+}
+
+func TestListenModes(t *testing.T) {
+	cs := BasicCommands()
+
+	cmd, err := cs.CreateCommand("listen-mode", "all-ch-stereo")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("LMD0C"))
+
+	cmd, err = cs.CreateCommand("listen-mode", "movie")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("LMDMOVIE"))
+
+	cmd, err = cs.CreateCommand("listen-mode", "game-rpg")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("LMD03"))
+
+	name, value, err := cs.ReadCommand("LMDFF")
+	assertNoErr(t, err)
+	assertEqual(t, name, "listen-mode")
+	assertEqual(t, value, "auto-surround")
+}
+
+func TestRenameValues(t *testing.T) {
+	cs := RenameValues(BasicCommands(), "input", map[string]string{
+		"game":    "PS5",
+		"cbl-sat": "apple tv",
+	})
+
+	cmd, err := cs.CreateCommand("input", "ps5")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SLI02"))
+
+	// the old name still works
+	cmd, err = cs.CreateCommand("input", "game")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SLI02"))
+
+	_, value, err := cs.ReadCommand("SLI01")
+	assertNoErr(t, err)
+	assertEqual(t, value, "apple tv")
+
+	// other commands and the original set are not changed
+	_, value, err = BasicCommands().ReadCommand("SLI02")
+	assertNoErr(t, err)
+	assertEqual(t, value, "game")
+	_, value, err = cs.ReadCommand("PWR01")
+	assertNoErr(t, err)
+	assertEqual(t, value, "on")
+}
+
+func TestSignedRange(t *testing.T) {
+	c := Command{
+		Name:      "subwoofer-level",
+		Group:     "SWL",
+		ParamType: SignedRange,
+		Lower:     -15,
+		Upper:     12,
+		Lookup:    map[string]string{"UP": "up", "DOWN": "down"},
+	}
+
+	valid := map[interface{}]ISCPCommand{
+		10:     "SWL+A",
+		-4:     "SWL-4",
+		0:      "SWL00",
+		"+2":   "SWL+2",
+		"-15":  "SWL-F",
+		"down": "SWLDOWN",
+	}
+	for raw, expected := range valid {
+		actual, err := c.CreateCommand(raw)
+		assertNoErr(t, err)
+		assertEqual(t, actual, expected)
+	}
+	_, err := c.CreateCommand(13)
+	assertErr(t, err)
+
+	parsed := map[string]string{"+A": "10", "-F": "-15", "00": "0", "UP": "up"}
+	for raw, expected := range parsed {
+		actual, err := c.ParseParam(raw)
+		assertNoErr(t, err)
+		assertEqual(t, actual, expected)
+	}
+	_, err = c.ParseParam("+D")
+	assertErr(t, err)
+
+	// 2 dB steps
+	c.Step = 2
+	actual, err := c.CreateCommand("3.5")
+	assertNoErr(t, err)
+	assertEqual(t, actual, ISCPCommand("SWL+4"))
+	_, err = c.CreateCommand(3)
+	assertErr(t, err)
+
+	// half steps
+	c.Step = 0
+	c.Scale = 2
+	actual, err = c.CreateCommand(-1.5)
+	assertNoErr(t, err)
+	assertEqual(t, actual, ISCPCommand("SWL-3"))
+	value, err := c.ParseParam("+18")
+	assertNoErr(t, err)
+	assertEqual(t, value, "12")
+}
+
+func TestTone(t *testing.T) {
+	c := Command{
+		Name:      "tone",
+		Group:     "TFR",
+		ParamType: Tone,
+		Lower:     -10,
+		Upper:     10,
+	}
+
+	valid := map[string]ISCPCommand{
+		"bass +2 treble -4": "TFRB+2T-4",
+		"Treble: 0":         "TFRT00",
+		"bass up":           "TFRBUP",
+		"bass 10, treble 2": "TFRB+AT+2",
+	}
+	for raw, expected := range valid {
+		actual, err := c.CreateCommand(raw)
+		assertNoErr(t, err)
+		assertEqual(t, actual, expected)
+	}
+	for _, raw := range []interface{}{"bass", "middle 2", "bass 12", 2} {
+		_, err := c.CreateCommand(raw)
+		assertErr(t, err)
+	}
+
+	// receivers with 2 dB steps, other values are rounded to the step
+	c.Step = 2
+	for raw, expected := range map[string]ISCPCommand{
+		"bass 4":            "TFRB+4",
+		"bass 3":            "TFRB+4",
+		"treble -1":         "TFRT-2",
+		"bass 1, treble -5": "TFRB+2T-6",
+	} {
+		actual, err := c.CreateCommand(raw)
+		assertNoErr(t, err)
+		assertEqual(t, actual, expected)
+	}
+
+	value, err := c.ParseParam("B+2T-A")
+	assertNoErr(t, err)
+	assertEqual(t, value, "bass 2 treble -10")
+	_, err = c.ParseParam("B+2T")
+	assertErr(t, err)
+	_, err = c.ParseParam("X+2")
+	assertErr(t, err)
+}
+
+func TestMilliseconds(t *testing.T) {
+	c := Command{
+		Name:      "av-sync",
+		Group:     "AVS",
+		ParamType: Milliseconds,
+		Upper:     800,
+		Step:      5,
+		Lookup:    map[string]string{"UP": "up", "DOWN": "down"},
+	}
+
+	valid := map[interface{}]ISCPCommand{
+		120:                    "AVS0120",
+		"45ms":                 "AVS0045",
+		"0":                    "AVS0000",
+		250 * time.Millisecond: "AVS0250",
+		"up":                   "AVSUP",
+	}
+	for raw, expected := range valid {
+		actual, err := c.CreateCommand(raw)
+		assertNoErr(t, err)
+		assertEqual(t, actual, expected)
+	}
+	for _, raw := range []interface{}{"123", 900, -5, 12.5, "slow"} {
+		_, err := c.CreateCommand(raw)
+		assertErr(t, err)
+	}
+
+	value, err := c.ParseParam("0120")
+	assertNoErr(t, err)
+	assertEqual(t, value, "120ms")
+	value, err = c.ParseParam("DOWN")
+	assertNoErr(t, err)
+	assertEqual(t, value, "down")
+}
+
+func TestEnumIndex(t *testing.T) {
+	c := Command{
+		Name:      "network-service",
+		Group:     "NSV",
+		ParamType: EnumIndex,
+		Upper:     9,
+		Lookup:    map[string]string{"0A": "spotify", "0E": "tunein", "F0": "usb"},
+		Aliases:   map[string]string{"spotify-connect": "spotify"},
+	}
+
+	valid := map[string]ISCPCommand{
+		"tunein":            "NSV0E0",
+		"spotify 1":         "NSV0A1",
+		"Spotify:2":         "NSV0A2",
+		"spotify-connect 1": "NSV0A1",
+	}
+	for raw, expected := range valid {
+		actual, err := c.CreateCommand(raw)
+		assertNoErr(t, err)
+		assertEqual(t, actual, expected)
+	}
+	for _, raw := range []interface{}{"", "dlna", "tunein 10", "tunein one", "usb 1 2", 1} {
+		_, err := c.CreateCommand(raw)
+		assertErr(t, err)
+	}
+
+	parsed := map[string]string{"0E0": "tunein", "0A2": "spotify 2"}
+	for raw, expected := range parsed {
+		actual, err := c.ParseParam(raw)
+		assertNoErr(t, err)
+		assertEqual(t, actual, expected)
+	}
+	_, err := c.ParseParam("0Axyz")
+	assertErr(t, err)
+}
@@ -0,0 +1,182 @@
+package onkyoctl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands.yaml")
+	data := []byte(`
+- name: power
+  group: PWR
+  paramtype: onOff
+  responsetimeout: 5s
+- name: volume
+  group: MVL
+  paramtype: intRange
+  upper: 100
+`)
+	err := os.WriteFile(path, data, 0600)
+	assertNoErr(t, err)
+
+	commands, err := ReadCommands(path)
+	assertNoErr(t, err)
+
+	lookup := commands.(commandLookup)
+	c, err := lookup.ForName("power")
+	assertNoErr(t, err)
+	assertEqual(t, c.ResponseTimeout, 5*time.Second)
+
+	c, err = lookup.ForName("volume")
+	assertNoErr(t, err)
+	assertEqual(t, c.ResponseTimeout, time.Duration(0))
+}
+
+func TestReadConfig(t *testing.T) {
+	data := []byte(`
+Host = 192.168.1.2
+DialTimeout = 1s
+ReadTimeout = 10m
+`)
+	cfg, err := ReadConfig(data)
+	assertNoErr(t, err)
+	assertEqual(t, cfg.Host, "192.168.1.2")
+	assertEqual(t, cfg.Port, defaultPort)
+	assertEqual(t, cfg.DialTimeout, 1*time.Second)
+	assertEqual(t, cfg.ReadTimeout, 10*time.Minute)
+	assertEqual(t, cfg.WriteTimeout, defaultWriteTimeout)
+}
+
+func TestReadConfigJSON(t *testing.T) {
+	data := []byte(`{
+	"Host": "192.168.1.2",
+	"Port": 60123,
+	"AutoConnect": true,
+	"DialTimeout": "1s",
+	"CaptureFile": null
+}`)
+	cfg, err := ReadConfigJSON(bytes.NewReader(data))
+	assertNoErr(t, err)
+	assertEqual(t, cfg.Host, "192.168.1.2")
+	assertEqual(t, cfg.Port, 60123)
+	assertEqual(t, cfg.AutoConnect, true)
+	assertEqual(t, cfg.DialTimeout, 1*time.Second)
+	assertEqual(t, cfg.WriteTimeout, defaultWriteTimeout)
+
+	path := filepath.Join(t.TempDir(), "onkyoctl.json")
+	assertNoErr(t, os.WriteFile(path, data, 0600))
+	cfg, err = ReadConfig(path)
+	assertNoErr(t, err)
+	assertEqual(t, cfg.Port, 60123)
+
+	_, err = ReadConfigJSON(bytes.NewReader([]byte(`{"Host": ["a", "b"]}`)))
+	assertErr(t, err)
+
+	_, err = ReadConfigJSON(bytes.NewReader([]byte(`Host = x`)))
+	assertErr(t, err)
+}
+
+func TestDeviceProfiles(t *testing.T) {
+	data := []byte(`
+Port = 60123
+DialTimeout = 1s
+
+[device.livingroom]
+Host = 192.168.1.2
+
+[device.office]
+Host = 192.168.1.3
+Port = 60128
+`)
+	cfg, err := ReadConfig(data)
+	assertNoErr(t, err)
+	assertEqual(t, cfg.Profiles(), []string{"livingroom", "office"})
+
+	cfg.Log = NewLogger(NoLog)
+	living, err := cfg.Device("livingroom")
+	assertNoErr(t, err)
+	assertEqual(t, living.Host, "192.168.1.2")
+	assertEqual(t, living.Port, 60123)
+	assertEqual(t, living.DialTimeout, 1*time.Second)
+	assertEqual(t, living.Log, cfg.Log)
+
+	office, err := cfg.Device("office")
+	assertNoErr(t, err)
+	assertEqual(t, office.Port, 60128)
+
+	_, err = cfg.Device("kitchen")
+	assertErr(t, err)
+
+	cfg, err = ReadConfigJSON(bytes.NewReader([]byte(`{
+	"Port": 60123,
+	"device.office": {"Host": "192.168.1.3"}
+}`)))
+	assertNoErr(t, err)
+	office, err = cfg.Device("office")
+	assertNoErr(t, err)
+	assertEqual(t, office.Host, "192.168.1.3")
+	assertEqual(t, office.Port, 60123)
+}
+
+func TestResolveCommandFile(t *testing.T) {
+	commands := []byte(`
+- name: power
+  group: PWR
+  paramtype: onOff
+`)
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "onkyoctl.ini")
+	assertNoErr(t, os.WriteFile(cfgPath, []byte("CommandFile = my-commands.yaml\n"), 0600))
+	assertNoErr(t, os.WriteFile(filepath.Join(dir, "my-commands.yaml"), commands, 0600))
+
+	cfg, err := ReadConfig(cfgPath)
+	assertNoErr(t, err)
+	assertEqual(t, cfg.CommandFile, "my-commands.yaml")
+	assertEqual(t, cfg.Commands != nil, true)
+
+	// default command file from the XDG config dir
+	xdg := t.TempDir()
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", xdg)
+	assertNoErr(t, os.Mkdir(filepath.Join(xdg, "onkyoctl"), 0700))
+	installed := filepath.Join(xdg, "onkyoctl", "commands.yaml")
+	assertNoErr(t, os.WriteFile(installed, commands, 0600))
+
+	assertEqual(t, ResolveCommandFile("commands.yaml", dir), installed)
+	assertEqual(t, ResolveCommandFile("/abs/commands.yaml", dir), "/abs/commands.yaml")
+	assertEqual(t, ResolveCommandFile("missing.yaml", dir), "missing.yaml")
+
+	cfg, err = ReadConfig([]byte("Host = 192.168.1.2\n"))
+	assertNoErr(t, err)
+	assertEqual(t, cfg.CommandFile, "")
+	assertEqual(t, cfg.Commands != nil, true)
+}
+
+func TestInputLabels(t *testing.T) {
+	labels, err := parseLabels("game:PS5, CBL-SAT: Apple TV,")
+	assertNoErr(t, err)
+	assertEqual(t, labels, map[string]string{"game": "PS5", "cbl-sat": "Apple TV"})
+
+	_, err = parseLabels("game")
+	assertErr(t, err)
+	_, err = parseLabels("game:")
+	assertErr(t, err)
+
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	cfg.InputLabels = "game:PS5"
+	device := NewDevice(cfg)
+	cmd, err := device.Preview("input", "ps5")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SLI02"))
+
+	// labels are kept for new commands
+	device.SetCommands(BasicCommands())
+	cmd, err = device.Preview("input", "ps5")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SLI02"))
+}
@@ -0,0 +1,186 @@
+package onkyoctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// WriteConfig saves the configuration to the given path.
+//
+// Paths with a ".json" extension are written as JSON, everything else
+// in ini format. Only settings that differ from the defaults are written.
+// If an ini file exists at path, it is updated in place
+// so that comments and the order of keys are preserved.
+func WriteConfig(path string, cfg *Config) error {
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err = configJSON(cfg)
+	} else {
+		data, err = configINI(path, cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first to not leave a partial config
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".onkyoctl-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// SetDevice adds or replaces the named device profile.
+func (c *Config) SetDevice(name string, p *Config) {
+	if c.profiles == nil {
+		c.profiles = make(map[string]*Config)
+	}
+	cfg := *p
+	cfg.profiles = nil
+	c.profiles[name] = &cfg
+}
+
+func configINI(path string, cfg *Config) ([]byte, error) {
+	file, err := ini.LoadSources(ini.LoadOptions{Loose: true}, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing config: %v", err)
+	}
+
+	writeSection(file.Section(""), cfg, DefaultConfig())
+
+	for _, section := range file.Sections() {
+		name := strings.TrimPrefix(section.Name(), profilePrefix)
+		if name == section.Name() {
+			continue
+		}
+		if _, ok := cfg.profiles[name]; !ok {
+			file.DeleteSection(section.Name())
+		}
+	}
+	for _, name := range cfg.Profiles() {
+		writeSection(file.Section(profilePrefix+name), cfg.profiles[name], cfg)
+	}
+	for _, name := range cfg.Scenes() {
+		file.Section(scenePrefix + name).Key("Steps").SetValue(cfg.scenes[name].String())
+	}
+	for _, name := range cfg.Webhooks() {
+		err = file.Section(webhookPrefix + name).ReflectFrom(cfg.webhooks[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	_, err = file.WriteTo(&buf)
+	return buf.Bytes(), err
+}
+
+// writeSection sets the keys for settings that differ from base
+// and updates keys that already exist in the section.
+func writeSection(section *ini.Section, cfg, base *Config) {
+	for _, v := range configValues(cfg, base) {
+		if section.HasKey(v.key) {
+			section.Key(v.key).SetValue(v.String())
+		} else if v.changed {
+			section.NewKey(v.key, v.String())
+		}
+	}
+}
+
+func configJSON(cfg *Config) ([]byte, error) {
+	values := jsonValues(cfg, DefaultConfig())
+	for _, name := range cfg.Profiles() {
+		values[profilePrefix+name] = jsonValues(cfg.profiles[name], cfg)
+	}
+	for _, name := range cfg.Scenes() {
+		values[scenePrefix+name] = map[string]interface{}{"Steps": cfg.scenes[name].String()}
+	}
+	for _, name := range cfg.Webhooks() {
+		section := ini.Empty().Section(name)
+		err := section.ReflectFrom(cfg.webhooks[name])
+		if err != nil {
+			return nil, err
+		}
+		values[webhookPrefix+name] = section.KeysHash()
+	}
+
+	data, err := json.MarshalIndent(values, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func jsonValues(cfg, base *Config) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, v := range configValues(cfg, base) {
+		if !v.changed {
+			continue
+		}
+		switch v.value.(type) {
+		case bool, int:
+			values[v.key] = v.value
+		default:
+			values[v.key] = v.String()
+		}
+	}
+	return values
+}
+
+// configValue is a setting from the Config struct.
+type configValue struct {
+	key     string
+	value   interface{}
+	changed bool
+}
+
+func (c configValue) String() string {
+	return fmt.Sprint(c.value)
+}
+
+// configValues returns the settings from cfg which can be saved,
+// i.e. all exported fields except for interfaces and functions.
+func configValues(cfg, base *Config) []configValue {
+	v := reflect.ValueOf(cfg).Elem()
+	b := reflect.ValueOf(base).Elem()
+	t := v.Type()
+
+	values := make([]configValue, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("ini") == "-" {
+			continue
+		}
+		switch field.Type.Kind() {
+		case reflect.Interface, reflect.Func, reflect.Map:
+			continue
+		}
+
+		value := v.Field(i).Interface()
+		values = append(values, configValue{
+			key:     field.Name,
+			value:   value,
+			changed: !reflect.DeepEqual(value, b.Field(i).Interface()),
+		})
+	}
+	return values
+}
@@ -0,0 +1,80 @@
+package onkyoctl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "onkyoctl.ini")
+	data := []byte(`# IP address of the receiver
+Host = 192.168.1.2
+Port = 60128
+
+[device.office]
+Host = 192.168.1.3
+`)
+	assertNoErr(t, os.WriteFile(path, data, 0600))
+
+	cfg, err := ReadConfig(path)
+	assertNoErr(t, err)
+	cfg.Host = "192.168.1.5"
+	cfg.DialTimeout = 5 * time.Second
+	p := DefaultConfig()
+	p.Host = "192.168.1.4"
+	cfg.SetDevice("kitchen", p)
+
+	assertNoErr(t, WriteConfig(path, cfg))
+
+	written, err := os.ReadFile(path)
+	assertNoErr(t, err)
+	assertEqual(t, strings.Contains(string(written), "# IP address of the receiver"), true)
+
+	cfg, err = ReadConfig(path)
+	assertNoErr(t, err)
+	assertEqual(t, cfg.Host, "192.168.1.5")
+	assertEqual(t, cfg.DialTimeout, 5*time.Second)
+	assertEqual(t, cfg.Profiles(), []string{"kitchen", "office"})
+
+	kitchen, err := cfg.Device("kitchen")
+	assertNoErr(t, err)
+	assertEqual(t, kitchen.Host, "192.168.1.4")
+}
+
+func TestWriteConfigJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "onkyoctl.json")
+
+	cfg := DefaultConfig()
+	cfg.Host = "192.168.1.2"
+	cfg.AllowReconnect = true
+	cfg.ReadTimeout = time.Minute
+	office := *cfg
+	office.Port = 60123
+	cfg.SetDevice("office", &office)
+	hook := defaultWebhook("power")
+	hook.URL = "http://localhost/hook"
+	hook.Filter = []string{"power=on", "input"}
+	cfg.webhooks = map[string]*Webhook{"power": hook}
+
+	assertNoErr(t, WriteConfig(path, cfg))
+
+	read, err := ReadConfig(path)
+	assertNoErr(t, err)
+	assertEqual(t, read.Host, "192.168.1.2")
+	assertEqual(t, read.AllowReconnect, true)
+	assertEqual(t, read.ReadTimeout, time.Minute)
+	assertEqual(t, read.Profiles(), []string{"office"})
+
+	// profiles only contain differences, the base settings are inherited
+	p, err := read.Device("office")
+	assertNoErr(t, err)
+	assertEqual(t, p.Host, "192.168.1.2")
+	assertEqual(t, p.Port, 60123)
+
+	w, err := read.Webhook("power")
+	assertNoErr(t, err)
+	assertEqual(t, w, hook)
+}
@@ -1,29 +1,89 @@
 package onkyoctl
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
 	"sync"
 	"time"
 )
 
-const protocol = "tcp"
+const (
+	protocol               = "tcp"
+	defaultResponseTimeout = 2 * time.Second
+)
 
 // Callback is the type for message callback functions.
 type Callback func(name, value string)
 
+// BinaryCallback is the type for callbacks that receive binary data.
+// The prefix contains the leading, non-binary part of the parameter.
+type BinaryCallback func(name, prefix string, data []byte)
+
+// ErrorEvent describes an error that occurred in the background,
+// e.g. when the connection handling had to be restarted.
+type ErrorEvent struct {
+	Time  time.Time
+	Error error
+}
+
 // Device is an Onkyo device.
 type Device struct {
 	Host           string
 	Port           int
 	log            Logger
+	clock          Clock
 	commands       CommandSet
+	commandsLock   sync.RWMutex
+	baseCommands   CommandSet
+	inputLabels    map[string]string
+	selectorLabels map[string]string
+	configPath     string
+	profile        string
 	callback       Callback
+	onRaw          func(ISCPCommand)
+	subscribers    map[int]func(*ParsedMessage)
+	nextSubscriber int
+	subscribeLock  sync.Mutex
+	groupHandlers  map[ISCPGroup][]func(string)
+	onBinary       BinaryCallback
+	onAlbumArt     AlbumArtCallback
+	art            *artAssembler
+	info           signalInfo
+	hardware       deviceInfo
+	onVideoInfo    VideoInfoCallback
+	onFirmware     FirmwareCallback
+	playing        *nowPlaying
+	onNowPlaying   NowPlayingCallback
+	middleware     middlewares
+	history        *history
+	state          *state
+	throttle       *throttle
+	refresh        map[string]time.Duration
 	onConnect      func()
 	onDisconnect   func()
+	onError        func(ErrorEvent)
 	wait           *sync.WaitGroup
 	autoConnect    bool
 	allowReconnect bool
-	reconnectTime  time.Duration
+	backoff        *backoff
 	client         *client
+	ctx            context.Context
+	cancel         context.CancelFunc
+	lifeLock       sync.Mutex
+	mac            net.HardwareAddr
+	wakeAddress    string
+	waiters        map[ISCPGroup][]chan response
+	waitersLock    sync.Mutex
+	inflight       map[ISCPGroup]time.Time
+	coalesceWindow time.Duration
+}
+
+type response struct {
+	value string
+	err   error
 }
 
 // NewDevice sets up a new Onkyo device.
@@ -37,30 +97,341 @@ func NewDevice(cfg *Config) *Device {
 	if log == nil {
 		log = NewLogger(NoLog)
 	}
+	log = WithFields(log, logContext(cfg))
+
+	clock := cfg.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	labels, err := parseLabels(cfg.InputLabels)
+	if err != nil {
+		log.Error("Invalid input labels: %v", err)
+	}
+
+	intervals, err := parseIntervals(cfg.Throttle)
+	if err != nil {
+		log.Error("Invalid throttle: %v", err)
+	}
+	refresh, err := parseIntervals(cfg.Refresh)
+	if err != nil {
+		log.Error("Invalid refresh: %v", err)
+	}
+
+	reconnect := newBackoff(time.Duration(cfg.ReconnectSeconds)*time.Second,
+		time.Duration(cfg.MaxReconnectSeconds)*time.Second)
 
 	d := &Device{
 		Host:           cfg.Host,
 		Port:           cfg.Port,
 		log:            log,
-		commands:       commands,
+		clock:          clock,
+		baseCommands:   commands,
+		inputLabels:    labels,
 		wait:           &sync.WaitGroup{},
 		autoConnect:    cfg.AutoConnect,
 		allowReconnect: cfg.AllowReconnect,
-		reconnectTime:  time.Duration(cfg.ReconnectSeconds) * time.Second,
+		backoff:        reconnect,
 		client:         newClient(cfg.Host, cfg.Port, log),
+		waiters:        make(map[ISCPGroup][]chan response),
+		inflight:       make(map[ISCPGroup]time.Time),
+		coalesceWindow: cfg.QueryCoalesceWindow,
+		art:            &artAssembler{},
+		playing:        &nowPlaying{interval: cfg.PositionInterval},
+		history:        newHistory(cfg.HistorySize),
+		state:          newState(),
+		throttle:       newThrottle(intervals, clock),
+		refresh:        refresh,
+		subscribers:    make(map[int]func(*ParsedMessage)),
+		groupHandlers:  make(map[ISCPGroup][]func(string)),
+		wakeAddress:    cfg.WakeAddress,
+		configPath:     cfg.path,
+		profile:        cfg.profile,
+	}
+
+	d.applyCommands()
+
+	if d.wakeAddress == "" {
+		d.wakeAddress = defaultWakeAddress
+	}
+	if cfg.MACAddress != "" {
+		mac, err := net.ParseMAC(cfg.MACAddress)
+		if err != nil {
+			log.Error("Invalid MAC address %q: %v", cfg.MACAddress, err)
+		}
+		d.mac = mac
 	}
 
 	d.client.handler = d.handleReceived
 	d.client.connectionCB = d.connectionChanged
+	d.client.errorCB = d.handleError
+	d.client.watchdog = time.Duration(cfg.WatchdogSeconds) * time.Second
+	switch cfg.Transport {
+	case TransportSerial:
+		d.client.dial = serialDialer(cfg.SerialDevice, cfg.BaudRate)
+		d.client.framing = iscpFraming{}
+	case TransportTCP, "":
+		d.client.framing = eiscpFraming{strict: cfg.StrictVersion}
+		d.client.dialTCP = tcpDialer(cfg, log)
+		d.client.socket = socketOptions{
+			noDelay:     cfg.NoDelay,
+			readBuffer:  cfg.ReadBuffer,
+			writeBuffer: cfg.WriteBuffer,
+		}
+	default:
+		log.Error("Unknown transport %q", cfg.Transport)
+		d.client.dial = unknownTransport(cfg.Transport)
+		d.client.framing = eiscpFraming{strict: cfg.StrictVersion}
+	}
+	d.client.captureFile = cfg.CaptureFile
+	d.client.offline = newOfflineQueue(cfg.OfflinePolicy, cfg.OfflineQueueSize, cfg.OfflineMaxAge)
+	d.client.setSendQueue(cfg.SendQueueSize, cfg.SendQueuePolicy, cfg.SendQueueTimeout)
+	if cfg.DialTimeout > 0 {
+		d.client.dialTimeout = cfg.DialTimeout
+	}
+	d.client.readTimeout = cfg.ReadTimeout
+	d.client.writeTimeout = cfg.WriteTimeout
+	d.client.setClock(clock)
+	d.client.setCallbackQueue(cfg.CallbackQueueSize)
 	return d
 }
 
+// logContext returns the fields that identify the device in log messages.
+func logContext(cfg *Config) Fields {
+	fields := Fields{"host": cfg.Host}
+	if cfg.Transport == TransportSerial {
+		fields["host"] = cfg.SerialDevice
+	}
+	if cfg.profile != "" {
+		fields["device"] = cfg.profile
+	}
+	return fields
+}
+
+// tcpDialer returns the DialFunc from the config, a dialer for the
+// configured proxy or nil for a direct connection.
+func tcpDialer(cfg *Config, log Logger) DialFunc {
+	if cfg.DialFunc != nil {
+		return cfg.DialFunc
+	}
+	if cfg.Proxy == "" {
+		return nil
+	}
+
+	timeout := cfg.DialTimeout
+	if timeout <= 0 {
+		timeout = defaultDialTimeout
+	}
+	dial, err := proxyDialer(cfg.Proxy, timeout)
+	if err != nil {
+		log.Error("Invalid proxy %q: %v", cfg.Proxy, err)
+		return nil
+	}
+	return dial
+}
+
+// SetCommands replaces the command set used by the device.
+// The connection is not affected.
+// Input labels from the config and the receiver are applied
+// to the new commands.
+func (d *Device) SetCommands(commands CommandSet) {
+	if commands == nil {
+		commands = emptyCommands()
+	}
+	d.commandsLock.Lock()
+	defer d.commandsLock.Unlock()
+	d.baseCommands = commands
+	d.applyCommands()
+}
+
+// inputCommands are renamed with the input labels.
+var inputCommands = []string{"input", "input-zone2", "input-zone3", "input-zone4"}
+
+// applyCommands sets the command set from the base commands with the
+// input labels applied. Labels from the config take precedence over the
+// names reported by the receiver.
+// commandsLock must be held.
+func (d *Device) applyCommands() {
+	labels := make(map[string]string, len(d.selectorLabels)+len(d.inputLabels))
+	for value, label := range d.selectorLabels {
+		labels[value] = label
+	}
+	for value, label := range d.inputLabels {
+		labels[value] = label
+	}
+	commands := d.baseCommands
+	for _, name := range inputCommands {
+		commands = RenameValues(commands, name, labels)
+	}
+	d.commands = &supportedCommands{CommandSet: commands, info: &d.hardware}
+}
+
+// Commands returns the command set used by the device.
+func (d *Device) Commands() CommandSet {
+	return d.commandSet()
+}
+
+func (d *Device) commandSet() CommandSet {
+	d.commandsLock.RLock()
+	defer d.commandsLock.RUnlock()
+	return d.commands
+}
+
+// Reload re-reads the config file the device was created from
+// and applies the new command definitions without dropping the connection.
+//
+// Settings for the connection (e.g. Host, Transport) are not applied,
+// this requires a new Device.
+// If the config has no command definitions, the current ones are kept.
+func (d *Device) Reload() error {
+	if d.configPath == "" {
+		return errors.New("device was not created from a config file")
+	}
+
+	cfg, err := ReadConfig(d.configPath)
+	if err != nil {
+		return err
+	}
+	if d.profile != "" {
+		cfg, err = cfg.Device(d.profile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.Host != d.Host || cfg.Port != d.Port {
+		d.log.Warning("Connection settings changed, restart to apply them")
+	}
+	labels, err := parseLabels(cfg.InputLabels)
+	if err != nil {
+		return err
+	}
+	intervals, err := parseIntervals(cfg.Throttle)
+	if err != nil {
+		return err
+	}
+	d.commandsLock.Lock()
+	d.inputLabels = labels
+	if cfg.Commands != nil {
+		d.baseCommands = cfg.Commands
+	}
+	d.applyCommands()
+	d.commandsLock.Unlock()
+	d.throttle.setIntervals(intervals)
+	d.log.Info("Reloaded config from %q", d.configPath)
+	return nil
+}
+
+// ParseMessage interprets an ISCP command with the command set
+// of the device.
+func (d *Device) ParseMessage(cmd ISCPCommand) (*ParsedMessage, error) {
+	return ParseMessage(d.commandSet(), cmd)
+}
+
 // OnMessage sets the handler for received messages to the given function.
 // This will replace any existing handler.
 func (d *Device) OnMessage(callback Callback) {
 	d.callback = callback
 }
 
+// Subscribe adds a handler for received messages.
+// Unlike OnMessage, any number of handlers can be subscribed,
+// e.g. one for each client of a bridge.
+// Call the returned function to remove the handler.
+func (d *Device) Subscribe(callback func(*ParsedMessage)) func() {
+	d.subscribeLock.Lock()
+	defer d.subscribeLock.Unlock()
+	id := d.nextSubscriber
+	d.nextSubscriber++
+	d.subscribers[id] = callback
+
+	return func() {
+		d.subscribeLock.Lock()
+		defer d.subscribeLock.Unlock()
+		delete(d.subscribers, id)
+	}
+}
+
+// HandleGroup adds a handler for messages from the given ISCP group.
+// It receives the raw parameter, e.g. "01" for "PWR01".
+// This also works for groups that are not in the command set.
+func (d *Device) HandleGroup(group ISCPGroup, fn func(param string)) {
+	d.subscribeLock.Lock()
+	defer d.subscribeLock.Unlock()
+	d.groupHandlers[group] = append(d.groupHandlers[group], fn)
+}
+
+func (d *Device) handleGroup(cmd ISCPCommand) {
+	if len(cmd) < 3 {
+		return
+	}
+	group, param := SplitISCP(cmd)
+	d.subscribeLock.Lock()
+	handlers := append([]func(string){}, d.groupHandlers[group]...)
+	d.subscribeLock.Unlock()
+
+	for _, fn := range handlers {
+		fn(param)
+	}
+}
+
+// publish passes m to the subscribers in the order they subscribed.
+// The lock is not held while the subscribers are called,
+// so they can subscribe or unsubscribe.
+func (d *Device) publish(m *ParsedMessage) {
+	d.subscribeLock.Lock()
+	ids := make([]int, 0, len(d.subscribers))
+	for id := range d.subscribers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	callbacks := make([]func(*ParsedMessage), len(ids))
+	for i, id := range ids {
+		callbacks[i] = d.subscribers[id]
+	}
+	d.subscribeLock.Unlock()
+
+	for _, callback := range callbacks {
+		callback(m)
+	}
+}
+
+// OnRaw sets a handler that receives every message as ISCP command,
+// before it is interpreted, including messages for unknown commands.
+func (d *Device) OnRaw(callback func(ISCPCommand)) {
+	d.onRaw = callback
+}
+
+// OnFrame sets a handler that receives every frame sent to or received
+// from the device, including the eISCP header.
+// It must be set before the device is started.
+func (d *Device) OnFrame(callback func(CaptureRecord)) {
+	d.client.frameCB = callback
+}
+
+// OnBinary sets the handler for messages of binary commands (e.g. album art).
+// Binary messages are not passed to the OnMessage handler.
+func (d *Device) OnBinary(callback BinaryCallback) {
+	d.onBinary = callback
+}
+
+// OnAlbumArt sets the handler for album art from the network player.
+// The callback receives the complete image once all parts are received.
+func (d *Device) OnAlbumArt(callback AlbumArtCallback) {
+	d.onAlbumArt = callback
+}
+
+// OnStats is called whenever the connection statistics change.
+// The callback is invoked for every frame, keep it short.
+func (d *Device) OnStats(callback StatsCallback) {
+	d.client.stats.setCallback(callback)
+}
+
+// Stats returns statistics for the connection to the device.
+func (d *Device) Stats() Stats {
+	return d.client.stats.get()
+}
+
 // OnDisconnected is called when the device is disconnected.
 func (d *Device) OnDisconnected(callback func()) {
 	d.onDisconnect = callback
@@ -71,23 +442,67 @@ func (d *Device) OnConnected(callback func()) {
 	d.onConnect = callback
 }
 
+// OnError is called when an error occurs in the background.
+func (d *Device) OnError(callback func(ErrorEvent)) {
+	d.onError = callback
+}
+
 // Start connects to the device and starts receiving messages.
 func (d *Device) Start() {
-	d.client.Start()
-	d.client.Connect()
+	d.StartContext(context.Background())
+}
+
+// StartContext works like Start, but stops the device when ctx is done.
+// This includes the connection, the read loop and pending reconnects.
+func (d *Device) StartContext(ctx context.Context) {
+	d.lifeLock.Lock()
+	if d.ctx == nil || d.ctx.Err() != nil {
+		d.ctx, d.cancel = context.WithCancel(ctx)
+		d.startRefresh(d.ctx)
+	}
+	ctx = d.ctx
+	d.lifeLock.Unlock()
+
+	d.client.Start(ctx)
+	d.client.Connect(ctx)
+}
+
+// WaitConnect waits until the device is connected.
+// ErrNotConnected is returned if it is not connected within timeout.
+func (d *Device) WaitConnect(timeout time.Duration) error {
+	if !d.client.WaitConnect(timeout) {
+		return ErrNotConnected
+	}
+	return nil
 }
 
 // Stop disconnects from the device and stop message processing.
 func (d *Device) Stop() {
 	d.log.Info("Stop device [%v:%v]", d.Host, d.Port)
-	d.client.Stop()
+	d.lifeLock.Lock()
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.lifeLock.Unlock()
+	d.throttle.reset()
+	d.client.Stop(context.Background())
+}
+
+// context returns the context for the current run of the device.
+func (d *Device) context() context.Context {
+	d.lifeLock.Lock()
+	defer d.lifeLock.Unlock()
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
 }
 
 // SendCommand sends an "friendly" command (e.g. "power off") to the device.
 //
 // This method calls `SendISCP()` behind the scenes.
 func (d *Device) SendCommand(name string, param interface{}) error {
-	command, err := d.commands.CreateCommand(name, param)
+	command, err := d.commandSet().CreateCommand(name, param)
 	if err != nil {
 		return err
 	}
@@ -95,15 +510,244 @@ func (d *Device) SendCommand(name string, param interface{}) error {
 	return d.SendISCP(command, 0)
 }
 
+// Preview returns the ISCP command that SendCommand would send
+// for the given name and parameter, without sending anything.
+//
+// An error is returned if the name or parameter is invalid.
+func (d *Device) Preview(name string, param interface{}) (ISCPCommand, error) {
+	return d.commandSet().CreateCommand(name, param)
+}
+
 // Query sends a QSTN command for the given friendly name.
 //
 // This method calls `SendISCP()` behind the scenes.
 func (d *Device) Query(name string) error {
-	q, err := d.commands.CreateQuery(name)
+	q, err := d.commandSet().CreateQuery(name)
+	if err != nil {
+		return err
+	}
+	return d.sendQuery(q, 0)
+}
+
+// SendCommandSync sends a "friendly" command and waits for the response
+// from the device. It returns the value reported by the device.
+//
+// The time to wait is taken from the command's ResponseTimeout.
+// ErrTimeout is returned if no response is received in time.
+func (d *Device) SendCommandSync(name string, param interface{}) (string, error) {
+	command, err := d.commandSet().CreateCommand(name, param)
+	if err != nil {
+		return "", err
+	}
+	return d.sendSync(name, command)
+}
+
+// QuerySync sends a QSTN command for the given friendly name
+// and waits for the response.
+//
+// The time to wait is taken from the command's ResponseTimeout.
+// ErrTimeout is returned if no response is received in time.
+func (d *Device) QuerySync(name string) (string, error) {
+	q, err := d.commandSet().CreateQuery(name)
+	if err != nil {
+		return "", err
+	}
+	return d.sendSync(name, q)
+}
+
+// Toggle switches a command to its opposite state and returns the new value
+// reported by the device.
+//
+// Commands of type onOffToggle and enumToggle send the "toggle" parameter.
+// For onOff commands, the current state is queried first and then inverted.
+func (d *Device) Toggle(name string) (string, error) {
+	lookup, ok := d.commandSet().(commandLookup)
+	if !ok {
+		return d.SendCommandSync(name, "toggle")
+	}
+	c, err := lookup.ForName(name)
+	if err != nil {
+		return "", err
+	}
+
+	switch c.ParamType {
+	case OnOffToggle, EnumToggle:
+		return d.SendCommandSync(name, "toggle")
+	case OnOff:
+		current, err := d.QuerySync(name)
+		if err != nil {
+			return "", err
+		}
+		value := "on"
+		if current == "on" {
+			value = "off"
+		}
+		return d.SendCommandSync(name, value)
+	default:
+		return "", fmt.Errorf("%w: %q cannot be toggled", ErrInvalidParam, name)
+	}
+}
+
+func (d *Device) sendSync(name string, command ISCPCommand) (string, error) {
+	timeout := d.responseTimeout(name)
+	deadline := d.clock.Now().Add(timeout)
+
+	group, _ := SplitISCP(command)
+	wait := d.expect(group)
+	defer d.unexpect(group, wait)
+
+	var err error
+	_, param := SplitISCP(command)
+	if param == queryParam {
+		err = d.sendQuery(command, timeout)
+	} else {
+		err = d.SendISCP(command, timeout)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case r := <-wait:
+		return r.value, r.err
+	case <-d.clock.After(deadline.Sub(d.clock.Now())):
+		return "", ErrTimeout
+	}
+}
+
+// sendQuery sends a query unless a query for the same group
+// was sent recently and is still waiting for its response.
+// All waiters receive the response to the first query.
+func (d *Device) sendQuery(q ISCPCommand, timeout time.Duration) error {
+	group, _ := SplitISCP(q)
+	if !d.startQuery(group) {
+		d.log.Debug("Coalesce query %v", q)
+		return nil
+	}
+
+	err := d.SendISCP(q, timeout)
+	if err != nil {
+		d.waitersLock.Lock()
+		delete(d.inflight, group)
+		d.waitersLock.Unlock()
+	}
+	return err
+}
+
+// startQuery marks a query for the given group as in flight.
+// Returns false if there is already a query in flight.
+func (d *Device) startQuery(group ISCPGroup) bool {
+	d.waitersLock.Lock()
+	defer d.waitersLock.Unlock()
+
+	sent, ok := d.inflight[group]
+	now := d.clock.Now()
+	if ok && now.Sub(sent) < d.coalesceWindow {
+		return false
+	}
+	d.inflight[group] = now
+	return true
+}
+
+func (d *Device) responseTimeout(name string) time.Duration {
+	lookup, ok := d.commandSet().(commandLookup)
+	if ok {
+		c, err := lookup.ForName(name)
+		if err == nil && c.ResponseTimeout > 0 {
+			return c.ResponseTimeout
+		}
+	}
+	return defaultResponseTimeout
+}
+
+// expect registers a channel that receives the next response for a group.
+func (d *Device) expect(group ISCPGroup) chan response {
+	wait := make(chan response, 1)
+	d.waitersLock.Lock()
+	defer d.waitersLock.Unlock()
+	d.waiters[group] = append(d.waiters[group], wait)
+	return wait
+}
+
+func (d *Device) unexpect(group ISCPGroup, wait chan response) {
+	d.waitersLock.Lock()
+	defer d.waitersLock.Unlock()
+	waiting := d.waiters[group]
+	for i, w := range waiting {
+		if w == wait {
+			d.waiters[group] = append(waiting[:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(d.waiters[group]) == 0 {
+		delete(d.waiters, group)
+	}
+}
+
+// notify passes a response to everyone who waits for the given group.
+func (d *Device) notify(group ISCPGroup, r response) {
+	d.waitersLock.Lock()
+	defer d.waitersLock.Unlock()
+	delete(d.inflight, group)
+	for _, wait := range d.waiters[group] {
+		select {
+		case wait <- r:
+		default:
+			// already has a response
+		}
+	}
+}
+
+// WaitFor blocks until the device reports the given value for a command,
+// e.g. WaitFor(ctx, "power", "on").
+//
+// The current value is queried first. Returns ErrTimeout if the deadline
+// of ctx is exceeded before the value is reported.
+func (d *Device) WaitFor(ctx context.Context, name string, value interface{}) error {
+	// normalize the value, e.g. "1" to "on"
+	command, err := d.commandSet().CreateCommand(name, value)
 	if err != nil {
 		return err
 	}
-	return d.SendISCP(q, 0)
+	_, want, err := d.commandSet().ReadCommand(command)
+	if err != nil {
+		return err
+	}
+	q, err := d.commandSet().CreateQuery(name)
+	if err != nil {
+		return err
+	}
+
+	group, _ := SplitISCP(q)
+	wait := d.expect(group)
+	defer d.unexpect(group, wait)
+
+	err = d.sendQuery(q, 0)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case r := <-wait:
+			if r.err == nil && r.value == want {
+				return nil
+			}
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ErrTimeout
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// History returns the most recent values received for the given
+// friendly name, oldest first.
+//
+// The number of values kept per command is set with Config.HistorySize.
+func (d *Device) History(name string) []HistoryEntry {
+	return d.history.get(name)
 }
 
 // SendISCP sends a raw ISCP command to the device.
@@ -121,52 +765,192 @@ func (d *Device) SendISCP(cmd ISCPCommand, timeout time.Duration) error {
 		// if already connected, this does nothing
 		d.Start()
 	}
+	cmd, err := d.middleware.send(cmd)
+	if err != nil {
+		return err
+	}
 	d.client.WaitConnect(timeout)
 
-	return d.client.Send(cmd, timeout)
+	return d.client.SendPriority(cmd, timeout, d.priority(cmd))
+}
+
+// priority returns the priority of the command definition for cmd.
+func (d *Device) priority(cmd ISCPCommand) Priority {
+	if len(cmd) < 3 {
+		return PriorityNormal
+	}
+	group, param := SplitISCP(cmd)
+	lookup, ok := d.commandSet().(commandLookup)
+	if ok {
+		c, err := lookup.ForGroup(group)
+		if err == nil && c.Priority != "" {
+			return c.Priority
+		}
+	}
+	if param == queryParam {
+		return PriorityLow
+	}
+	return PriorityNormal
 }
 
 func (d *Device) connectionChanged(s ConnectionState) {
-	d.log.Debug("Connection state changed to %q", s)
-	if s == Connected && d.onConnect != nil {
-		d.onConnect()
+	logFields(d.log, Debug, Fields{"state": s.String()},
+		"Connection state changed to %q", s)
+	if s == Connected {
+		d.backoff.reset()
+		go d.refreshAll()
+		if d.onConnect != nil {
+			d.onConnect()
+		}
 	}
 
-	if s == Disconnected && d.onDisconnect != nil {
-		d.onDisconnect()
-		if d.allowReconnect {
-			//TODO: not when we Stop()'ed
-			d.log.Debug("Schedule reconnect")
+	if s == Disconnected {
+		if d.onDisconnect != nil {
+			d.onDisconnect()
+		}
+		ctx := d.context()
+		if d.allowReconnect && ctx.Err() == nil {
+			delay := d.backoff.next()
+			d.log.Debug("Schedule reconnect in %v", delay)
 			go func() {
-				time.Sleep(d.reconnectTime)
-				d.client.Connect()
+				select {
+				case <-d.clock.After(delay):
+					d.client.Connect(ctx)
+				case <-ctx.Done():
+				}
 			}()
 		}
 	}
 }
 
+func (d *Device) handleError(err error) {
+	if d.onError != nil {
+		d.onError(ErrorEvent{Time: d.clock.Now(), Error: err})
+	}
+}
+
+// commandLookup is implemented by command sets that can look up
+// command definitions by name and ISCP group.
+type commandLookup interface {
+	ForName(name string) (Command, error)
+	ForGroup(group ISCPGroup) (Command, error)
+}
+
 func (d *Device) handleReceived(cmd ISCPCommand) {
-	name, value, err := d.commands.ReadCommand(cmd)
+	cmd, err := d.middleware.receive(cmd)
+	if err != nil {
+		d.log.Debug("Dropped %q: %v", cmd, err)
+		return
+	}
+	if d.onRaw != nil {
+		d.onRaw(cmd)
+	}
+	d.handleGroup(cmd)
+	d.handleInfo(cmd)
+	d.handleFirmware(cmd)
+	d.handleNowPlaying(cmd)
+	if d.handleBinary(cmd) || d.handlePopup(cmd) || d.handleDeviceInfo(cmd) {
+		return
+	}
+
+	group, _ := SplitISCP(cmd)
+	name, value, err := d.commandSet().ReadCommand(cmd)
+	d.notify(group, response{value: value, err: err})
 	if err != nil {
 		d.log.Warning("Error reading %q: %v", cmd, err)
 		return
 	}
-	d.log.Debug("Received '%v %v'", name, value)
+	fields := messageFields("recv", cmd)
+	fields["name"] = name
+	fields["value"] = value
+	logFields(d.log, Debug, fields, "Received '%v %v'", name, value)
+	now := d.clock.Now()
+	d.history.add(name, value, now)
+	d.state.set(name, value, now)
+	m := &ParsedMessage{
+		Name:  name,
+		Value: value,
+		Group: group,
+		Raw:   cmd,
+		Time:  now,
+	}
+	if d.throttle.hold(d.context(), m, d.deliverLater) {
+		return
+	}
+	d.deliver(m)
+}
+
+// deliver passes a message to the callback and the subscribers.
+func (d *Device) deliver(m *ParsedMessage) {
 	if d.callback != nil {
-		d.callback(name, value)
+		d.callback(m.Name, m.Value)
 	}
+	d.publish(m)
+}
+
+// deliverLater delivers a message that was held back by the throttle
+// after the callbacks that are already waiting.
+func (d *Device) deliverLater(m *ParsedMessage) {
+	d.client.dispatch(func() {
+		d.deliver(m)
+	})
+}
+
+// handleBinary passes binary messages to the binary callback
+// and returns true if the message was a binary message.
+func (d *Device) handleBinary(cmd ISCPCommand) bool {
+	lookup, ok := d.commandSet().(commandLookup)
+	if !ok {
+		return false
+	}
+	group, param := SplitISCP(cmd)
+	c, err := lookup.ForGroup(group)
+	if err != nil || c.ParamType != Binary {
+		return false
+	}
+
+	if group == albumArtGroup {
+		image, mime, err := d.art.add(param)
+		if err != nil {
+			d.log.Warning("Error reading album art: %v", err)
+		} else if image != nil && d.onAlbumArt != nil {
+			d.onAlbumArt(image, mime)
+		}
+		if !isArtImage(param) {
+			// URL or no image
+			return true
+		}
+	}
+
+	prefix, data, err := c.ParseBinary(param)
+	if err != nil {
+		d.log.Warning("Error reading %q: %v", group, err)
+		return true
+	}
+	d.log.Debug("Received %v bytes for %q", len(data), c.Name)
+	if d.onBinary != nil {
+		d.onBinary(c.Name, prefix, data)
+	}
+	return true
 }
 
 // BasicCommands creates a command set with some commonly used commands.
 func BasicCommands() CommandSet {
-	commands := []Command{
+	return NewBasicCommandSet(basicCommands())
+}
+
+func basicCommands() []Command {
+	return []Command{
 		{
 			Name:      "power",
+			Category:  "system",
 			Group:     "PWR",
 			ParamType: "onOff",
+			Priority:  PriorityHigh,
 		},
 		{
 			Name:      "volume",
+			Category:  "audio",
 			Group:     "MVL",
 			ParamType: "intRangeEnum",
 			Lower:     0,
@@ -179,21 +963,26 @@ func BasicCommands() CommandSet {
 		},
 		{
 			Name:      "mute",
+			Category:  "audio",
 			Group:     "AMT",
 			ParamType: "onOffToggle",
+			Priority:  PriorityHigh,
 		},
 		{
 			Name:      "speaker-a",
+			Category:  "audio",
 			Group:     "SPA",
 			ParamType: "onOff",
 		},
 		{
 			Name:      "speaker-b",
+			Category:  "audio",
 			Group:     "SPB",
 			ParamType: "onOff",
 		},
 		{
 			Name:      "dimmer",
+			Category:  "system",
 			Group:     "DIM",
 			ParamType: "enum",
 			Lookup: map[string]string{
@@ -206,6 +995,7 @@ func BasicCommands() CommandSet {
 		},
 		{
 			Name:      "display",
+			Category:  "system",
 			Group:     "DIF",
 			ParamType: "enumToggle",
 			Lookup: map[string]string{
@@ -217,39 +1007,219 @@ func BasicCommands() CommandSet {
 		},
 		{
 			Name:      "input",
+			Category:  "input",
 			Group:     "SLI",
 			ParamType: "enum",
-			Lookup: map[string]string{
-				"00": "video-1",
-				"01": "cbl-sat",
-				"02": "game",
-				"03": "aux1",
-				"20": "tv",
-				"2B": "network",
-			},
+			Lookup:    inputSelectors,
 		},
 		{
 			Name:      "listen-mode",
+			Category:  "audio",
 			Group:     "LMD",
 			ParamType: "enum",
-			Lookup: map[string]string{
-				"00":     "stereo",
-				"STEREO": "stereo",
-				"01":     "direct",
-				"11":     "pure",
-			},
+			Lookup:    listenModes,
+			Aliases:   listenModeAliases,
+		},
+		{
+			Name:      "jacket-art",
+			Category:  "network",
+			Group:     "NJA",
+			ParamType: "binary",
+			Prefix:    2,
+		},
+		{
+			Name:      "title",
+			Category:  "network",
+			Group:     "NTI",
+			ParamType: "text",
+		},
+		{
+			Name:      "artist",
+			Category:  "network",
+			Group:     "NAT",
+			ParamType: "text",
+		},
+		{
+			Name:      "album",
+			Category:  "network",
+			Group:     "NAL",
+			ParamType: "text",
+		},
+		{
+			Name:      "play-time",
+			Category:  "network",
+			Group:     "NTM",
+			ParamType: "text",
+		},
+		{
+			Name:      "play-status",
+			Category:  "network",
+			Group:     "NST",
+			ParamType: "text",
 		},
 		{
 			Name:      "update",
+			Category:  "system",
 			Group:     "UPD",
 			ParamType: "enum",
 			Lookup: map[string]string{
-				"00": "no-new-firmware",
-				"01": "new-firmware",
+				"00":  "no-new-firmware",
+				"01":  "new-firmware",
+				"CMP": "complete",
 			},
 		},
 	}
-	return NewBasicCommandSet(commands)
+}
+
+// inputSelectors are the SLI values. The labels on the receiver differ
+// between models, use RenameValues or Config.InputLabels to match them.
+var inputSelectors = map[string]string{
+	"00":   "video-1",
+	"01":   "cbl-sat",
+	"02":   "game",
+	"03":   "aux1",
+	"04":   "aux2",
+	"05":   "pc",
+	"06":   "video7",
+	"07":   "extra1",
+	"08":   "extra2",
+	"09":   "extra3",
+	"10":   "dvd",
+	"11":   "strm-box",
+	"12":   "tv-2",
+	"20":   "tv",
+	"21":   "tape2",
+	"22":   "phono",
+	"23":   "cd",
+	"24":   "fm",
+	"25":   "am",
+	"26":   "tuner",
+	"27":   "music-server",
+	"28":   "internet-radio",
+	"29":   "usb",
+	"2A":   "usb-rear",
+	"2B":   "network",
+	"2C":   "usb-toggle",
+	"2D":   "airplay",
+	"2E":   "bluetooth",
+	"2F":   "usb-dac",
+	"30":   "multi-ch",
+	"31":   "xm",
+	"32":   "sirius",
+	"33":   "dab",
+	"40":   "universal-port",
+	"41":   "line",
+	"42":   "line2",
+	"44":   "optical",
+	"45":   "coaxial",
+	"55":   "hdmi-5",
+	"56":   "hdmi-6",
+	"57":   "hdmi-7",
+	"80":   "main-source",
+	"UP":   "up",
+	"DOWN": "down",
+}
+
+// listenModes are the LMD values. Some codes have a different meaning
+// depending on the model, see listenModeAliases.
+// MOVIE, MUSIC and GAME select the next mode for this kind of content.
+var listenModes = map[string]string{
+	"00":     "stereo",
+	"STEREO": "stereo",
+	"01":     "direct",
+	"02":     "surround",
+	"03":     "film",
+	"04":     "thx",
+	"05":     "action",
+	"06":     "musical",
+	"07":     "mono-movie",
+	"08":     "orchestra",
+	"09":     "unplugged",
+	"0A":     "studio-mix",
+	"0B":     "tv-logic",
+	"0C":     "all-ch-stereo",
+	"0D":     "theater-dimensional",
+	"0E":     "enhanced",
+	"0F":     "mono",
+	"11":     "pure",
+	"12":     "multiplex",
+	"13":     "full-mono",
+	"14":     "dolby-virtual",
+	"15":     "dts-surround-sensation",
+	"16":     "audyssey-dsx",
+	"17":     "dts-virtual-x",
+	"1F":     "whole-house",
+	"23":     "stage",
+	"25":     "action-jp",
+	"26":     "music-jp",
+	"2E":     "sports",
+	"40":     "straight-decode",
+	"41":     "dolby-ex",
+	"42":     "thx-cinema",
+	"43":     "thx-surround-ex",
+	"44":     "thx-music",
+	"45":     "thx-games",
+	"50":     "thx-u2-cinema",
+	"51":     "thx-music-mode",
+	"52":     "thx-games-mode",
+	"80":     "plii-movie",
+	"81":     "plii-music",
+	"82":     "neo6-cinema",
+	"83":     "neo6-music",
+	"84":     "plii-thx-cinema",
+	"85":     "neo6-thx-cinema",
+	"86":     "plii-game",
+	"87":     "neural-surround",
+	"88":     "neural-thx",
+	"89":     "plii-thx-games",
+	"8A":     "neo6-thx-games",
+	"8B":     "plii-thx-music",
+	"8C":     "neo6-thx-music",
+	"8D":     "neural-thx-cinema",
+	"8E":     "neural-thx-music",
+	"8F":     "neural-thx-games",
+	"90":     "pliiz-height",
+	"91":     "neo6-cinema-dts-surround-sensation",
+	"92":     "neo6-music-dts-surround-sensation",
+	"93":     "neural-digital-music",
+	"94":     "pliiz-height-thx-cinema",
+	"95":     "pliiz-height-thx-music",
+	"96":     "pliiz-height-thx-games",
+	"97":     "pliiz-height-thx-u2-cinema",
+	"98":     "pliiz-height-thx-u2-music",
+	"99":     "pliiz-height-thx-u2-games",
+	"9A":     "neo-x-game",
+	"A0":     "plii-movie-audyssey-dsx",
+	"A1":     "plii-music-audyssey-dsx",
+	"A2":     "plii-game-audyssey-dsx",
+	"A3":     "neo6-cinema-audyssey-dsx",
+	"A4":     "neo6-music-audyssey-dsx",
+	"A5":     "neural-surround-audyssey-dsx",
+	"A6":     "neural-digital-music-audyssey-dsx",
+	"A7":     "dolby-ex-audyssey-dsx",
+	"FF":     "auto-surround",
+	"MOVIE":  "movie",
+	"MUSIC":  "music",
+	"GAME":   "game",
+	"UP":     "up",
+	"DOWN":   "down",
+}
+
+// listenModeAliases are the names used for LMD values by some models,
+// e.g. the game modes or Dolby Surround on models with Dolby Atmos.
+var listenModeAliases = map[string]string{
+	"game-rpg":       "film",
+	"game-action":    "action",
+	"game-rock":      "musical",
+	"game-sports":    "enhanced",
+	"pure-audio":     "pure",
+	"surround-5.1":   "straight-decode",
+	"dolby-surround": "plii-movie",
+	"dolby-pliix":    "plii-movie",
+	"neural-x":       "neo6-cinema",
+	"neo-x-cinema":   "neo6-cinema",
+	"neo-x-music":    "neo6-music",
+	"dts-neural-x":   "neo6-cinema",
 }
 
 func emptyCommands() CommandSet {
@@ -1,9 +1,12 @@
 package onkyoctl
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -21,7 +24,106 @@ func TestDeviceBasics(t *testing.T) {
 	}
 }
 
-func xTestDeviceConnectAndSend(t *testing.T) {
+func TestDeviceStartContext(t *testing.T) {
+	device := NewDevice(testConfig())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	device.StartContext(ctx)
+	assertEqual(t, device.client.isRunning(), true)
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	assertEqual(t, device.client.isRunning(), false)
+
+	// can be started again
+	device.Start()
+	assertEqual(t, device.client.isRunning(), true)
+	device.Stop()
+	assertEqual(t, device.client.isRunning(), false)
+}
+
+func TestDevicePreview(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+
+	cmd, err := device.Preview("volume", 23)
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("MVL2E"))
+
+	cmd, err = device.Preview("power", "on")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("PWR01"))
+
+	_, err = device.Preview("power", "maybe")
+	assertErr(t, err)
+
+	_, err = device.Preview("no-such-command", "on")
+	assertErr(t, err)
+}
+
+func TestDeviceBinary(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+
+	var name, prefix string
+	var data []byte
+	device.OnBinary(func(n, p string, d []byte) {
+		name, prefix, data = n, p, d
+	})
+	device.OnMessage(func(n, v string) {
+		t.Logf("Unexpected message %v %v", n, v)
+		t.Fail()
+	})
+
+	var image []byte
+	var mime string
+	device.OnAlbumArt(func(i []byte, m string) {
+		image, mime = i, m
+	})
+
+	device.handleReceived(ISCPCommand("NJA10FFD8"))
+	assertEqual(t, name, "jacket-art")
+	assertEqual(t, prefix, "10")
+	assertEqual(t, data, []byte{0xFF, 0xD8})
+
+	device.handleReceived(ISCPCommand("NJA12FFD9"))
+	assertEqual(t, image, []byte{0xFF, 0xD8, 0xFF, 0xD9})
+	assertEqual(t, mime, "image/jpeg")
+}
+
+func TestDeviceWaitResponse(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = NewBasicCommandSet([]Command{
+		{Name: "power", Group: "PWR", ParamType: "onOff", ResponseTimeout: 5 * time.Second},
+		{Name: "mute", Group: "AMT", ParamType: "onOff"},
+		{Name: "speaker-a", Group: "SPA", ParamType: "onOff", ResponseTimeout: 10 * time.Millisecond},
+	})
+	device := NewDevice(cfg)
+
+	assertEqual(t, device.responseTimeout("power"), 5*time.Second)
+	assertEqual(t, device.responseTimeout("mute"), defaultResponseTimeout)
+
+	wait := device.expect("PWR")
+	device.handleReceived("PWR01")
+	r := <-wait
+	assertNoErr(t, r.err)
+	assertEqual(t, r.value, "on")
+
+	history := device.History("power")
+	assertEqual(t, len(history), 1)
+	assertEqual(t, history[0].Value, "on")
+
+	device.unexpect("PWR", wait)
+	assertEqual(t, len(device.waiters), 0)
+
+	// not started
+	_, err := device.QuerySync("speaker-a")
+	assertErr(t, err)
+}
+
+func TestDeviceConnectAndSend(t *testing.T) {
 	device := NewDevice(testConfig())
 	server := newMockServer()
 
@@ -36,7 +138,7 @@ func xTestDeviceConnectAndSend(t *testing.T) {
 		t.Fail()
 	}
 
-	device.SendISCP(validCommand, 0)
+	device.SendISCP(validCommand, time.Second)
 
 	data, err := server.ReadRaw()
 	if err != nil {
@@ -56,6 +158,89 @@ func xTestDeviceConnectAndSend(t *testing.T) {
 		t.Logf("server did not receive expected command")
 		t.Fail()
 	}
+
+	stats := device.Stats()
+	assertEqual(t, stats.Connects, uint64(1))
+	assertEqual(t, stats.Reconnects, uint64(0))
+	assertEqual(t, stats.FramesOut, uint64(1))
+	assertEqual(t, stats.BytesOut, uint64(len(data)))
+	assertEqual(t, stats.LastSent.IsZero(), false)
+}
+
+func TestDeviceQueryCoalescing(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+	server := newMockServer()
+
+	server.Start()
+	defer server.Stop()
+
+	device.Start()
+	defer device.Stop()
+
+	if !server.WaitConnected() {
+		t.Log("initial connect failed")
+		t.Fail()
+		return
+	}
+	device.client.WaitConnect(time.Second)
+
+	assertNoErr(t, device.Query("power"))
+	// not sent again, the response is still pending
+	assertNoErr(t, device.Query("power"))
+
+	_, err := server.ReadRaw()
+	assertNoErr(t, err)
+	_, err = server.ReadRaw()
+	assertErr(t, err)
+
+	// a response ends the query
+	device.handleReceived("PWR01")
+	assertEqual(t, device.startQuery("PWR"), true)
+}
+
+func TestDeviceToggle(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+	server := newMockServer()
+
+	server.Start()
+	defer server.Stop()
+
+	device.Start()
+	defer device.Stop()
+
+	if !server.WaitConnected() {
+		t.Log("initial connect failed")
+		t.Fail()
+		return
+	}
+	device.client.WaitConnect(time.Second)
+
+	// answer the query and the command
+	received := make(chan ISCPCommand, 2)
+	go func() {
+		for _, reply := range []ISCPCommand{"PWR01", "PWR00"} {
+			data, err := server.ReadRaw()
+			if err != nil {
+				return
+			}
+			msg, _ := ParseEISCP(data)
+			received <- msg.Command()
+			server.Reply(reply)
+		}
+	}()
+
+	value, err := device.Toggle("power")
+	assertNoErr(t, err)
+	assertEqual(t, value, "off")
+	assertEqual(t, <-received, ISCPCommand("PWRQSTN"))
+	assertEqual(t, <-received, ISCPCommand("PWR00"))
+
+	_, err = device.Toggle("volume")
+	assertErr(t, err)
 }
 
 func xTestDeviceAutoConnect(t *testing.T) {
@@ -142,7 +327,7 @@ func newMockServer() *mockServer {
 	return &mockServer{
 		port:      testPort,
 		connected: make(chan bool, 1),
-		data:      make(chan []byte, 1),
+		data:      make(chan []byte, 16),
 	}
 }
 
@@ -181,12 +366,17 @@ func (m *mockServer) listen() {
 		m.conn = conn
 		m.connected <- true
 
-		buf := make([]byte, 512) // buf size should be larger than expected message size
-		numRead, err := conn.Read(buf)
+		go m.read(conn)
+	}
+}
+
+func (m *mockServer) read(conn net.Conn) {
+	for {
+		data, err := readFrame(conn)
 		if err != nil {
 			return
 		}
-		m.data <- buf[0:numRead]
+		m.data <- data
 	}
 }
 
@@ -199,6 +389,15 @@ func (m *mockServer) ReadRaw() ([]byte, error) {
 	}
 }
 
+// Reply sends a message to the client.
+func (m *mockServer) Reply(cmd ISCPCommand) error {
+	if m.conn == nil {
+		return errors.New("not connected")
+	}
+	_, err := m.conn.Write(NewEISCPMessage(cmd).Raw())
+	return err
+}
+
 // Disconnect closes the client connection
 func (m *mockServer) Disconnect() {
 	if m.conn != nil {
@@ -217,3 +416,187 @@ func (m *mockServer) Stop() {
 	}
 	m.listener = nil
 }
+
+func TestDeviceReload(t *testing.T) {
+	device := NewDevice(testConfig())
+	assertErr(t, device.Reload())
+
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "onkyoctl.ini")
+	cmdPath := filepath.Join(dir, "commands.yaml")
+	assertNoErr(t, os.WriteFile(cfgPath, []byte("CommandFile = commands.yaml\n"), 0600))
+	assertNoErr(t, os.WriteFile(cmdPath, []byte("- {name: power, group: PWR, paramtype: onOff}\n"), 0600))
+
+	cfg, err := ReadConfig(cfgPath)
+	assertNoErr(t, err)
+	device = NewDevice(cfg)
+	_, err = device.Preview("mute", "on")
+	assertErr(t, err)
+
+	assertNoErr(t, os.WriteFile(cmdPath, []byte("- {name: mute, group: AMT, paramtype: onOff}\n"), 0600))
+	assertNoErr(t, device.Reload())
+
+	cmd, err := device.Preview("mute", "on")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("AMT01"))
+}
+
+func TestDeviceOnRaw(t *testing.T) {
+	device := NewDevice(testConfig())
+
+	var raw []ISCPCommand
+	device.OnRaw(func(cmd ISCPCommand) {
+		raw = append(raw, cmd)
+	})
+	device.handleReceived("PWR01")
+	device.handleReceived("XYZ00")
+	assertEqual(t, raw, []ISCPCommand{"PWR01", "XYZ00"})
+}
+
+func TestDeviceHandleGroup(t *testing.T) {
+	device := NewDevice(testConfig())
+
+	var power, unknown []string
+	device.HandleGroup("PWR", func(param string) {
+		power = append(power, param)
+	})
+	device.HandleGroup("XYZ", func(param string) {
+		unknown = append(unknown, param)
+	})
+	device.handleReceived("PWR01")
+	device.handleReceived("XYZ00")
+	device.handleReceived("MVL20")
+	device.handleReceived("PWR00")
+	assertEqual(t, power, []string{"01", "00"})
+	assertEqual(t, unknown, []string{"00"})
+
+	// handlers can add handlers
+	var added []string
+	device.HandleGroup("MVL", func(param string) {
+		device.HandleGroup("AMT", func(param string) {
+			added = append(added, param)
+		})
+	})
+	done := make(chan bool)
+	go func() {
+		device.handleReceived("MVL20")
+		device.handleReceived("AMT01")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler deadlocked")
+	}
+	assertEqual(t, added, []string{"01"})
+}
+
+func TestDeviceState(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	cfg.HistorySize = 0
+	device := NewDevice(cfg)
+
+	_, ok := device.Value("power")
+	assertEqual(t, ok, false)
+
+	device.handleReceived("PWR01")
+	device.handleReceived("MVL14")
+	device.handleReceived("PWR00")
+	e, ok := device.Value("power")
+	assertEqual(t, ok, true)
+	assertEqual(t, e.Value, "off")
+
+	state := device.State()
+	assertEqual(t, len(state), 2)
+	assertEqual(t, state["volume"].Value, "10")
+}
+
+func TestDeviceSubscribe(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+
+	var a, b []string
+	cancel := device.Subscribe(func(m *ParsedMessage) {
+		a = append(a, m.Name+" "+m.Value)
+	})
+	device.Subscribe(func(m *ParsedMessage) {
+		b = append(b, string(m.Raw))
+	})
+
+	device.handleReceived("PWR01")
+	cancel()
+	device.handleReceived("PWR00")
+	assertEqual(t, a, []string{"power on"})
+	assertEqual(t, b, []string{"PWR01", "PWR00"})
+}
+
+func TestDeviceSubscribeFromCallback(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+
+	var once, later []string
+	var cancel func()
+	cancel = device.Subscribe(func(m *ParsedMessage) {
+		once = append(once, m.Value)
+		cancel()
+		device.Subscribe(func(m *ParsedMessage) {
+			later = append(later, m.Value)
+		})
+	})
+
+	done := make(chan bool)
+	go func() {
+		device.handleReceived("PWR01")
+		device.handleReceived("PWR00")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscriber deadlocked")
+	}
+	assertEqual(t, once, []string{"on"})
+	assertEqual(t, later, []string{"off"})
+}
+
+func TestDeviceWaitFor(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assertErr(t, device.WaitFor(ctx, "power", "maybe"))
+	// not started
+	assertErr(t, device.WaitFor(ctx, "power", "on"))
+
+	server := newMockServer()
+	server.Start()
+	defer server.Stop()
+	device.Start()
+	defer device.Stop()
+	if !server.WaitConnected() {
+		t.Log("initial connect failed")
+		t.Fail()
+		return
+	}
+	device.client.WaitConnect(time.Second)
+
+	go func() {
+		server.ReadRaw() // the query
+		server.Reply("PWR00")
+		time.Sleep(10 * time.Millisecond)
+		server.Reply("PWR01")
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assertNoErr(t, device.WaitFor(ctx, "power", true))
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assertEqual(t, device.WaitFor(ctx, "mute", "on"), ErrTimeout)
+}
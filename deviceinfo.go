@@ -0,0 +1,253 @@
+package onkyoctl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ecnGroup ISCPGroup = "ECN"
+	nriGroup ISCPGroup = "NRI"
+)
+
+// DeviceInfo describes the receiver as reported by ECN
+// (the discovery response) and NRI messages.
+// Fields the receiver did not report are empty.
+type DeviceInfo struct {
+	Model           string // e.g. "TX-NR646"
+	Region          string // destination area, e.g. "DX", "XX" or "JJ"
+	FirmwareVersion string // e.g. "1050-0000-0000-0010"
+	ISCPVersion     int    // version from the eISCP header
+	MAC             string // e.g. "0009B0123456"
+	Zones           int    // number of zones, including the main zone
+	Selectors       []Selector
+}
+
+// Selector is an input the receiver has, from the NRI selector list.
+type Selector struct {
+	ID    string // parameter for SLI, e.g. "10"
+	Name  string // name on the receiver, e.g. "BD/DVD"
+	Zones int    // bit mask of zones: 1 main, 2 zone 2, 4 zone 3, 8 zone 4
+}
+
+// InZone tells whether the selector is available in the given zone,
+// 1 for the main zone.
+func (s Selector) InZone(zone int) bool {
+	return zone > 0 && s.Zones&(1<<(zone-1)) != 0
+}
+
+// ParseECN parses the parameter of an ECN message,
+// e.g. "TX-NR646/60128/DX/0009B0123456".
+func ParseECN(param string) (*DeviceInfo, error) {
+	parts := strings.Split(strings.TrimSpace(param), "/")
+	if len(parts) != 4 || parts[0] == "" {
+		return nil, fmt.Errorf("%w %q", ErrInvalidParam, param)
+	}
+	// the MAC may be followed by padding
+	mac := strings.TrimRight(parts[3], "\x00\x19\r\n ")
+	if len(mac) > 12 {
+		mac = mac[:12]
+	}
+	return &DeviceInfo{
+		Model:  parts[0],
+		Region: parts[2],
+		MAC:    mac,
+	}, nil
+}
+
+// nriResponse is the part of the NRI XML document we are interested in.
+type nriResponse struct {
+	XMLName xml.Name `xml:"response"`
+	Device  struct {
+		ID              string `xml:"id,attr"`
+		Model           string `xml:"model"`
+		Destination     string `xml:"destination"`
+		MAC             string `xml:"macaddress"`
+		FirmwareVersion string `xml:"firmwareversion"`
+		Zones           []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"zonelist>zone"`
+		Selectors []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:"value,attr"`
+			Name  string `xml:"name,attr"`
+			Zone  string `xml:"zone,attr"`
+		} `xml:"selectorlist>selector"`
+	} `xml:"device"`
+}
+
+// ParseNRI parses the XML document of an NRI message.
+func ParseNRI(param string) (*DeviceInfo, error) {
+	var r nriResponse
+	err := xml.Unmarshal([]byte(param), &r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidParam, err)
+	}
+	info := &DeviceInfo{
+		Model:           r.Device.Model,
+		Region:          r.Device.Destination,
+		FirmwareVersion: r.Device.FirmwareVersion,
+		MAC:             r.Device.MAC,
+	}
+	if info.Model == "" {
+		info.Model = r.Device.ID
+	}
+	for _, z := range r.Device.Zones {
+		if z.Value == "1" {
+			info.Zones++
+		}
+	}
+	for _, sel := range r.Device.Selectors {
+		if sel.Value != "1" {
+			continue
+		}
+		// the zone mask is hex, e.g. "03" for main and zone 2
+		zones, err := strconv.ParseInt(sel.Zone, 16, 0)
+		if err != nil {
+			zones = 1
+		}
+		info.Selectors = append(info.Selectors, Selector{
+			ID:    strings.ToUpper(sel.ID),
+			Name:  sel.Name,
+			Zones: int(zones),
+		})
+	}
+	return info, nil
+}
+
+// merge sets the fields of i that are reported in other.
+func (i *DeviceInfo) merge(other *DeviceInfo) {
+	if other.Model != "" {
+		i.Model = other.Model
+	}
+	if other.Region != "" {
+		i.Region = other.Region
+	}
+	if other.FirmwareVersion != "" {
+		i.FirmwareVersion = other.FirmwareVersion
+	}
+	if other.MAC != "" {
+		i.MAC = other.MAC
+	}
+	if other.Zones != 0 {
+		i.Zones = other.Zones
+	}
+	if other.Selectors != nil {
+		i.Selectors = other.Selectors
+	}
+}
+
+// deviceInfo keeps what the device reported about itself.
+type deviceInfo struct {
+	current DeviceInfo
+	lock    sync.RWMutex
+}
+
+// handleDeviceInfo parses ECN and NRI messages, also if they are not
+// in the command set. It returns true if the message was handled.
+func (d *Device) handleDeviceInfo(cmd ISCPCommand) bool {
+	group, param := SplitISCP(cmd)
+	var parse func(string) (*DeviceInfo, error)
+	switch group {
+	case ecnGroup:
+		parse = ParseECN
+	case nriGroup:
+		parse = ParseNRI
+	default:
+		return false
+	}
+	if param == queryParam {
+		return true
+	}
+
+	info, err := parse(param)
+	if err != nil {
+		d.log.Warning("Error reading device info: %v", err)
+		return true
+	}
+	d.hardware.lock.Lock()
+	d.hardware.current.merge(info)
+	d.hardware.lock.Unlock()
+	if info.Selectors != nil {
+		d.setSelectorLabels(info.Selectors)
+	}
+	return true
+}
+
+// setSelectorLabels uses the names of the selectors on the receiver,
+// e.g. "Apple TV", as labels for the input values.
+// Names that are already used for another input are ignored,
+// they would make the input ambiguous.
+func (d *Device) setSelectorLabels(selectors []Selector) {
+	d.commandsLock.Lock()
+	defer d.commandsLock.Unlock()
+
+	var c Command
+	if l, ok := d.baseCommands.(commandLookup); ok {
+		c, _ = l.ForGroup("SLI")
+	}
+	taken := make(map[string]bool)
+	for _, value := range c.Lookup {
+		taken[value] = true
+	}
+	for alias := range c.Aliases {
+		taken[alias] = true
+	}
+	for _, label := range d.inputLabels {
+		taken[strings.ToLower(label)] = true
+	}
+
+	names := make(map[string]string)
+	count := make(map[string]int)
+	for _, sel := range selectors {
+		value, ok := c.Lookup[sel.ID]
+		name := strings.TrimSpace(sel.Name)
+		if !ok || name == "" || strings.ToLower(name) == value {
+			continue
+		}
+		// the config wins over the receiver
+		if _, ok := d.inputLabels[value]; ok {
+			continue
+		}
+		names[value] = name
+		count[strings.ToLower(name)]++
+	}
+
+	labels := make(map[string]string, len(names))
+	for value, name := range names {
+		label := strings.ToLower(name)
+		if taken[label] || count[label] > 1 {
+			d.log.Warning("Ignoring selector name %q for %v, the name is used for another input", name, value)
+			continue
+		}
+		labels[value] = name
+	}
+	d.selectorLabels = labels
+	d.applyCommands()
+}
+
+// Info returns what the device reported about itself.
+// Use RequestInfo to ask the device for the information.
+func (d *Device) Info() DeviceInfo {
+	d.hardware.lock.RLock()
+	info := d.hardware.current
+	d.hardware.lock.RUnlock()
+	info.ISCPVersion = d.client.iscpVersion()
+	return info
+}
+
+// RequestInfo asks the device for its model, firmware version and zones.
+// The responses are available from Info.
+func (d *Device) RequestInfo() error {
+	for _, group := range []ISCPGroup{ecnGroup, nriGroup} {
+		err := d.SendISCP(ISCPCommand(string(group)+queryParam), 0)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package onkyoctl
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testNRI = `<?xml version="1.0" encoding="utf-8"?>
+<response status="ok">
+<device id="TX-NR646">
+<brand>ONKYO</brand>
+<model>TX-NR646</model>
+<destination>DX</destination>
+<macaddress>0009B0123456</macaddress>
+<firmwareversion>1050-0000-0000-0010</firmwareversion>
+<zonelist count="4">
+<zone id="1" value="1" name="Main" volmax="82"/>
+<zone id="2" value="1" name="Zone2" volmax="82"/>
+<zone id="3" value="0" name="Zone3" volmax="0"/>
+<zone id="4" value="0" name="Zone4" volmax="0"/>
+</zonelist>
+<selectorlist count="4">
+<selector id="10" value="1" name="BD/DVD" zone="03" iconid="10"/>
+<selector id="01" value="1" name="CBL/SAT" zone="01" iconid="01"/>
+<selector id="2b" value="1" name="NET" zone="03" iconid="2b"/>
+<selector id="22" value="0" name="PHONO" zone="00" iconid="22"/>
+</selectorlist>
+</device>
+</response>`
+
+func TestParseECN(t *testing.T) {
+	info, err := ParseECN("TX-NR646/60128/DX/0009B0123456\x19")
+	assertNoErr(t, err)
+	assertEqual(t, info.Model, "TX-NR646")
+	assertEqual(t, info.Region, "DX")
+	assertEqual(t, info.MAC, "0009B0123456")
+
+	_, err = ParseECN("TX-NR646")
+	assertErr(t, err)
+}
+
+func TestParseNRI(t *testing.T) {
+	info, err := ParseNRI(testNRI)
+	assertNoErr(t, err)
+	assertEqual(t, info.Model, "TX-NR646")
+	assertEqual(t, info.Region, "DX")
+	assertEqual(t, info.MAC, "0009B0123456")
+	assertEqual(t, info.FirmwareVersion, "1050-0000-0000-0010")
+	assertEqual(t, info.Zones, 2)
+	assertEqual(t, info.Selectors, []Selector{
+		{ID: "10", Name: "BD/DVD", Zones: 3},
+		{ID: "01", Name: "CBL/SAT", Zones: 1},
+		{ID: "2B", Name: "NET", Zones: 3},
+	})
+	assertEqual(t, info.Selectors[1].InZone(1), true)
+	assertEqual(t, info.Selectors[1].InZone(2), false)
+
+	_, err = ParseNRI("<response")
+	assertErr(t, err)
+}
+
+func TestDeviceInfo(t *testing.T) {
+	device := NewDevice(testConfig())
+	assertEqual(t, device.Info(), DeviceInfo{})
+
+	device.handleReceived("ECNTX-NR646/60128/DX/0009B0123456")
+	assertEqual(t, device.Info().Model, "TX-NR646")
+	assertEqual(t, device.Info().Zones, 0)
+
+	device.handleReceived(ISCPCommand("NRI" + testNRI))
+	info := device.Info()
+	assertEqual(t, info.MAC, "0009B0123456")
+	assertEqual(t, info.FirmwareVersion, "1050-0000-0000-0010")
+	assertEqual(t, info.Zones, 2)
+
+	device.client.setVersion(NewEISCPMessage("PWR01").Raw())
+	assertEqual(t, device.Info().ISCPVersion, 1)
+}
+
+func TestSupportedInputs(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+
+	// everything is allowed before the device reports its selectors
+	assertEqual(t, device.SupportedInputs(1), []string(nil))
+	_, err := device.Preview("input", "phono")
+	assertNoErr(t, err)
+
+	device.handleReceived(ISCPCommand("NRI" + testNRI))
+	// with the names from the receiver
+	assertEqual(t, device.SupportedInputs(1), []string{"bd/dvd", "cbl/sat", "net"})
+	assertEqual(t, device.SupportedInputs(2), []string{"bd/dvd", "net"})
+
+	cmd, err := device.Preview("input", "dvd")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SLI10"))
+	_, err = device.Preview("input", "up")
+	assertNoErr(t, err)
+
+	_, err = device.Preview("input", "phono")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+	assertEqual(t, strings.Contains(err.Error(), "bd/dvd, cbl/sat, net"), true)
+}
+
+func TestSelectorLabels(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = ExtendedCommands()
+	// the config wins over the receiver
+	cfg.InputLabels = "dvd:Blu-ray"
+	device := NewDevice(cfg)
+
+	nri := strings.Replace(testNRI, `name="CBL/SAT"`, `name="Apple TV"`, 1)
+	device.handleReceived(ISCPCommand("NRI" + nri))
+
+	cmd, err := device.Preview("input", "apple tv")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SLI01"))
+	// the old name still works
+	cmd, err = device.Preview("input", "cbl-sat")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SLI01"))
+	cmd, err = device.Preview("input-zone2", "net")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SLZ2B"))
+
+	msg, err := device.ParseMessage("SLI01")
+	assertNoErr(t, err)
+	assertEqual(t, msg.Value, "apple tv")
+	msg, err = device.ParseMessage("SLI10")
+	assertNoErr(t, err)
+	assertEqual(t, msg.Value, "blu-ray")
+}
+
+func TestSelectorLabelsCollision(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = ExtendedCommands()
+	cfg.InputLabels = "cd:Blu-ray"
+	device := NewDevice(cfg)
+
+	// same as a configured label
+	nri := strings.Replace(testNRI, `value="0" name="PHONO" zone="00"`, `value="1" name="Blu-ray" zone="01"`, 1)
+	// same as an existing value
+	nri = strings.Replace(nri, `name="BD/DVD"`, `name="Phono"`, 1)
+	// same as another selector
+	nri = strings.Replace(nri, `name="CBL/SAT"`, `name="Kodi"`, 1)
+	nri = strings.Replace(nri, `name="NET"`, `name="kodi"`, 1)
+	device.handleReceived(ISCPCommand("NRI" + nri))
+
+	cmd, err := device.Preview("input", "phono")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SLI22"))
+	_, err = device.Preview("input", "kodi")
+	assertErr(t, err)
+
+	for cmd, expected := range map[ISCPCommand]string{
+		"SLI10": "dvd",
+		"SLI01": "cbl-sat",
+		"SLI2B": "network",
+		"SLI22": "phono",
+		"SLI23": "blu-ray",
+	} {
+		msg, err := device.ParseMessage(cmd)
+		assertNoErr(t, err)
+		assertEqual(t, msg.Value, expected)
+	}
+}
@@ -0,0 +1,71 @@
+package onkyoctl
+
+import "sync"
+
+const defaultCallbackQueueSize = 256
+
+// dispatcher runs callbacks one at a time, in the order they were posted.
+//
+// A slow callback delays the ones after it, but not the client loop.
+// When more than size callbacks are pending, new ones are dropped.
+// The goroutine that runs the callbacks exits when the queue is empty.
+type dispatcher struct {
+	queue   []func()
+	size    int
+	running bool
+	onPanic func(r interface{})
+	lock    sync.Mutex
+}
+
+// newDispatcher creates a dispatcher for up to size pending callbacks.
+// onPanic is called if a callback panics.
+func newDispatcher(size int, onPanic func(r interface{})) *dispatcher {
+	if size <= 0 {
+		size = defaultCallbackQueueSize
+	}
+	return &dispatcher{size: size, onPanic: onPanic}
+}
+
+// post adds a callback to the queue.
+// Returns false if the queue is full and the callback was dropped.
+func (d *dispatcher) post(fn func()) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.queue) >= d.size {
+		return false
+	}
+	d.queue = append(d.queue, fn)
+	if !d.running {
+		d.running = true
+		go d.run()
+	}
+	return true
+}
+
+func (d *dispatcher) run() {
+	for {
+		d.lock.Lock()
+		if len(d.queue) == 0 {
+			d.running = false
+			d.lock.Unlock()
+			return
+		}
+		fn := d.queue[0]
+		d.queue[0] = nil
+		d.queue = d.queue[1:]
+		d.lock.Unlock()
+
+		d.call(fn)
+	}
+}
+
+// call runs a callback, a panic does not stop the dispatcher.
+func (d *dispatcher) call(fn func()) {
+	defer func() {
+		r := recover()
+		if r != nil && d.onPanic != nil {
+			d.onPanic(r)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,79 @@
+package onkyoctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDispatcherOrder(t *testing.T) {
+	d := newDispatcher(100, nil)
+	results := make(chan int, 100)
+	for i := 0; i < 100; i++ {
+		n := i
+		assertEqual(t, d.post(func() {
+			results <- n
+		}), true)
+	}
+	for i := 0; i < 100; i++ {
+		select {
+		case n := <-results:
+			assertEqual(t, n, i)
+		case <-time.After(time.Second):
+			t.Fatal("Callback was not called")
+		}
+	}
+}
+
+func TestDispatcherFull(t *testing.T) {
+	d := newDispatcher(2, nil)
+	block := make(chan bool)
+	started := make(chan bool)
+	d.post(func() {
+		started <- true
+		<-block
+	})
+	<-started
+
+	// the blocked callback is no longer in the queue
+	assertEqual(t, d.post(func() {}), true)
+	assertEqual(t, d.post(func() {}), true)
+	assertEqual(t, d.post(func() {}), false)
+	close(block)
+}
+
+func TestDispatcherPanic(t *testing.T) {
+	panics := make(chan interface{}, 1)
+	d := newDispatcher(0, func(r interface{}) {
+		panics <- r
+	})
+	done := make(chan bool)
+	d.post(func() {
+		panic("callback failure")
+	})
+	d.post(func() {
+		done <- true
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Dispatcher stopped after panic")
+	}
+	assertEqual(t, <-panics, "callback failure")
+}
+
+func TestDroppedCallbacks(t *testing.T) {
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	c.setCallbackQueue(1)
+	block := make(chan bool)
+	defer close(block)
+	c.handler = func(cmd ISCPCommand) {
+		<-block
+	}
+
+	c.doReceive("PWR01")
+	time.Sleep(10 * time.Millisecond)
+	c.doReceive("PWR00")
+	c.doReceive("PWR01")
+	assertEqual(t, c.stats.get().DroppedCallbacks, uint64(1))
+}
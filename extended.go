@@ -0,0 +1,544 @@
+package onkyoctl
+
+import (
+	"fmt"
+)
+
+// ExtendedCommands creates a command set with the commands from
+// BasicCommands and additional commands for tuner, zones and settings
+// that are not available on every receiver.
+func ExtendedCommands() CommandSet {
+	return NewBasicCommandSet(append(basicCommands(), extendedCommands()...))
+}
+
+func extendedCommands() []Command {
+	commands := []Command{
+		{
+			Name:      "tuning",
+			Category:  "tuner",
+			Group:     "TUN",
+			ParamType: "frequency",
+			Lookup: map[string]string{
+				"UP":   "up",
+				"DOWN": "down",
+			},
+		},
+		{
+			Name:      "tuning-zone2",
+			Category:  "zone2",
+			Group:     "TUZ",
+			ParamType: "frequency",
+			Lookup: map[string]string{
+				"UP":   "up",
+				"DOWN": "down",
+			},
+		},
+		{
+			Name:      "preset",
+			Category:  "tuner",
+			Group:     "PRS",
+			ParamType: "intRangeEnum",
+			Lower:     1,
+			Upper:     40,
+			Lookup: map[string]string{
+				"UP":   "up",
+				"DOWN": "down",
+			},
+		},
+		{
+			// stores the current station as preset
+			Name:      "preset-store",
+			Category:  "tuner",
+			Group:     "PRM",
+			ParamType: "intRange",
+			Lower:     1,
+			Upper:     40,
+		},
+		{
+			Name:      "preset-zone2",
+			Category:  "zone2",
+			Group:     "PRZ",
+			ParamType: "intRangeEnum",
+			Lower:     1,
+			Upper:     40,
+			Lookup: map[string]string{
+				"UP":   "up",
+				"DOWN": "down",
+			},
+		},
+		{
+			Name:      "hdmi-out",
+			Category:  "video",
+			Group:     "HDO",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "no",
+				"01": "main",
+				"02": "sub",
+				"03": "both",
+				"04": "both-main",
+				"05": "both-sub",
+				"UP": "cycle",
+			},
+		},
+		{
+			Name:      "hdmi-audio-out",
+			Category:  "audio",
+			Group:     "HAO",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "on",
+				"02": "auto",
+				"UP": "cycle",
+			},
+		},
+		{
+			Name:      "hdmi-audio-out-sub",
+			Category:  "audio",
+			Group:     "HAS",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "on",
+				"UP": "cycle",
+			},
+		},
+		{
+			Name:      "audio-info",
+			Category:  "info",
+			Group:     "IFA",
+			ParamType: "text",
+		},
+		{
+			Name:      "video-info",
+			Category:  "info",
+			Group:     "IFV",
+			ParamType: "text",
+		},
+		{
+			Name:      "hdmi-cec",
+			Category:  "system",
+			Group:     "CEC",
+			ParamType: "onOff",
+		},
+		{
+			Name:      "cec-control-monitor",
+			Category:  "system",
+			Group:     "CCM",
+			ParamType: "onOff",
+		},
+		{
+			Name:      "hdmi-arc",
+			Category:  "audio",
+			Group:     "CCX",
+			ParamType: "onOff",
+		},
+		// most models change the tone in 2 dB steps,
+		// use a command file with Step 1 for the others
+		{
+			Name:      "tone",
+			Category:  "audio",
+			Group:     "TFR",
+			ParamType: "tone",
+			Lower:     -10,
+			Upper:     10,
+			Step:      2,
+		},
+		{
+			Name:      "tone-center",
+			Category:  "audio",
+			Group:     "TCT",
+			ParamType: "tone",
+			Lower:     -10,
+			Upper:     10,
+			Step:      2,
+		},
+		{
+			Name:      "tone-front-wide",
+			Category:  "audio",
+			Group:     "TFW",
+			ParamType: "tone",
+			Lower:     -10,
+			Upper:     10,
+			Step:      2,
+		},
+		{
+			Name:      "subwoofer-level",
+			Category:  "audio",
+			Group:     "SWL",
+			ParamType: "signedRange",
+			Lower:     -15,
+			Upper:     12,
+			Lookup: map[string]string{
+				"UP":   "up",
+				"DOWN": "down",
+			},
+		},
+		{
+			Name:      "subwoofer2-level",
+			Category:  "audio",
+			Group:     "SW2",
+			ParamType: "signedRange",
+			Lower:     -15,
+			Upper:     12,
+			Lookup: map[string]string{
+				"UP":   "up",
+				"DOWN": "down",
+			},
+		},
+		{
+			Name:      "center-level",
+			Category:  "audio",
+			Group:     "CTL",
+			ParamType: "signedRange",
+			Lower:     -12,
+			Upper:     12,
+			Scale:     2,
+			Lookup: map[string]string{
+				"UP":   "up",
+				"DOWN": "down",
+			},
+		},
+		{
+			Name:      "av-sync",
+			Category:  "audio",
+			Group:     "AVS",
+			ParamType: "milliseconds",
+			Lower:     0,
+			Upper:     800,
+			Step:      5,
+			Lookup: map[string]string{
+				"UP":   "up",
+				"DOWN": "down",
+			},
+		},
+		{
+			Name:      "music-optimizer",
+			Category:  "audio",
+			Group:     "MOT",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "on",
+				"UP": "cycle",
+			},
+		},
+		{
+			Name:      "pqls",
+			Category:  "audio",
+			Group:     "PQL",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "on",
+				"UP": "cycle",
+			},
+		},
+		{
+			Name:      "re-eq",
+			Category:  "audio",
+			Group:     "RAS",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "on",
+				"02": "academy",
+				"UP": "cycle",
+			},
+		},
+		{
+			Name:      "late-night",
+			Category:  "audio",
+			Group:     "LTN",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "low",
+				"02": "high",
+				"03": "auto",
+				"UP": "cycle",
+			},
+		},
+		{
+			Name:      "speaker-layout",
+			Category:  "audio",
+			Group:     "SPL",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"SB": "surround-back",
+				"FH": "front-high",
+				"FW": "front-wide",
+				"HW": "front-high-wide",
+				"UP": "cycle",
+			},
+		},
+		{
+			// channel level in dB, -12 to +12 in 0.5 dB steps
+			Name:      "channel-levels",
+			Category:  "audio",
+			Group:     "TCL",
+			ParamType: "signedRange",
+			Lower:     -12,
+			Upper:     12,
+			Scale:     2,
+		},
+		{
+			// the delay depends on the model (e.g. 20 or 30 minutes),
+			// use a command file for models with selectable delays
+			Name:      "auto-powerdown",
+			Category:  "system",
+			Group:     "APD",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "on",
+				"UP": "cycle",
+			},
+		},
+		{
+			Name:      "osd",
+			Category:  "system",
+			Group:     "OSD",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"MENU":  "menu",
+				"UP":    "up",
+				"DOWN":  "down",
+				"LEFT":  "left",
+				"RIGHT": "right",
+				"ENTER": "enter",
+				"EXIT":  "exit",
+				"HOME":  "home",
+				"QUICK": "quick",
+				"AUDIO": "audio",
+				"VIDEO": "video",
+			},
+		},
+		{
+			Name:      "network-control",
+			Category:  "network",
+			Group:     "NTC",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"PLAY":    "play",
+				"STOP":    "stop",
+				"PAUSE":   "pause",
+				"P/P":     "play-pause",
+				"TRUP":    "next",
+				"TRDN":    "previous",
+				"FF":      "fast-forward",
+				"REW":     "rewind",
+				"REPEAT":  "repeat",
+				"RANDOM":  "random",
+				"DISPLAY": "display",
+			},
+		},
+		{
+			// the service followed by the account, e.g. "spotify 1"
+			Name:      "network-service",
+			Category:  "network",
+			Group:     "NSV",
+			ParamType: "enumIndex",
+			Lower:     0,
+			Upper:     9,
+			Lookup: map[string]string{
+				"00": "dlna",
+				"01": "favorites",
+				"02": "vtuner",
+				"03": "siriusxm",
+				"04": "pandora",
+				"05": "rhapsody",
+				"06": "last.fm",
+				"07": "napster",
+				"08": "slacker",
+				"09": "mediafly",
+				"0A": "spotify",
+				"0B": "aupeo",
+				"0C": "radiko",
+				"0D": "e-onkyo",
+				"0E": "tunein",
+				"0F": "mp3tunes",
+				"10": "simfy",
+				"11": "home-media",
+				"12": "deezer",
+				"13": "iheartradio",
+				"18": "airplay",
+				"1A": "onkyo-music",
+				"1B": "tidal",
+				"41": "fireconnect",
+				"F0": "usb",
+				"F1": "usb-rear",
+				"F2": "internet-radio",
+				"F3": "net",
+			},
+		},
+		{
+			// "connect" reconnects the last paired device,
+			// select the "bluetooth" input to play from it
+			Name:      "bluetooth",
+			Category:  "network",
+			Group:     "NBT",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"PAIRING":    "pairing",
+				"CLEAR":      "clear-pairing",
+				"CONNECT":    "connect",
+				"DISCONNECT": "disconnect",
+			},
+		},
+		{
+			Name:      "trigger-a",
+			Category:  "system",
+			Group:     "TGA",
+			ParamType: "onOff",
+		},
+		{
+			Name:      "trigger-b",
+			Category:  "system",
+			Group:     "TGB",
+			ParamType: "onOff",
+		},
+		{
+			Name:      "trigger-c",
+			Category:  "system",
+			Group:     "TGC",
+			ParamType: "onOff",
+		},
+		{
+			Name:      "audyssey",
+			Category:  "audio",
+			Group:     "ADY",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "movie",
+				"02": "music",
+				"UP": "cycle",
+			},
+			Aliases: map[string]string{
+				"on": "movie",
+			},
+		},
+		{
+			Name:      "dynamic-eq",
+			Category:  "audio",
+			Group:     "ADQ",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "on",
+				"UP": "cycle",
+			},
+		},
+		{
+			Name:      "dynamic-volume",
+			Category:  "audio",
+			Group:     "ADV",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "light",
+				"02": "medium",
+				"03": "heavy",
+				"UP": "cycle",
+			},
+		},
+		{
+			// AccuEQ on newer models, instead of Audyssey
+			Name:      "accueq",
+			Category:  "audio",
+			Group:     "AEQ",
+			ParamType: "enum",
+			Lookup: map[string]string{
+				"00": "off",
+				"01": "on",
+				"02": "on-except-front",
+				"UP": "cycle",
+			},
+		},
+		{
+			// dialog enhancement, the range depends on the model
+			Name:      "dialog-level",
+			Category:  "audio",
+			Group:     "DVL",
+			ParamType: "intRangeEnum",
+			Lower:     0,
+			Upper:     6,
+			Lookup: map[string]string{
+				"UP":   "up",
+				"DOWN": "down",
+			},
+		},
+		{
+			// temporary center level (vocal), like center-level
+			// but not saved with the speaker setup
+			Name:      "vocal-level",
+			Category:  "audio",
+			Group:     "CTV",
+			ParamType: "signedRange",
+			Lower:     -12,
+			Upper:     12,
+			Scale:     2,
+			Lookup: map[string]string{
+				"UP":   "up",
+				"DOWN": "down",
+			},
+		},
+	}
+	return append(commands, zoneCommands()...)
+}
+
+// zoneCommands creates power, volume, mute and input for zones 2 to 4,
+// named e.g. "volume-zone2", see Device.Zone.
+func zoneCommands() []Command {
+	zones := []struct {
+		zone                       int
+		power, volume, mute, input ISCPGroup
+	}{
+		{2, "ZPW", "ZVL", "ZMT", "SLZ"},
+		{3, "PW3", "VL3", "MT3", "SL3"},
+		{4, "PW4", "VL4", "MT4", "SL4"},
+	}
+	commands := make([]Command, 0, 4*len(zones))
+	for _, z := range zones {
+		category := fmt.Sprintf("zone%d", z.zone)
+		suffix := "-" + category
+		commands = append(commands,
+			Command{
+				Name:      "power" + suffix,
+				Category:  category,
+				Group:     z.power,
+				ParamType: "onOff",
+				Priority:  PriorityHigh,
+			},
+			Command{
+				Name:      "volume" + suffix,
+				Category:  category,
+				Group:     z.volume,
+				ParamType: "intRangeEnum",
+				Lower:     0,
+				Upper:     100,
+				Lookup: map[string]string{
+					"UP":   "up",
+					"DOWN": "down",
+				},
+			},
+			Command{
+				Name:      "mute" + suffix,
+				Category:  category,
+				Group:     z.mute,
+				ParamType: "onOffToggle",
+				Priority:  PriorityHigh,
+			},
+			Command{
+				Name:      "input" + suffix,
+				Category:  category,
+				Group:     z.input,
+				ParamType: "enum",
+				Lookup:    inputSelectors,
+			},
+		)
+	}
+	return commands
+}
@@ -0,0 +1,261 @@
+package onkyoctl
+
+import (
+	"testing"
+)
+
+func TestExtendedCommands(t *testing.T) {
+	commands := ExtendedCommands()
+	assertEqual(t, len(ListCommands(commands)), len(basicCommands())+len(extendedCommands()))
+
+	cmd, err := commands.CreateCommand("preset", 12)
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("PRS0C"))
+
+	name, value, err := commands.ReadCommand("TUN10110")
+	assertNoErr(t, err)
+	assertEqual(t, name, "tuning")
+	assertEqual(t, value, "101.1 MHz")
+}
+
+func TestHDMICommands(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("hdmi-out", "sub")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("HDO02"))
+
+	name, value, err := commands.ReadCommand("HAO02")
+	assertNoErr(t, err)
+	assertEqual(t, name, "hdmi-audio-out")
+	assertEqual(t, value, "auto")
+}
+
+func TestCECCommands(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("hdmi-cec", "off")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("CEC00"))
+
+	name, value, err := commands.ReadCommand("CCX01")
+	assertNoErr(t, err)
+	assertEqual(t, name, "hdmi-arc")
+	assertEqual(t, value, "on")
+}
+
+func TestSubwooferLevel(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("subwoofer-level", -3)
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SWL-3"))
+
+	cmd, err = commands.CreateCommand("subwoofer2-level", "up")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SW2UP"))
+
+	name, value, err := commands.ReadCommand("SWL+C")
+	assertNoErr(t, err)
+	assertEqual(t, name, "subwoofer-level")
+	assertEqual(t, value, "12")
+}
+
+func TestCenterLevel(t *testing.T) {
+	commands := ExtendedCommands()
+
+	// half dB steps
+	cmd, err := commands.CreateCommand("center-level", 2.5)
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("CTL+5"))
+
+	cmd, err = commands.CreateCommand("center-level", "-12")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("CTL-18"))
+
+	_, err = commands.CreateCommand("center-level", 1.25)
+	assertErr(t, err)
+
+	_, value, err := commands.ReadCommand("CTL+3")
+	assertNoErr(t, err)
+	assertEqual(t, value, "1.5")
+}
+
+func TestDSPCommands(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("music-optimizer", "on")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("MOT01"))
+
+	cmd, err = commands.CreateCommand("pqls", "cycle")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("PQLUP"))
+
+	name, value, err := commands.ReadCommand("RAS02")
+	assertNoErr(t, err)
+	assertEqual(t, name, "re-eq")
+	assertEqual(t, value, "academy")
+}
+
+func TestLateNight(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("late-night", "high")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("LTN02"))
+
+	_, value, err := commands.ReadCommand("LTN03")
+	assertNoErr(t, err)
+	assertEqual(t, value, "auto")
+}
+
+func TestSpeakerCommands(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("speaker-layout", "front-high")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("SPLFH"))
+
+	cmd, err = commands.CreateCommand("channel-levels", 3.5)
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("TCL+7"))
+	cmd, err = commands.CreateCommand("channel-levels", "-12")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("TCL-18"))
+
+	_, value, err := commands.ReadCommand("TCL-3")
+	assertNoErr(t, err)
+	assertEqual(t, value, "-1.5")
+
+	for _, raw := range []interface{}{12.5, -13, "+2-100+1", "loud"} {
+		_, err = commands.CreateCommand("channel-levels", raw)
+		assertErr(t, err)
+	}
+}
+
+func TestAutoPowerDown(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("auto-powerdown", "off")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("APD00"))
+}
+
+func TestOSD(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("osd", "menu")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("OSDMENU"))
+
+	cmd, err = commands.CreateCommand("osd", "Enter")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("OSDENTER"))
+}
+
+func TestNetworkControl(t *testing.T) {
+	cmd, err := ExtendedCommands().CreateCommand("network-control", "play-pause")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("NTCP/P"))
+}
+
+func TestBluetooth(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("bluetooth", "pairing")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("NBTPAIRING"))
+
+	cmd, err = commands.CreateCommand("bluetooth", "clear-pairing")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("NBTCLEAR"))
+
+	cmd, err = commands.CreateCommand("bluetooth", "connect")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("NBTCONNECT"))
+
+	cmd, err = commands.CreateCommand("bluetooth", "disconnect")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("NBTDISCONNECT"))
+
+	_, value, err := commands.ReadCommand("NBTDISCONNECT")
+	assertNoErr(t, err)
+	assertEqual(t, value, "disconnect")
+}
+
+func TestPresetStore(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("preset-store", 12)
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("PRM0C"))
+
+	_, err = commands.CreateCommand("preset-store", 0)
+	assertErr(t, err)
+	_, err = commands.CreateCommand("preset-store", 41)
+	assertErr(t, err)
+}
+
+func TestTriggers(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("trigger-b", "on")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("TGB01"))
+
+	name, value, err := commands.ReadCommand("TGC00")
+	assertNoErr(t, err)
+	assertEqual(t, name, "trigger-c")
+	assertEqual(t, value, "off")
+}
+
+func TestRoomCorrection(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("audyssey", "on")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("ADY01"))
+
+	cmd, err = commands.CreateCommand("accueq", "off")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("AEQ00"))
+
+	_, value, err := commands.ReadCommand("ADV02")
+	assertNoErr(t, err)
+	assertEqual(t, value, "medium")
+}
+
+func TestDialogCommands(t *testing.T) {
+	commands := ExtendedCommands()
+
+	cmd, err := commands.CreateCommand("dialog-level", 3)
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("DVL03"))
+
+	cmd, err = commands.CreateCommand("vocal-level", "+4")
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("CTV+8"))
+
+	_, err = commands.CreateCommand("dialog-level", 7)
+	assertErr(t, err)
+}
+
+func TestToneCommands(t *testing.T) {
+	commands := ExtendedCommands()
+
+	for name, expected := range map[string]ISCPCommand{
+		"tone":            "TFRB+2T-4",
+		"tone-center":     "TCTB+2T-4",
+		"tone-front-wide": "TFWB+2T-4",
+	} {
+		cmd, err := commands.CreateCommand(name, "bass 2 treble -3")
+		assertNoErr(t, err)
+		assertEqual(t, cmd, expected)
+	}
+
+	name, value, err := commands.ReadCommand("TCTB+4T00")
+	assertNoErr(t, err)
+	assertEqual(t, name, "tone-center")
+	assertEqual(t, value, "bass 4 treble 0")
+}
@@ -0,0 +1,105 @@
+package onkyoctl
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const updateGroup ISCPGroup = "UPD"
+
+// ErrNotConfirmed is returned by StartFirmwareUpdate without confirmation.
+var ErrNotConfirmed = errors.New("firmware update not confirmed")
+
+// Sources for StartFirmwareUpdate.
+const (
+	FirmwareNetwork = "net"
+	FirmwareUSB     = "usb"
+)
+
+// States of a firmware update, see FirmwareStatus.
+const (
+	FirmwareCurrent   = "no-new-firmware"
+	FirmwareAvailable = "new-firmware"
+	FirmwareUpdating  = "updating"
+	FirmwareComplete  = "complete"
+	FirmwareFailed    = "error"
+)
+
+// FirmwareStatus describes the firmware update state from an UPD message.
+// Progress is the progress of a running update in percent,
+// Code is the error code of a failed update.
+type FirmwareStatus struct {
+	State    string
+	Progress int
+	Code     string
+}
+
+// FirmwareCallback receives changes of the firmware update state.
+type FirmwareCallback func(FirmwareStatus)
+
+// ParseFirmwareStatus parses the parameter of an UPD message,
+// e.g. "01" (new firmware available), "D45" (45% done),
+// "CMP" (complete) or "E01-02" (failed).
+func ParseFirmwareStatus(param string) (FirmwareStatus, error) {
+	switch {
+	case param == "00":
+		return FirmwareStatus{State: FirmwareCurrent}, nil
+	case param == "01":
+		return FirmwareStatus{State: FirmwareAvailable}, nil
+	case param == "CMP":
+		return FirmwareStatus{State: FirmwareComplete, Progress: 100}, nil
+	case strings.HasPrefix(param, "E") && len(param) > 1:
+		return FirmwareStatus{State: FirmwareFailed, Code: param[1:]}, nil
+	case strings.HasPrefix(param, "D"):
+		progress, err := strconv.Atoi(param[1:])
+		if err != nil || progress < 0 || progress > 100 {
+			return FirmwareStatus{}, fmt.Errorf("%w %q", ErrInvalidParam, param)
+		}
+		return FirmwareStatus{State: FirmwareUpdating, Progress: progress}, nil
+	}
+	return FirmwareStatus{}, fmt.Errorf("%w %q", ErrInvalidParam, param)
+}
+
+// OnFirmwareStatus sets a callback for the firmware update state,
+// e.g. to show the progress of StartFirmwareUpdate.
+func (d *Device) OnFirmwareStatus(callback FirmwareCallback) {
+	d.onFirmware = callback
+}
+
+// StartFirmwareUpdate starts a firmware update from the network
+// (FirmwareNetwork) or from a USB stick (FirmwareUSB).
+//
+// The receiver is unusable while the update runs and must not be switched
+// off, so the update only starts if confirm is true.
+// The update commands are not part of the command set,
+// which means they cannot be sent by accident with SendCommand.
+func (d *Device) StartFirmwareUpdate(source string, confirm bool) error {
+	if !confirm {
+		return ErrNotConfirmed
+	}
+	switch source {
+	case FirmwareNetwork, FirmwareUSB:
+	default:
+		return fmt.Errorf("%w %q", ErrInvalidParam, source)
+	}
+
+	d.log.Warning("Starting firmware update from %v", source)
+	cmd := ISCPCommand(string(updateGroup) + strings.ToUpper(source))
+	return d.SendISCP(cmd, defaultResponseTimeout)
+}
+
+// handleFirmware reports UPD messages to the firmware callback.
+func (d *Device) handleFirmware(cmd ISCPCommand) {
+	group, param := SplitISCP(cmd)
+	if group != updateGroup || d.onFirmware == nil {
+		return
+	}
+	status, err := ParseFirmwareStatus(param)
+	if err != nil {
+		d.log.Debug("Error reading firmware status: %v", err)
+		return
+	}
+	d.onFirmware(status)
+}
@@ -0,0 +1,71 @@
+package onkyoctl
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseFirmwareStatus(t *testing.T) {
+	valid := map[string]FirmwareStatus{
+		"00":     {State: FirmwareCurrent},
+		"01":     {State: FirmwareAvailable},
+		"D45":    {State: FirmwareUpdating, Progress: 45},
+		"CMP":    {State: FirmwareComplete, Progress: 100},
+		"E01-02": {State: FirmwareFailed, Code: "01-02"},
+	}
+	for param, expected := range valid {
+		status, err := ParseFirmwareStatus(param)
+		assertNoErr(t, err)
+		assertEqual(t, status, expected)
+	}
+
+	for _, param := range []string{"", "02", "D", "D120", "E"} {
+		_, err := ParseFirmwareStatus(param)
+		assertErr(t, err)
+	}
+}
+
+func TestStartFirmwareUpdate(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = ExtendedCommands()
+	device := NewDevice(cfg)
+
+	err := device.StartFirmwareUpdate(FirmwareNetwork, false)
+	assertEqual(t, errors.Is(err, ErrNotConfirmed), true)
+	err = device.StartFirmwareUpdate("floppy", true)
+	assertErr(t, err)
+
+	// not possible with the command set
+	_, err = device.Preview("update", "net")
+	assertErr(t, err)
+
+	server := newMockServer()
+	server.Start()
+	defer server.Stop()
+	device.Start()
+	defer device.Stop()
+	if !server.WaitConnected() {
+		t.Fatal("initial connect failed")
+	}
+	device.client.WaitConnect(time.Second)
+
+	assertNoErr(t, device.StartFirmwareUpdate(FirmwareNetwork, true))
+	data, err := server.ReadRaw()
+	assertNoErr(t, err)
+	msg, err := ParseEISCP(data)
+	assertNoErr(t, err)
+	assertEqual(t, msg.Command(), ISCPCommand("UPDNET"))
+}
+
+func TestDeviceFirmwareStatus(t *testing.T) {
+	device := NewDevice(testConfig())
+
+	var status FirmwareStatus
+	device.OnFirmwareStatus(func(s FirmwareStatus) {
+		status = s
+	})
+	device.handleReceived("UPDD12")
+	assertEqual(t, status.State, FirmwareUpdating)
+	assertEqual(t, status.Progress, 12)
+}
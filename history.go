@@ -0,0 +1,78 @@
+package onkyoctl
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultHistorySize = 10
+
+// HistoryEntry is a value received for a command at a given time.
+type HistoryEntry struct {
+	Time  time.Time
+	Value string
+}
+
+// history keeps the most recent values for each command.
+type history struct {
+	size    int
+	entries map[string]*ring
+	lock    sync.Mutex
+}
+
+// ring is a fixed size ring buffer of history entries.
+type ring struct {
+	entries []HistoryEntry
+	next    int
+	full    bool
+}
+
+func newHistory(size int) *history {
+	return &history{
+		size:    size,
+		entries: make(map[string]*ring),
+	}
+}
+
+func (h *history) add(name, value string, t time.Time) {
+	if h.size <= 0 {
+		return
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	r, ok := h.entries[name]
+	if !ok {
+		r = &ring{entries: make([]HistoryEntry, h.size)}
+		h.entries[name] = r
+	}
+
+	r.entries[r.next] = HistoryEntry{Time: t, Value: value}
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// get returns the entries for the given name, oldest first.
+func (h *history) get(name string) []HistoryEntry {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	r, ok := h.entries[name]
+	if !ok {
+		return []HistoryEntry{}
+	}
+
+	if !r.full {
+		result := make([]HistoryEntry, r.next)
+		copy(result, r.entries[:r.next])
+		return result
+	}
+
+	result := make([]HistoryEntry, 0, len(r.entries))
+	result = append(result, r.entries[r.next:]...)
+	result = append(result, r.entries[:r.next]...)
+	return result
+}
@@ -0,0 +1,36 @@
+package onkyoctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	h := newHistory(3)
+	now := time.Now()
+
+	assertEqual(t, h.get("volume"), []HistoryEntry{})
+
+	h.add("volume", "10", now)
+	h.add("volume", "11", now)
+	assertEqual(t, h.get("volume"), []HistoryEntry{
+		{Time: now, Value: "10"},
+		{Time: now, Value: "11"},
+	})
+
+	// oldest values are dropped
+	h.add("volume", "12", now)
+	h.add("volume", "13", now)
+	h.add("power", "on", now)
+	assertEqual(t, h.get("volume"), []HistoryEntry{
+		{Time: now, Value: "11"},
+		{Time: now, Value: "12"},
+		{Time: now, Value: "13"},
+	})
+	assertEqual(t, len(h.get("power")), 1)
+
+	// disabled
+	h = newHistory(0)
+	h.add("volume", "10", now)
+	assertEqual(t, h.get("volume"), []HistoryEntry{})
+}
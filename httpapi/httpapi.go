@@ -0,0 +1,291 @@
+// Package httpapi provides a REST API to control a Device over HTTP.
+//
+// The API has the following endpoints:
+//
+//	GET  /state           last known value for all commands
+//	GET  /state/{name}    last known value for a single command
+//	PUT  /command/{name}  send a command, body: {"value": "on"}
+//	POST /query/{name}    query the current value from the device
+//	POST /preview         ISCP command for {"name": "power", "value": "on"}
+//	GET  /commands        the known commands
+//	GET  /ws              websocket for events and commands
+//
+// Responses are JSON; errors are returned as {"error": "..."}.
+//
+// Over the websocket, the server sends an event for every message
+// received from the device:
+//
+//	{"type": "state", "name": "volume", "value": "40", "group": "MVL", ...}
+//
+// Clients send commands as {"id": 1, "name": "volume", "value": 40}
+// and receive {"type": "result", "id": 1, "name": "volume", "value": "40"}
+// or {"type": "error", "id": 1, "error": "..."}.
+// Without a value, the command is queried. Commands from one client
+// are sent one at a time.
+//
+// Browsers may only open the websocket from pages on the same host,
+// other origins must be allowed with Server.AllowOrigins.
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+const maxBodySize = 1 << 16
+
+// Server serves the REST API for a Device.
+type Server struct {
+	device  *onkyo.Device
+	limiter *onkyo.RateLimiter
+	origins []string
+	mux     *http.ServeMux
+}
+
+// NewServer creates a Server for the given device.
+//
+// Commands, queries and previews from each client are limited by the
+// given RateLimiter, which may be nil to disable rate limiting.
+func NewServer(device *onkyo.Device, limiter *onkyo.RateLimiter) *Server {
+	s := &Server{
+		device:  device,
+		limiter: limiter,
+		mux:     http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/state", s.handleState)
+	s.mux.HandleFunc("/state/", s.handleState)
+	s.mux.HandleFunc("/command/", s.handleCommand)
+	s.mux.HandleFunc("/query/", s.handleQuery)
+	s.mux.HandleFunc("/preview", s.handlePreview)
+	s.mux.HandleFunc("/commands", s.handleCommands)
+	s.mux.HandleFunc("/ws", s.handleWebSocket)
+	return s
+}
+
+// AllowOrigins allows websocket connections from web pages on other
+// origins, e.g. "https://dashboard.local". By default, browsers may only
+// connect from pages served by the same host.
+func (s *Server) AllowOrigins(origins ...string) {
+	s.origins = append(s.origins, origins...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Value is the response for a single command.
+type Value struct {
+	Name  string     `json:"name"`
+	Value string     `json:"value"`
+	Time  *time.Time `json:"timestamp,omitempty"`
+}
+
+// CommandInfo describes a command for GET /commands.
+type CommandInfo struct {
+	Name      string          `json:"name"`
+	Group     onkyo.ISCPGroup `json:"group"`
+	Category  string          `json:"category,omitempty"`
+	ParamType onkyo.ParamType `json:"paramType"`
+	Values    []string        `json:"values,omitempty"`
+	Lower     *int            `json:"lower,omitempty"`
+	Upper     *int            `json:"upper,omitempty"`
+}
+
+type valueRequest struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+type previewResponse struct {
+	Name    string            `json:"name"`
+	Command onkyo.ISCPCommand `json:"command"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/state"), "/")
+	if name == "" {
+		state := make(map[string]Value)
+		for name, e := range s.device.State() {
+			t := e.Time
+			state[name] = Value{Name: name, Value: e.Value, Time: &t}
+		}
+		writeJSON(w, http.StatusOK, state)
+		return
+	}
+
+	e, ok := s.device.Value(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no value for %q", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, Value{Name: name, Value: e.Value, Time: &e.Time})
+}
+
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPut) || !s.allowClient(w, r) {
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/command/")
+	var req valueRequest
+	err := readJSON(r, &req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	value, err := s.device.SendCommandSync(name, req.Value)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Value{Name: name, Value: value})
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) || !s.allowClient(w, r) {
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/query/")
+	value, err := s.device.QuerySync(name)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Value{Name: name, Value: value})
+}
+
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) || !s.allowClient(w, r) {
+		return
+	}
+
+	var req valueRequest
+	err := readJSON(r, &req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	cmd, err := s.device.Preview(req.Name, req.Value)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, previewResponse{Name: req.Name, Command: cmd})
+}
+
+func (s *Server) handleCommands(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	commands := onkyo.ListCommands(s.device.Commands())
+	if commands == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("command set does not support listing"))
+		return
+	}
+
+	infos := make([]CommandInfo, 0, len(commands))
+	for _, c := range commands {
+		infos = append(infos, newCommandInfo(c))
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func newCommandInfo(c onkyo.Command) CommandInfo {
+	info := CommandInfo{
+		Name:      c.Name,
+		Group:     c.Group,
+		Category:  c.Category,
+		ParamType: c.ParamType,
+		Values:    c.Values(),
+	}
+	if c.ParamType == onkyo.IntRange || c.ParamType == onkyo.IntRangeEnum {
+		lower, upper := c.Lower, c.Upper
+		info.Lower = &lower
+		info.Upper = &upper
+	}
+	return info
+}
+
+// allowClient applies the rate limit for the client that sent r.
+func (s *Server) allowClient(w http.ResponseWriter, r *http.Request) bool {
+	client := clientAddress(r)
+	err := s.limiter.Allow(client)
+	if err == nil {
+		return true
+	}
+	retry := s.limiter.RetryAfter(client)
+	w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(retry.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, err)
+	return false
+}
+
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+	return false
+}
+
+// statusFor returns the HTTP status code for an error from the Device.
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, onkyo.ErrUnknownCommand):
+		return http.StatusNotFound
+	case errors.Is(err, onkyo.ErrInvalidParam):
+		return http.StatusBadRequest
+	case errors.Is(err, onkyo.ErrNotConnected):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, onkyo.ErrTimeout):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	err := dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
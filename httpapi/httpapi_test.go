@@ -0,0 +1,107 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+func testServer(limiter *onkyo.RateLimiter) *Server {
+	cfg := onkyo.DefaultConfig()
+	cfg.Host = "localhost"
+	cfg.Commands = onkyo.BasicCommands()
+	return NewServer(onkyo.NewDevice(cfg), limiter)
+}
+
+func request(s *Server, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestPreview(t *testing.T) {
+	s := testServer(nil)
+
+	w := request(s, http.MethodPost, "/preview", `{"name": "volume", "value": 20}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", w.Code)
+	}
+	var p previewResponse
+	err := json.Unmarshal(w.Body.Bytes(), &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Command != "MVL28" {
+		t.Errorf("Expected MVL28, got %q", p.Command)
+	}
+
+	cases := map[string]int{
+		`{"name": "volume", "value": 200}`: http.StatusBadRequest,
+		`{"name": "foo", "value": "on"}`:   http.StatusNotFound,
+		`not json`:                         http.StatusBadRequest,
+	}
+	for body, status := range cases {
+		w = request(s, http.MethodPost, "/preview", body)
+		if w.Code != status {
+			t.Errorf("Expected status %v for %v, got %v", status, body, w.Code)
+		}
+	}
+
+	w = request(s, http.MethodGet, "/preview", "")
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %v", w.Code)
+	}
+}
+
+func TestState(t *testing.T) {
+	s := testServer(nil)
+
+	w := request(s, http.MethodGet, "/state", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "{}" {
+		t.Errorf("Unexpected response %v %q", w.Code, w.Body.String())
+	}
+
+	w = request(s, http.MethodGet, "/state/power", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %v", w.Code)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	s := testServer(nil)
+
+	w := request(s, http.MethodGet, "/commands", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %v", w.Code)
+	}
+	var infos []CommandInfo
+	err := json.Unmarshal(w.Body.Bytes(), &infos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) == 0 {
+		t.Error("Expected a list of commands")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := testServer(onkyo.NewRateLimiter(0.1, 1))
+
+	body := `{"name": "power", "value": "on"}`
+	w := request(s, http.MethodPost, "/preview", body)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %v", w.Code)
+	}
+	w = request(s, http.MethodPost, "/preview", body)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %v", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header")
+	}
+}
@@ -0,0 +1,361 @@
+package httpapi
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+// Minimal WebSocket (RFC 6455) server for the /ws endpoint.
+
+const (
+	wsGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	wsMaxPayload = 1 << 16
+	wsQueueSize  = 64
+	wsWriteWait  = 5 * time.Second
+
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+var errWSProtocol = errors.New("websocket protocol error")
+
+type wsCommand struct {
+	ID    interface{} `json:"id,omitempty"`
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+type wsEvent struct {
+	Type  string            `json:"type"`
+	ID    interface{}       `json:"id,omitempty"`
+	Name  string            `json:"name,omitempty"`
+	Value string            `json:"value,omitempty"`
+	Group onkyo.ISCPGroup   `json:"group,omitempty"`
+	Raw   onkyo.ISCPCommand `json:"raw,omitempty"`
+	Time  *time.Time        `json:"timestamp,omitempty"`
+	Error string            `json:"error,omitempty"`
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.allowOrigin(r) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("origin %v not allowed", r.Header.Get("Origin")))
+		return
+	}
+	conn, rw, err := upgrade(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer conn.Close()
+
+	ws := &wsConn{conn: conn, rw: rw}
+	client := clientAddress(r)
+
+	// events are queued, slow clients lose events instead of
+	// blocking the device
+	events := make(chan wsEvent, wsQueueSize)
+	unsubscribe := s.device.Subscribe(func(m *onkyo.ParsedMessage) {
+		t := m.Time
+		select {
+		case events <- wsEvent{
+			Type:  "state",
+			Name:  m.Name,
+			Value: m.Value,
+			Group: m.Group,
+			Raw:   m.Raw,
+			Time:  &t,
+		}:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case e := <-events:
+				if ws.writeJSON(e) != nil {
+					conn.Close()
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	defer close(done)
+
+	// commands from one client are sent one at a time
+	commands := make(chan wsCommand, wsQueueSize)
+	go func() {
+		for cmd := range commands {
+			s.wsExecute(ws, cmd)
+		}
+	}()
+	defer close(commands)
+
+	for {
+		data, err := ws.read()
+		if err != nil {
+			return
+		}
+
+		var cmd wsCommand
+		err = json.Unmarshal(data, &cmd)
+		if err != nil {
+			ws.writeJSON(wsEvent{Type: "error", Error: fmt.Sprintf("invalid message: %v", err)})
+			continue
+		}
+		if s.limiter.Allow(client) != nil {
+			ws.writeJSON(wsEvent{Type: "error", ID: cmd.ID, Error: onkyo.ErrRateLimited.Error()})
+			continue
+		}
+		select {
+		case commands <- cmd:
+		default:
+			ws.writeJSON(wsEvent{Type: "error", ID: cmd.ID, Error: "too many pending commands"})
+		}
+	}
+}
+
+// allowOrigin tells whether a websocket connection from the Origin of r
+// is allowed. Browsers always send the Origin, other clients usually do not.
+// Without this check, any web page could control the device through the
+// browser of a user on the local network.
+func (s *Server) allowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.origins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// wsExecute sends a command from a websocket client and writes the result.
+func (s *Server) wsExecute(ws *wsConn, cmd wsCommand) {
+	var value string
+	var err error
+	if cmd.Value == nil {
+		value, err = s.device.QuerySync(cmd.Name)
+	} else {
+		value, err = s.device.SendCommandSync(cmd.Name, cmd.Value)
+	}
+
+	if err != nil {
+		ws.writeJSON(wsEvent{Type: "error", ID: cmd.ID, Name: cmd.Name, Error: err.Error()})
+		return
+	}
+	ws.writeJSON(wsEvent{Type: "result", ID: cmd.ID, Name: cmd.Name, Value: value})
+}
+
+// upgrade performs the websocket handshake and takes over the connection.
+func upgrade(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, error) {
+	if r.Method != http.MethodGet {
+		return nil, nil, fmt.Errorf("method %v not allowed", r.Method)
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, nil, errors.New("websocket upgrade required")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, nil, errors.New("missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection does not support websocket")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fmt.Fprint(rw, "HTTP/1.1 101 Switching Protocols\r\n")
+	fmt.Fprint(rw, "Upgrade: websocket\r\n")
+	fmt.Fprint(rw, "Connection: Upgrade\r\n")
+	fmt.Fprintf(rw, "Sec-WebSocket-Accept: %v\r\n\r\n", acceptKey(key))
+	err = rw.Flush()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, rw, nil
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContains(h http.Header, name, value string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsConn reads and writes websocket frames.
+type wsConn struct {
+	conn      net.Conn
+	rw        *bufio.ReadWriter
+	writeLock sync.Mutex
+}
+
+// read returns the payload of the next text or binary message.
+// Control frames are handled while reading.
+func (c *wsConn) read() ([]byte, error) {
+	var message []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case opPing:
+			err = c.writeFrame(opPong, payload)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeFrame(opClose, payload)
+			return nil, io.EOF
+		case opText, opBinary:
+			message = payload
+		case opContinuation:
+			message = append(message, payload...)
+		default:
+			return nil, errWSProtocol
+		}
+
+		if len(message) > wsMaxPayload {
+			return nil, errWSProtocol
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	_, err := io.ReadFull(c.rw, head[:])
+	if err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	op := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	if !masked {
+		// clients must mask their frames
+		return false, 0, nil, errWSProtocol
+	}
+
+	size := uint64(head[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(c.rw, ext[:])
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(c.rw, ext[:])
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if err != nil {
+		return false, 0, nil, err
+	}
+	if size > wsMaxPayload {
+		return false, 0, nil, errWSProtocol
+	}
+
+	var mask [4]byte
+	_, err = io.ReadFull(c.rw, mask[:])
+	if err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, size)
+	_, err = io.ReadFull(c.rw, payload)
+	if err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+func (c *wsConn) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(opText, data)
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	head := []byte{0x80 | op}
+	size := len(payload)
+	switch {
+	case size < 126:
+		head = append(head, byte(size))
+	case size <= 0xFFFF:
+		head = append(head, 126, byte(size>>8), byte(size))
+	default:
+		ext := make([]byte, 8)
+		binary.BigEndian.PutUint64(ext, uint64(size))
+		head = append(append(head, 127), ext...)
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	_, err := c.rw.Write(head)
+	if err != nil {
+		return err
+	}
+	_, err = c.rw.Write(payload)
+	if err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
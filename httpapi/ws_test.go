@@ -0,0 +1,141 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// example from RFC 6455
+	key := acceptKey("dGhlIHNhbXBsZSBub25jZQ==")
+	if key != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept key %q", key)
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	ts := httptest.NewServer(testServer(nil))
+	defer ts.Close()
+
+	// plain requests are rejected
+	resp, err := http.Get(ts.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %v", resp.StatusCode)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	fmt.Fprint(conn, "GET /ws HTTP/1.1\r\nHost: localhost\r\n"+
+		"Connection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %v", resp.StatusCode)
+	}
+
+	writeMasked(conn, opPing, []byte("hi"))
+	op, payload := readUnmasked(t, br)
+	if op != opPong || string(payload) != "hi" {
+		t.Errorf("Expected pong, got %x %q", op, payload)
+	}
+
+	writeMasked(conn, opText, []byte(`{"id": 1, "name": "foo", "value": "on"}`))
+	op, payload = readUnmasked(t, br)
+	var e wsEvent
+	err = json.Unmarshal(payload, &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != opText || e.Type != "error" || e.ID != float64(1) {
+		t.Errorf("Unexpected response %q", payload)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	server := testServer(nil)
+	server.AllowOrigins("https://dashboard.local")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	host := strings.TrimPrefix(ts.URL, "http://")
+
+	cases := []struct {
+		origin   string
+		expected int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{"http://" + host, http.StatusSwitchingProtocols},
+		{"https://dashboard.local", http.StatusSwitchingProtocols},
+		{"https://evil.example", http.StatusForbidden},
+		{"http://" + host + ".evil.example", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		conn, err := net.Dial("tcp", host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+		fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %v\r\n"+
+			"Connection: Upgrade\r\nUpgrade: websocket\r\n"+
+			"Sec-WebSocket-Version: 13\r\n"+
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n", host)
+		if c.origin != "" {
+			fmt.Fprintf(conn, "Origin: %v\r\n", c.origin)
+		}
+		fmt.Fprint(conn, "\r\n")
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != c.expected {
+			t.Errorf("Origin %q: expected status %v, got %v", c.origin, c.expected, resp.StatusCode)
+		}
+		conn.Close()
+	}
+}
+
+func writeMasked(conn net.Conn, op byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | op, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	conn.Write(frame)
+}
+
+func readUnmasked(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	head := make([]byte, 2)
+	_, err := br.Read(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, head[1]&0x7F)
+	_, err = br.Read(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0F, payload
+}
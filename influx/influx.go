@@ -0,0 +1,326 @@
+// Package influx writes state changes and connection statistics of a Device
+// in InfluxDB line protocol, either to a file or to the HTTP write endpoint
+// of an InfluxDB server.
+//
+// State changes are written to the "onkyo" measurement with the command
+// name as tag. The type of the value field depends on the command:
+// numeric commands (volume, levels) are written as float, all others
+// as string, so that a field does not change its type between points.
+// Values of numeric commands that are not numbers (e.g. "max") are left out:
+//
+//	onkyo,host=192.168.1.2,name=volume value=40 1614626103500000000
+//	onkyo,host=192.168.1.2,name=power value="on" 1614626103500000000
+//
+// The connection statistics (see Device.Stats) are written to
+// "onkyo_stats" at every flush.
+//
+// Lines that cannot be written are kept for the next flush. They are
+// dropped if the server rejects them (4xx other than 429 Too Many Requests).
+package influx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+const (
+	measurement      = "onkyo"
+	statsMeasurement = "onkyo_stats"
+
+	// DefaultInterval is the default time between writes.
+	DefaultInterval = 10 * time.Second
+
+	// lines are dropped if the target is unavailable for too long
+	maxBuffer = 1 << 20
+)
+
+// Sink collects lines and writes them at a fixed interval.
+type Sink struct {
+	target   string
+	token    string
+	interval time.Duration
+	client   *http.Client
+	buf      bytes.Buffer
+	lock     sync.Mutex
+}
+
+// NewSink creates a Sink that writes to target, which is either a path
+// or an http(s) URL of the write endpoint, e.g.
+// "http://localhost:8086/api/v2/write?org=home&bucket=onkyo".
+//
+// The token is sent as "Authorization: Token <token>" if it is not empty.
+// An interval of zero uses DefaultInterval.
+func NewSink(target, token string, interval time.Duration) *Sink {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Sink{
+		target:   target,
+		token:    token,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run writes state changes and statistics of the device until ctx is done.
+// Lines that cannot be written are kept for the next attempt.
+func (s *Sink) Run(ctx context.Context, device *onkyo.Device) error {
+	tags := map[string]string{"host": device.Host}
+
+	unsubscribe := device.Subscribe(func(m *onkyo.ParsedMessage) {
+		value, ok := fieldValue(paramType(device.Commands(), m.Name), m.Value)
+		if !ok {
+			return
+		}
+		t := tagsWith(tags, "name", m.Name)
+		s.add(Line(measurement, t, map[string]interface{}{"value": value}, m.Time))
+	})
+	defer unsubscribe()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.add(statsLine(tags, device.Stats(), time.Now()))
+			// on errors, lines are kept for the next interval
+			s.Flush()
+		case <-ctx.Done():
+			return s.Flush()
+		}
+	}
+}
+
+func (s *Sink) add(line string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.buf.Len() > maxBuffer {
+		s.buf.Reset()
+	}
+	s.buf.WriteString(line)
+	s.buf.WriteByte('\n')
+}
+
+// Flush writes all collected lines.
+// The lines are kept if writing fails, unless the server rejected them.
+func (s *Sink) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if strings.HasPrefix(s.target, "http://") || strings.HasPrefix(s.target, "https://") {
+		err = s.post(s.buf.Bytes())
+	} else {
+		err = s.appendFile(s.buf.Bytes())
+	}
+	var rejected *rejectedError
+	if errors.As(err, &rejected) {
+		log.Printf("InfluxDB rejected %d bytes, dropping them: %v", s.buf.Len(), err)
+		s.buf.Reset()
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	s.buf.Reset()
+	return nil
+}
+
+// rejectedError is returned for requests that fail with a client error,
+// sending the same lines again would fail again.
+type rejectedError struct {
+	status string
+	msg    []byte
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("write rejected with %v: %s", e.status, e.msg)
+}
+
+func (s *Sink) appendFile(data []byte) error {
+	f, err := os.OpenFile(s.target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *Sink) post(data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			return &rejectedError{status: resp.Status, msg: bytes.TrimSpace(msg)}
+		}
+		return fmt.Errorf("write failed with %v: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// statsLine uses signed integers, InfluxDB 1.x does not support unsigned ones.
+func statsLine(tags map[string]string, st onkyo.Stats, t time.Time) string {
+	return Line(statsMeasurement, tags, map[string]interface{}{
+		"bytes_in":          int64(st.BytesIn),
+		"bytes_out":         int64(st.BytesOut),
+		"frames_in":         int64(st.FramesIn),
+		"frames_out":        int64(st.FramesOut),
+		"connects":          int64(st.Connects),
+		"reconnects":        int64(st.Reconnects),
+		"send_errors":       int64(st.SendErrors),
+		"dropped_callbacks": int64(st.DroppedCallbacks),
+		"dropped_sends":     int64(st.DroppedSends),
+	}, t)
+}
+
+func tagsWith(tags map[string]string, key, value string) map[string]string {
+	result := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+// paramType returns the ParamType of the named command,
+// or an empty ParamType if the command set cannot look it up.
+func paramType(commands onkyo.CommandSet, name string) onkyo.ParamType {
+	lookup, ok := commands.(interface {
+		ForName(name string) (onkyo.Command, error)
+	})
+	if !ok {
+		return ""
+	}
+	c, err := lookup.ForName(name)
+	if err != nil {
+		return ""
+	}
+	return c.ParamType
+}
+
+// fieldValue returns values of numeric commands as float64 and all others
+// as string. It returns false for values of numeric commands that are not
+// numbers, like "max" for the volume.
+func fieldValue(paramType onkyo.ParamType, value string) (interface{}, bool) {
+	switch paramType {
+	case onkyo.IntRange, onkyo.IntRangeEnum, onkyo.SignedRange:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, false
+		}
+		return f, true
+	}
+	return value, true
+}
+
+// Line formats a single line in InfluxDB line protocol.
+// Tags and fields are sorted by key, empty tags are left out.
+// Field values can be strings, bools, floats and (unsigned) integers.
+func Line(measurement string, tags map[string]string, fields map[string]interface{}, t time.Time) string {
+	var b strings.Builder
+	b.WriteString(escape(measurement, ", "))
+
+	for _, k := range sortedKeys(tags) {
+		if tags[k] == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(escape(k, ",= "))
+		b.WriteByte('=')
+		b.WriteString(escape(tags[k], ",= "))
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		if i == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(escape(k, ",= "))
+		b.WriteByte('=')
+		b.WriteString(formatField(fields[k]))
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+	return b.String()
+}
+
+func formatField(v interface{}) string {
+	switch val := v.(type) {
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(val) + "i"
+	case int64:
+		return strconv.FormatInt(val, 10) + "i"
+	case uint64:
+		return strconv.FormatUint(val, 10) + "u"
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	s := strings.ReplaceAll(fmt.Sprint(v), `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// escape adds a backslash before the given special characters.
+func escape(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
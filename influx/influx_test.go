@@ -0,0 +1,179 @@
+package influx
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+func TestLine(t *testing.T) {
+	ts := time.Unix(1614626103, 500000000)
+	cases := []struct {
+		tags     map[string]string
+		fields   map[string]interface{}
+		expected string
+	}{
+		{
+			map[string]string{"name": "volume", "host": "receiver"},
+			map[string]interface{}{"value": 40.5},
+			"onkyo,host=receiver,name=volume value=40.5 1614626103500000000",
+		},
+		{
+			map[string]string{"name": "title", "host": ""},
+			map[string]interface{}{"value": `Say "Hello"`},
+			`onkyo,name=title value="Say \"Hello\"" 1614626103500000000`,
+		},
+		{
+			map[string]string{"name": "listen mode,x"},
+			map[string]interface{}{"b": true, "a": uint64(3), "c": 2},
+			`onkyo,name=listen\ mode\,x a=3u,b=true,c=2i 1614626103500000000`,
+		},
+	}
+
+	for _, c := range cases {
+		actual := Line("onkyo", c.tags, c.fields, ts)
+		if actual != c.expected {
+			t.Errorf("Expected %v, got %v", c.expected, actual)
+		}
+	}
+}
+
+func TestFlushFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "onkyo.lp")
+	s := NewSink(path, "", 0)
+
+	s.add("a value=1 1")
+	err := s.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.add("a value=2 2")
+	err = s.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a value=1 1\na value=2 2\n" {
+		t.Errorf("Unexpected file content %q", data)
+	}
+}
+
+func TestFlushHTTP(t *testing.T) {
+	var body, auth string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	s := NewSink(server.URL+"/api/v2/write?bucket=onkyo", "secret", 0)
+	status = http.StatusInternalServerError
+	s.add("a value=1 1")
+	err := s.Flush()
+	if err == nil {
+		t.Error("Expected error")
+	}
+
+	// lines are kept after an error
+	status = http.StatusNoContent
+	s.add("a value=2 2")
+	err = s.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "a value=1 1\na value=2 2\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+	if auth != "Token secret" {
+		t.Errorf("Unexpected Authorization %q", auth)
+	}
+}
+
+func TestFlushHTTPRejected(t *testing.T) {
+	var body string
+	status := http.StatusBadRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	s := NewSink(server.URL, "", 0)
+
+	// rate limited lines are kept
+	status = http.StatusTooManyRequests
+	s.add("a value=1 1")
+	err := s.Flush()
+	if err == nil {
+		t.Error("Expected error")
+	}
+
+	// rejected lines are dropped
+	status = http.StatusBadRequest
+	err = s.Flush()
+	if err == nil {
+		t.Error("Expected error")
+	}
+	if body != "a value=1 1\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+
+	status = http.StatusNoContent
+	s.add("a value=2 2")
+	err = s.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "a value=2 2\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+}
+
+func TestFieldValue(t *testing.T) {
+	cases := []struct {
+		paramType onkyo.ParamType
+		value     string
+		expected  interface{}
+		ok        bool
+	}{
+		{onkyo.IntRange, "40", 40.0, true},
+		{onkyo.IntRangeEnum, "max", nil, false},
+		{onkyo.SignedRange, "-1.5", -1.5, true},
+		{onkyo.Text, "1999", "1999", true},
+		{onkyo.Enum, "on", "on", true},
+		{"", "42", "42", true},
+	}
+
+	for _, c := range cases {
+		actual, ok := fieldValue(c.paramType, c.value)
+		if actual != c.expected || ok != c.ok {
+			t.Errorf("%v %q: expected %v (%v), got %v (%v)", c.paramType, c.value, c.expected, c.ok, actual, ok)
+		}
+	}
+}
+
+func TestParamType(t *testing.T) {
+	commands := onkyo.NewBasicCommandSet([]onkyo.Command{
+		{Name: "volume", Group: "MVL", ParamType: onkyo.IntRange, Lower: 0, Upper: 100},
+	})
+	if p := paramType(commands, "volume"); p != onkyo.IntRange {
+		t.Errorf("Unexpected type %q for volume", p)
+	}
+	if p := paramType(commands, "unknown"); p != "" {
+		t.Errorf("Unexpected type %q for unknown command", p)
+	}
+}
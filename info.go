@@ -0,0 +1,190 @@
+package onkyoctl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	audioInfoGroup ISCPGroup = "IFA"
+	videoInfoGroup ISCPGroup = "IFV"
+)
+
+// AudioInfo describes the audio signal as reported by IFA messages.
+// Fields the receiver does not report are empty.
+type AudioInfo struct {
+	Input          string // input terminal, e.g. "HDMI 1"
+	Codec          string // input signal format, e.g. "PCM" or "Dolby D"
+	SampleRate     int    // sample rate in Hz, e.g. 48000
+	Channels       string // input channels, e.g. "5.1 ch"
+	ListeningMode  string // e.g. "All Ch Stereo"
+	OutputChannels string // output channels, e.g. "7.1 ch"
+	Raw            string
+}
+
+// ParseAudioInfo parses the parameter of an IFA message,
+// e.g. "HDMI 1,PCM,48 kHz,2.0 ch,All Ch Stereo,5.1 ch,".
+func ParseAudioInfo(param string) (*AudioInfo, error) {
+	if param == "" || param == "N/A" {
+		return nil, fmt.Errorf("%w %q", ErrInvalidParam, param)
+	}
+
+	fields := splitInfo(param, 6)
+	info := &AudioInfo{
+		Input:          fields[0],
+		Codec:          fields[1],
+		Channels:       fields[3],
+		ListeningMode:  fields[4],
+		OutputChannels: fields[5],
+		Raw:            param,
+	}
+	if fields[2] != "" {
+		rate, err := parseSampleRate(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		info.SampleRate = rate
+	}
+	return info, nil
+}
+
+// VideoInfo describes the video signal as reported by IFV messages.
+// Fields the receiver does not report are empty.
+type VideoInfo struct {
+	Input            string // input terminal, e.g. "HDMI 1"
+	InputResolution  string // e.g. "1920x1080p 60Hz"
+	InputColorSpace  string // e.g. "RGB" or "YCbCr 4:2:2"
+	InputColorDepth  string // e.g. "24bit"
+	Output           string // output terminal, e.g. "HDMI OUT MAIN"
+	OutputResolution string
+	OutputColorSpace string
+	OutputColorDepth string
+	PictureMode      string // e.g. "Custom" or "Cinema"
+	Raw              string
+}
+
+// VideoInfoCallback receives the video information when it changes.
+type VideoInfoCallback func(VideoInfo)
+
+// ParseVideoInfo parses the parameter of an IFV message, e.g.
+// "HDMI 1,1920x1080p 60Hz,RGB,24bit,HDMI OUT MAIN,3840x2160p 60Hz,RGB,24bit,Custom,".
+func ParseVideoInfo(param string) (*VideoInfo, error) {
+	if param == "" || param == "N/A" {
+		return nil, fmt.Errorf("%w %q", ErrInvalidParam, param)
+	}
+
+	fields := splitInfo(param, 9)
+	return &VideoInfo{
+		Input:            fields[0],
+		InputResolution:  fields[1],
+		InputColorSpace:  fields[2],
+		InputColorDepth:  fields[3],
+		Output:           fields[4],
+		OutputResolution: fields[5],
+		OutputColorSpace: fields[6],
+		OutputColorDepth: fields[7],
+		PictureMode:      fields[8],
+		Raw:              param,
+	}, nil
+}
+
+// splitInfo splits a comma separated info message into n trimmed fields.
+// Missing fields are empty, additional fields are ignored.
+func splitInfo(param string, n int) []string {
+	parts := strings.Split(param, ",")
+	fields := make([]string, n)
+	for i := 0; i < n && i < len(parts); i++ {
+		fields[i] = strings.TrimSpace(parts[i])
+	}
+	return fields
+}
+
+// parseSampleRate converts a rate like "48 kHz" or "44.1kHz" to Hz.
+func parseSampleRate(s string) (int, error) {
+	v := strings.ToLower(s)
+	scale := 1.0
+	if strings.HasSuffix(v, "khz") {
+		scale = 1000
+		v = strings.TrimSuffix(v, "khz")
+	} else {
+		v = strings.TrimSuffix(v, "hz")
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sample rate %q", s)
+	}
+	return int(f*scale + 0.5), nil
+}
+
+// signalInfo keeps the last signal info received from the device.
+type signalInfo struct {
+	audio *AudioInfo
+	video *VideoInfo
+	lock  sync.RWMutex
+}
+
+// handleInfo parses IFA and IFV messages,
+// also if they are not in the command set.
+func (d *Device) handleInfo(cmd ISCPCommand) {
+	group, param := SplitISCP(cmd)
+	if param == queryParam {
+		return
+	}
+
+	switch group {
+	case audioInfoGroup:
+		audio, err := ParseAudioInfo(param)
+		if err != nil {
+			d.log.Debug("Error reading audio info: %v", err)
+			return
+		}
+		d.info.lock.Lock()
+		d.info.audio = audio
+		d.info.lock.Unlock()
+	case videoInfoGroup:
+		video, err := ParseVideoInfo(param)
+		if err != nil {
+			d.log.Debug("Error reading video info: %v", err)
+			return
+		}
+		d.info.lock.Lock()
+		changed := d.info.video == nil || *d.info.video != *video
+		d.info.video = video
+		d.info.lock.Unlock()
+		if changed && d.onVideoInfo != nil {
+			d.onVideoInfo(*video)
+		}
+	}
+}
+
+// AudioInfo returns the last audio information reported by the device.
+// The second return value is false if none was received yet;
+// use Query("audio-info") to request it.
+func (d *Device) AudioInfo() (AudioInfo, bool) {
+	d.info.lock.RLock()
+	defer d.info.lock.RUnlock()
+	if d.info.audio == nil {
+		return AudioInfo{}, false
+	}
+	return *d.info.audio, true
+}
+
+// VideoInfo returns the last video information reported by the device.
+// The second return value is false if none was received yet;
+// use Query("video-info") to request it.
+func (d *Device) VideoInfo() (VideoInfo, bool) {
+	d.info.lock.RLock()
+	defer d.info.lock.RUnlock()
+	if d.info.video == nil {
+		return VideoInfo{}, false
+	}
+	return *d.info.video, true
+}
+
+// OnVideoInfo sets a callback that is called when the video information
+// changes, e.g. when the resolution of the source changes.
+func (d *Device) OnVideoInfo(callback VideoInfoCallback) {
+	d.onVideoInfo = callback
+}
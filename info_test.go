@@ -0,0 +1,74 @@
+package onkyoctl
+
+import (
+	"testing"
+)
+
+func TestParseAudioInfo(t *testing.T) {
+	info, err := ParseAudioInfo("HDMI 1,PCM,48 kHz,2.0 ch,All Ch Stereo,5.1 ch,")
+	assertNoErr(t, err)
+	assertEqual(t, info.Input, "HDMI 1")
+	assertEqual(t, info.Codec, "PCM")
+	assertEqual(t, info.SampleRate, 48000)
+	assertEqual(t, info.Channels, "2.0 ch")
+	assertEqual(t, info.ListeningMode, "All Ch Stereo")
+	assertEqual(t, info.OutputChannels, "5.1 ch")
+
+	info, err = ParseAudioInfo("NET,FLAC,44.1kHz")
+	assertNoErr(t, err)
+	assertEqual(t, info.SampleRate, 44100)
+	assertEqual(t, info.OutputChannels, "")
+
+	_, err = ParseAudioInfo("HDMI 1,PCM,fast")
+	assertErr(t, err)
+	_, err = ParseAudioInfo("N/A")
+	assertErr(t, err)
+}
+
+func TestDeviceAudioInfo(t *testing.T) {
+	device := NewDevice(testConfig())
+
+	_, ok := device.AudioInfo()
+	assertEqual(t, ok, false)
+
+	// parsed even if IFA is not in the command set
+	device.handleReceived("IFAHDMI 1,Dolby D,48 kHz,5.1 ch,Dolby D,5.1 ch,")
+	info, ok := device.AudioInfo()
+	assertEqual(t, ok, true)
+	assertEqual(t, info.Codec, "Dolby D")
+}
+
+func TestParseVideoInfo(t *testing.T) {
+	info, err := ParseVideoInfo("HDMI 1,1920x1080p 60Hz,RGB,24bit,HDMI OUT MAIN,3840x2160p 60Hz,RGB,24bit,Custom,")
+	assertNoErr(t, err)
+	assertEqual(t, info.Input, "HDMI 1")
+	assertEqual(t, info.InputResolution, "1920x1080p 60Hz")
+	assertEqual(t, info.InputColorDepth, "24bit")
+	assertEqual(t, info.Output, "HDMI OUT MAIN")
+	assertEqual(t, info.OutputResolution, "3840x2160p 60Hz")
+	assertEqual(t, info.PictureMode, "Custom")
+
+	_, err = ParseVideoInfo("")
+	assertErr(t, err)
+}
+
+func TestDeviceVideoInfo(t *testing.T) {
+	device := NewDevice(testConfig())
+
+	calls := make([]VideoInfo, 0)
+	device.OnVideoInfo(func(info VideoInfo) {
+		calls = append(calls, info)
+	})
+
+	device.handleReceived("IFVHDMI 1,1920x1080p 60Hz,RGB,24bit,,,,,,")
+	device.handleReceived("IFVHDMI 1,1920x1080p 60Hz,RGB,24bit,,,,,,")
+	device.handleReceived("IFVHDMI 2,3840x2160p 24Hz,RGB,30bit,,,,,,")
+
+	// only changes are reported
+	assertEqual(t, len(calls), 2)
+	assertEqual(t, calls[1].Input, "HDMI 2")
+
+	info, ok := device.VideoInfo()
+	assertEqual(t, ok, true)
+	assertEqual(t, info.InputColorDepth, "30bit")
+}
@@ -0,0 +1,164 @@
+package onkyoctl
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultLogMaxSize = 10 // megabytes
+	defaultLogBackups = 3
+)
+
+// RotatingFile is an io.WriteCloser for log files that rotates the file
+// when it grows beyond a maximum size or gets older than a maximum age.
+//
+// On rotation, "onkyoctl.log" is renamed to "onkyoctl.log.1",
+// "onkyoctl.log.1" to "onkyoctl.log.2" and so on; files beyond the
+// number of backups are removed.
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	backups int
+	file    *os.File
+	size    int64
+	opened  time.Time
+	lock    sync.Mutex
+}
+
+// NewRotatingFile opens the file at path for appending.
+//
+// A maxSize or maxAge of zero disables rotation by size or age.
+// Age is measured from when the file was first written.
+func NewRotatingFile(path string, maxSize int64, maxAge time.Duration, backups int) (*RotatingFile, error) {
+	if backups < 0 {
+		return nil, fmt.Errorf("invalid number of backups %v", backups)
+	}
+	r := &RotatingFile{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		backups: backups,
+	}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewFileLogger returns a Logger that writes to a RotatingFile,
+// see Config.LogFile.
+func NewFileLogger(level LogLevel, path string, maxSize int64, maxAge time.Duration, backups int) (Logger, error) {
+	f, err := NewRotatingFile(path, maxSize, maxAge, backups)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterLogger(level, f), nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = info.Size()
+	r.opened = time.Now()
+	if r.size > 0 {
+		// an existing file is as old as its last modification
+		r.opened = info.ModTime()
+	}
+	return nil
+}
+
+// Write implements io.Writer.
+// The file is rotated before a write that would exceed the limits.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && r.exceeded(len(p)) {
+		err := r.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) exceeded(n int) bool {
+	if r.maxSize > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+	return r.maxAge > 0 && time.Since(r.opened) > r.maxAge
+}
+
+// Rotate closes the current file, renames it and opens a new one.
+func (r *RotatingFile) Rotate() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rotate()
+}
+
+func (r *RotatingFile) rotate() error {
+	if r.file != nil {
+		err := r.file.Close()
+		r.file = nil
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.backups == 0 {
+		err := os.Remove(r.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		os.Remove(r.backupPath(r.backups))
+		for i := r.backups - 1; i > 0; i-- {
+			err := os.Rename(r.backupPath(i), r.backupPath(i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		err := os.Rename(r.path, r.backupPath(1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return r.open()
+}
+
+func (r *RotatingFile) backupPath(n int) string {
+	return fmt.Sprintf("%v.%d", r.path, n)
+}
+
+// Close closes the current file.
+func (r *RotatingFile) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,75 @@
+package onkyoctl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "onkyoctl.log")
+	f, err := NewRotatingFile(path, 10, 0, 2)
+	assertNoErr(t, err)
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err = f.Write([]byte(line))
+		assertNoErr(t, err)
+	}
+
+	assertFileContent(t, path, "fourth\n")
+	assertFileContent(t, path+".1", "third\n")
+	assertFileContent(t, path+".2", "second\n")
+	_, err = os.Stat(path + ".3")
+	assertEqual(t, os.IsNotExist(err), true)
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "onkyoctl.log")
+	assertNoErr(t, os.WriteFile(path, []byte("old\n"), 0644))
+	past := time.Now().Add(-2 * time.Hour)
+	assertNoErr(t, os.Chtimes(path, past, past))
+
+	f, err := NewRotatingFile(path, 0, time.Hour, 1)
+	assertNoErr(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("new\n"))
+	assertNoErr(t, err)
+	_, err = f.Write([]byte("more\n"))
+	assertNoErr(t, err)
+
+	assertFileContent(t, path, "new\nmore\n")
+	assertFileContent(t, path+".1", "old\n")
+}
+
+func TestRotatingFileNoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "onkyoctl.log")
+	f, err := NewRotatingFile(path, 0, 0, 0)
+	assertNoErr(t, err)
+
+	_, err = f.Write([]byte("first\n"))
+	assertNoErr(t, err)
+	assertNoErr(t, f.Rotate())
+	_, err = f.Write([]byte("second\n"))
+	assertNoErr(t, err)
+	assertNoErr(t, f.Close())
+
+	assertFileContent(t, path, "second\n")
+	_, err = os.Stat(path + ".1")
+	assertEqual(t, os.IsNotExist(err), true)
+
+	_, err = f.Write([]byte("closed\n"))
+	assertErr(t, err)
+
+	_, err = NewRotatingFile(path, 0, 0, -1)
+	assertErr(t, err)
+}
+
+func assertFileContent(t *testing.T, path, expected string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	assertNoErr(t, err)
+	assertEqual(t, string(data), expected)
+}
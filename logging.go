@@ -1,9 +1,12 @@
 package onkyoctl
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
 )
 
 // LogLevel is the type for log levels.
@@ -22,6 +25,10 @@ const (
 	NoLog
 )
 
+// Trace log level, below Debug.
+// Logs a hex dump of every frame that is sent or received, see TraceLogger.
+const Trace LogLevel = Debug - 1
+
 // Logger is the interface used for logging.
 type Logger interface {
 	Debug(msg string, v ...interface{})
@@ -30,42 +37,235 @@ type Logger interface {
 	Error(msg string, v ...interface{})
 }
 
-// NewLogger returns a Logger with the given log level.
+// TraceLogger is implemented by loggers that support the Trace level.
+type TraceLogger interface {
+	Logger
+	Trace(msg string, v ...interface{})
+}
+
+// logTrace logs a frame in a stable format, one line per frame:
+//
+//	conn=1 dir=send len=24 data=49 53 43 50 00 00 00 10 ...
+//
+// Nothing is logged if l is not a TraceLogger.
+func logTrace(l Logger, connID int, direction Direction, data []byte) {
+	tl, ok := l.(TraceLogger)
+	if !ok {
+		return
+	}
+	tl.Trace("conn=%d dir=%v len=%d data=% x", connID, direction, len(data), data)
+}
+
+// Fields are key/value pairs describing a log message,
+// e.g. the direction and ISCP group of a message.
+type Fields map[string]interface{}
+
+// FieldLogger is implemented by loggers that support structured fields,
+// see NewSlogLogger.
+type FieldLogger interface {
+	Logger
+	Log(level LogLevel, msg string, fields Fields)
+}
+
+// logFields logs the formatted message with fields if l is a FieldLogger,
+// other loggers receive the message only.
+// Trace messages are dropped if l is not a TraceLogger.
+func logFields(l Logger, level LogLevel, fields Fields, format string, v ...interface{}) {
+	fl, ok := l.(FieldLogger)
+	if ok {
+		fl.Log(level, fmt.Sprintf(format, v...), fields)
+		return
+	}
+
+	switch level {
+	case Trace:
+		tl, ok := l.(TraceLogger)
+		if ok {
+			tl.Trace(format, v...)
+		}
+	case Debug:
+		l.Debug(format, v...)
+	case Info:
+		l.Info(format, v...)
+	case Warning:
+		l.Warning(format, v...)
+	case Error:
+		l.Error(format, v...)
+	}
+}
+
+// messageFields returns the fields for an ISCP message.
+func messageFields(direction string, cmd ISCPCommand) Fields {
+	fields := Fields{"direction": direction, "command": string(cmd)}
+	if len(cmd) >= 3 {
+		group, _ := SplitISCP(cmd)
+		fields["group"] = string(group)
+	}
+	return fields
+}
+
+// sortedFields returns the keys of fields in sorted order.
+func sortedFields(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ContextLogger is implemented by loggers that can add fields to every
+// message, see WithFields.
+type ContextLogger interface {
+	Logger
+	WithFields(fields Fields) Logger
+}
+
+// WithFields returns a Logger that adds fields to every message,
+// e.g. the name and host of a device.
+//
+// Loggers that do not implement ContextLogger get the fields as a prefix
+// like "device=livingroom host=192.168.1.2: ".
+func WithFields(l Logger, fields Fields) Logger {
+	cl, ok := l.(ContextLogger)
+	if ok {
+		return cl.WithFields(fields)
+	}
+	return newFieldLogger(l, fields)
+}
+
+// newFieldLogger returns a prefixLogger for the given fields.
+func newFieldLogger(l Logger, fields Fields) *prefixLogger {
+	parts := make([]string, 0, len(fields))
+	for _, k := range sortedFields(fields) {
+		parts = append(parts, fmt.Sprintf("%v=%v", k, fields[k]))
+	}
+	return &prefixLogger{
+		inner:  l,
+		prefix: strings.Join(parts, " ") + ": ",
+		fields: fields,
+	}
+}
+
+// WithPrefix returns a Logger that adds prefix to every message.
+func WithPrefix(l Logger, prefix string) Logger {
+	return &prefixLogger{inner: l, prefix: prefix}
+}
+
+// prefixLogger prefixes the messages for another Logger.
+type prefixLogger struct {
+	inner  Logger
+	prefix string
+	fields Fields
+}
+
+func (l *prefixLogger) format(msg string) string {
+	return strings.ReplaceAll(l.prefix, "%", "%%") + msg
+}
+
+func (l *prefixLogger) Trace(msg string, v ...interface{}) {
+	tl, ok := l.inner.(TraceLogger)
+	if ok {
+		tl.Trace(l.format(msg), v...)
+	}
+}
+
+func (l *prefixLogger) Debug(msg string, v ...interface{}) {
+	l.inner.Debug(l.format(msg), v...)
+}
+
+func (l *prefixLogger) Info(msg string, v ...interface{}) {
+	l.inner.Info(l.format(msg), v...)
+}
+
+func (l *prefixLogger) Warning(msg string, v ...interface{}) {
+	l.inner.Warning(l.format(msg), v...)
+}
+
+func (l *prefixLogger) Error(msg string, v ...interface{}) {
+	l.inner.Error(l.format(msg), v...)
+}
+
+// Log passes the fields on to a FieldLogger,
+// other loggers receive the prefixed message.
+func (l *prefixLogger) Log(level LogLevel, msg string, fields Fields) {
+	fl, ok := l.inner.(FieldLogger)
+	if !ok {
+		logFields(l.inner, level, nil, "%s", l.prefix+msg)
+		return
+	}
+	if l.fields == nil {
+		fl.Log(level, l.prefix+msg, fields)
+		return
+	}
+
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	fl.Log(level, msg, merged)
+}
+
+// WithFields implements ContextLogger.
+func (l *prefixLogger) WithFields(fields Fields) Logger {
+	return newFieldLogger(l, fields)
+}
+
+// NewLogger returns a Logger with the given log level that writes to stderr.
 func NewLogger(level LogLevel) Logger {
+	return NewWriterLogger(level, os.Stderr)
+}
+
+// NewWriterLogger returns a Logger with the given log level that writes to w,
+// e.g. a RotatingFile.
+func NewWriterLogger(level LogLevel, w io.Writer) Logger {
 	flags := log.Ldate | log.Ltime | log.LUTC
 	l := &basicLogger{
+		trace:   log.New(io.Discard, "T ", flags),
 		debug:   log.New(io.Discard, "D ", flags),
 		info:    log.New(io.Discard, "I ", flags),
 		warning: log.New(io.Discard, "W ", flags),
 		error:   log.New(io.Discard, "E ", flags),
 	}
 
+	if level <= Trace {
+		l.trace.SetOutput(w)
+	}
+
 	if level <= Debug {
-		l.debug.SetOutput(os.Stderr)
+		l.debug.SetOutput(w)
 	}
 
 	if level <= Info {
-		l.info.SetOutput(os.Stderr)
+		l.info.SetOutput(w)
 	}
 
 	if level <= Warning {
-		l.warning.SetOutput(os.Stderr)
+		l.warning.SetOutput(w)
 	}
 
 	if level <= Error {
-		l.error.SetOutput(os.Stderr)
+		l.error.SetOutput(w)
 	}
 
 	return l
 }
 
 type basicLogger struct {
+	trace   *log.Logger
 	debug   *log.Logger
 	info    *log.Logger
 	warning *log.Logger
 	error   *log.Logger
 }
 
+func (l *basicLogger) Trace(msg string, v ...interface{}) {
+	l.trace.Printf(msg, v...)
+}
+
 func (l *basicLogger) Debug(msg string, v ...interface{}) {
 	l.debug.Printf(msg, v...)
 }
@@ -0,0 +1,45 @@
+package onkyoctl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLogTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logTrace(NewWriterLogger(Debug, &buf), 1, Sent, []byte("ISCP"))
+	assertEqual(t, buf.Len(), 0)
+
+	logTrace(NewWriterLogger(Trace, &buf), 1, Sent, []byte("ISCP"))
+	line := buf.String()
+	assertEqual(t, strings.HasPrefix(line, "T "), true)
+	assertEqual(t, strings.HasSuffix(line, " conn=1 dir=send len=4 data=49 53 43 50\n"), true)
+}
+
+func TestLogFieldsTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logFields(NewWriterLogger(Debug, &buf), Trace, Fields{"conn": 1}, "frame %v", "PWR01")
+	assertEqual(t, buf.Len(), 0)
+
+	logFields(NewWriterLogger(Trace, &buf), Trace, Fields{"conn": 1}, "frame %v", "PWR01")
+	line := buf.String()
+	assertEqual(t, strings.HasPrefix(line, "T "), true)
+	assertEqual(t, strings.HasSuffix(line, " frame PWR01\n"), true)
+}
+
+func TestWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := WithFields(NewWriterLogger(Debug, &buf), Fields{"host": "192.168.1.2", "device": "living%room"})
+	l.Info("Connected to %v", "receiver")
+	assertEqual(t, strings.HasSuffix(buf.String(), " device=living%room host=192.168.1.2: Connected to receiver\n"), true)
+
+	buf.Reset()
+	logFields(l, Warning, Fields{"state": "connected"}, "State %v", "connected")
+	assertEqual(t, strings.HasSuffix(buf.String(), "host=192.168.1.2: State connected\n"), true)
+
+	buf.Reset()
+	l = WithPrefix(NewWriterLogger(Debug, &buf), "[office] ")
+	l.Error("failed")
+	assertEqual(t, strings.HasSuffix(buf.String(), " [office] failed\n"), true)
+}
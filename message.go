@@ -2,13 +2,19 @@ package onkyoctl
 
 import (
 	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"io"
+	"sync"
+	"time"
 )
 
 const (
 	iscpStart               = "!"
-	unitTypeReceiver        = "1"
+	unitTypeReceiver byte   = '1'
 	headerSize       uint32 = 16
+	minHeaderSize           = 12
+	maxMessageSize          = 1 << 20
 	eISCPVersion     byte   = 0x01
 	terminator              = "\r\n"
 	cr                      = byte('\r')
@@ -16,27 +22,86 @@ const (
 	eof                     = 0x1A
 )
 
+// Errors returned when parsing messages.
+//
+// Use errors.Is with ErrFraming or ErrProtocol to tell problems with the
+// eISCP framing from problems with the ISCP message itself.
+var (
+	// ErrFraming is the parent of all errors in the eISCP framing.
+	ErrFraming = errors.New("eISCP framing error")
+	// ErrProtocol is the parent of all errors in the ISCP message.
+	ErrProtocol = errors.New("ISCP protocol error")
+
+	// ErrShortHeader means the eISCP header is incomplete.
+	ErrShortHeader = &ParseError{"eISCP header too short", ErrFraming}
+	// ErrBadMagic means the eISCP header does not start with "ISCP".
+	ErrBadMagic = &ParseError{"missing start sequence in message header", ErrFraming}
+	// ErrShortPayload means the payload is shorter than the size in the header.
+	ErrShortPayload = &ParseError{"eISCP payload too short", ErrFraming}
+	// ErrPayloadTooLarge means the size in the header exceeds the limit.
+	ErrPayloadTooLarge = &ParseError{"eISCP payload too large", ErrFraming}
+	// ErrUnsupportedVersion is returned in strict mode
+	// for eISCP messages with an unknown version.
+	ErrUnsupportedVersion = &ParseError{"unsupported eISCP version", ErrFraming}
+
+	// ErrShortMessage means the ISCP message is too short.
+	ErrShortMessage = &ParseError{"ISCP message too short", ErrProtocol}
+	// ErrMissingStart means the ISCP message does not start with '!'.
+	ErrMissingStart = &ParseError{"missing start character '!'", ErrProtocol}
+	// ErrBadUnitType means the ISCP message has an invalid unit type.
+	ErrBadUnitType = &ParseError{"missing unit type character", ErrProtocol}
+)
+
+// ParseError is the type for errors that occur when a message is parsed.
+type ParseError struct {
+	msg  string
+	kind error
+}
+
+func (p *ParseError) Error() string {
+	return p.msg
+}
+
+// Unwrap returns the kind of error, ErrFraming or ErrProtocol.
+func (p *ParseError) Unwrap() error {
+	return p.kind
+}
+
 // ISCPMessage is the base message for ISCP.
 // The messages consists of:
 // !    - start character
-// 1    - receiver type
+// 1    - unit type ('1' for receivers)
 // ...  - <command>
 // \r\n - terminator
 type ISCPMessage struct {
-	command ISCPCommand
+	unitType byte
+	command  ISCPCommand
 }
 
 // NewISCPMessage creates a new ISCP message with the given command.
+// The message is addressed to a receiver (unit type '1').
 func NewISCPMessage(command ISCPCommand) *ISCPMessage {
+	return NewISCPMessageForUnit(unitTypeReceiver, command)
+}
+
+// NewISCPMessageForUnit creates a new ISCP message with the given unit type
+// character and command.
+func NewISCPMessageForUnit(unitType byte, command ISCPCommand) *ISCPMessage {
 	return &ISCPMessage{
-		command: command,
+		unitType: unitType,
+		command:  command,
 	}
 }
 
 // Format returns the string representation for an ISCPMessage.
 // Includes terminating newline (CRLF).
 func (i *ISCPMessage) Format() string {
-	return iscpStart + unitTypeReceiver + string(i.command) + terminator
+	return iscpStart + string(i.unitType) + string(i.command) + terminator
+}
+
+// UnitType returns the unit type character, e.g. '1' for a receiver.
+func (i *ISCPMessage) UnitType() byte {
+	return i.unitType
 }
 
 // Command returns the ISCP command for a message.
@@ -51,12 +116,14 @@ func (i *ISCPMessage) String() string {
 // ToEISCP converts this message to eISCP format.
 func (i *ISCPMessage) ToEISCP() *EISCPMessage {
 	return &EISCPMessage{
+		version: eISCPVersion,
 		message: i,
 	}
 }
 
 // EISCPMessage is the type for eISCP messages.
 type EISCPMessage struct {
+	version byte
 	message *ISCPMessage
 }
 
@@ -70,60 +137,164 @@ func (e *EISCPMessage) Command() ISCPCommand {
 	return e.message.Command()
 }
 
+// UnitType returns the unit type character for this message.
+func (e *EISCPMessage) UnitType() byte {
+	return e.message.UnitType()
+}
+
+// Version returns the eISCP version from the message header.
+func (e *EISCPMessage) Version() byte {
+	return e.version
+}
+
 func (e *EISCPMessage) String() string {
 	return "eISCP " + string(e.Command())
 }
 
 // Raw returns the byte data (header and payload) for this message.
 func (e *EISCPMessage) Raw() []byte {
-	payload := []byte(e.message.Format())
+	size := int(headerSize) + iscpSize(e.message.command)
+	return e.AppendRaw(make([]byte, 0, size))
+}
 
-	end := binary.BigEndian
+// AppendRaw appends the byte data (header and payload) for this message
+// to buf and returns the extended buffer.
+func (e *EISCPMessage) AppendRaw(buf []byte) []byte {
+	return appendEISCP(buf, e.version, e.message.unitType, e.message.command)
+}
+
+// AppendEISCP appends the eISCP frame for a command to buf
+// and returns the extended buffer, like NewEISCPMessage(cmd).Raw().
+//
+// It does not allocate if buf has enough capacity, so a buffer can be
+// reused for many messages:
+//
+//	buf = AppendEISCP(buf[:0], cmd)
+func AppendEISCP(buf []byte, cmd ISCPCommand) []byte {
+	return appendEISCP(buf, eISCPVersion, unitTypeReceiver, cmd)
+}
+
+// iscpSize is the size of the ISCP message for cmd, including terminator.
+func iscpSize(cmd ISCPCommand) int {
+	return len(iscpStart) + 1 + len(cmd) + len(terminator)
+}
+
+// Header
+// 0-3      magic 'ISCP'
+// 4-7      length of the header (always 16)
+// 8-11     length of the payload (in bytes)
+// 12       version
+// 13-15    reserved (0x00 0x00 0x00)
+func appendEISCP(buf []byte, version, unitType byte, cmd ISCPCommand) []byte {
+	buf = append(buf, 'I', 'S', 'C', 'P')
+	buf = appendUint32(buf, headerSize)
+	buf = appendUint32(buf, uint32(iscpSize(cmd)))
+	buf = append(buf, version, 0x00, 0x00, 0x00)
+
+	buf = append(buf, iscpStart...)
+	buf = append(buf, unitType)
+	buf = append(buf, cmd...)
+	return append(buf, terminator...)
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// framePool holds buffers for WriteTo.
+var framePool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 64)
+		return &buf
+	},
+}
+
+// WriteTo writes the raw message (header and payload) to w.
+func (e *EISCPMessage) WriteTo(w io.Writer) (int64, error) {
+	bp := framePool.Get().(*[]byte)
+	buf := e.AppendRaw((*bp)[:0])
+	n, err := w.Write(buf)
+	*bp = buf
+	framePool.Put(bp)
+	return int64(n), err
+}
+
+// ReadEISCP reads exactly one eISCP message from the given reader.
+//
+// Errors from the reader are returned unchanged.
+// If the message cannot be parsed, the complete message is still consumed
+// as long as the header is valid.
+func ReadEISCP(r io.Reader) (*EISCPMessage, error) {
+	data, err := readFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseEISCP(data, false)
+}
+
+// readFrame reads the raw data (header and payload) for one eISCP message.
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, minHeaderSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// the header may be longer than the fixed part
+	size := binary.BigEndian.Uint32(header[4:8])
+	if size > minHeaderSize && size < maxMessageSize {
+		rest := make([]byte, int(size)-minHeaderSize)
+		_, err = io.ReadFull(r, rest)
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, rest...)
+	}
+
+	hSize, pSize, _, err := ParseHeaderVersion(header)
+	if err != nil {
+		return nil, err
+	}
+	if pSize > maxMessageSize {
+		return nil, ErrPayloadTooLarge
+	}
 
-	headerLen := make([]byte, 4)
-	end.PutUint32(headerLen, headerSize)
-
-	msgLen := make([]byte, 4)
-	end.PutUint32(msgLen, uint32(len(payload)))
-
-	// Header
-	// 0-3      magic 'ISCP'
-	// 4-7      length of the header (always 16)
-	// 8-11     length of the payload (in bytes)
-	// 12       version
-	// 13-15    reserved (0x00 0x00 0x00)
-	header := make([]byte, headerSize)
-	header[0] = 0x49 // I
-	header[1] = 0x53 // S
-	header[2] = 0x43 // C
-	header[3] = 0x50 // P
-	header[4] = headerLen[0]
-	header[5] = headerLen[1]
-	header[6] = headerLen[2]
-	header[7] = headerLen[3]
-	header[8] = msgLen[0]
-	header[9] = msgLen[1]
-	header[10] = msgLen[2]
-	header[11] = msgLen[3]
-	header[12] = eISCPVersion
-	header[13] = 0x00
-	header[14] = 0x00
-	header[15] = 0x00
-
-	result := append(header, payload...)
-	return result
+	data := make([]byte, hSize+pSize)
+	copy(data, header)
+	_, err = io.ReadFull(r, data[hSize:])
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 // ParseEISCP reads an eISCP message from a byte array.
+// The version from the header is not checked.
 func ParseEISCP(data []byte) (*EISCPMessage, error) {
-	headerSize, payloadSize, err := ParseHeader(data)
+	return parseEISCP(data, false)
+}
+
+// ParseEISCPStrict works like ParseEISCP,
+// but rejects messages with an unknown eISCP version.
+func ParseEISCPStrict(data []byte) (*EISCPMessage, error) {
+	return parseEISCP(data, true)
+}
+
+func parseEISCP(data []byte, strict bool) (*EISCPMessage, error) {
+	headerSize, payloadSize, version, err := ParseHeaderVersion(data)
 	if err != nil {
 		return nil, err
 	}
+	if strict {
+		err = CheckVersion(version)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	totalSize := headerSize + payloadSize
 	if len(data) < totalSize {
-		return nil, errors.New("eISCP message too short")
+		return nil, ErrShortPayload
 	}
 
 	payload := data[headerSize:totalSize]
@@ -131,18 +302,27 @@ func ParseEISCP(data []byte) (*EISCPMessage, error) {
 	if err != nil {
 		return nil, err
 	}
-	return iscp.ToEISCP(), nil
+	msg := iscp.ToEISCP()
+	msg.version = version
+	return msg, nil
 }
 
 // ParseHeader parses the header of an eISCP message
 // and returns the header size and payload size
 func ParseHeader(data []byte) (int, int, error) {
+	headerSize, payloadSize, _, err := ParseHeaderVersion(data)
+	return headerSize, payloadSize, err
+}
+
+// ParseHeaderVersion parses the header of an eISCP message
+// and returns the header size, payload size and version.
+func ParseHeaderVersion(data []byte) (int, int, byte, error) {
 	// we need at least 12 byte
 	// - 4 bytes "magic"
 	// - 4 bytes header length
 	// - 4 bytes payload length
 	if len(data) < 12 {
-		return 0, 0, errors.New("eISCP header too short")
+		return 0, 0, 0, ErrShortHeader
 	}
 
 	// check the "magic"
@@ -152,19 +332,33 @@ func ParseHeader(data []byte) (int, int, error) {
 	pOk := data[3] == 0x50 // P
 	magicOk := iOk && sOk && cOk && pOk
 	if !magicOk {
-		return 0, 0, errors.New("missing start sequence in message header")
+		return 0, 0, 0, ErrBadMagic
 	}
 
 	end := binary.BigEndian
 	headerSize := end.Uint32(data[4:8])
 	payloadSize := end.Uint32(data[8:12])
 	if len(data) < int(headerSize) {
-		return 0, 0, errors.New("eISCP header shorter than indicated")
+		return 0, 0, 0, ErrShortHeader
+	}
+
+	// the version is the first byte after the payload size,
+	// the remaining three bytes are reserved.
+	var version byte
+	if headerSize > 12 {
+		version = data[12]
 	}
 
-	// note we might parse the last 4 bytes to get the version
+	return int(headerSize), int(payloadSize), version, nil
+}
 
-	return int(headerSize), int(payloadSize), nil
+// CheckVersion returns ErrUnsupportedVersion
+// if the given eISCP version is not supported.
+func CheckVersion(version byte) error {
+	if version != eISCPVersion {
+		return ErrUnsupportedVersion
+	}
+	return nil
 }
 
 // ParseISCP parses an ISCP message from a byte array.
@@ -177,13 +371,16 @@ func ParseISCP(data []byte) (*ISCPMessage, error) {
 	// where Command is at least three digits
 	// we can do without CR/LF at the end
 	if size < 5 {
-		return nil, errors.New("ISCP message too short")
+		return nil, ErrShortMessage
 	}
 	if s[0] != byte('!') {
-		return nil, errors.New("missing start character '!'")
+		return nil, ErrMissingStart
 	}
-	if s[1] != byte('1') {
-		return nil, errors.New("missing receiver type '1'")
+	// the unit type is '1' for receivers,
+	// other device categories use other digits or lower case letters
+	unitType := s[1]
+	if !isUnitType(unitType) {
+		return nil, ErrBadUnitType
 	}
 
 	// terminators can be:
@@ -209,5 +406,106 @@ func ParseISCP(data []byte) (*ISCPMessage, error) {
 	}
 
 	command := string(s[2 : offset+1])
-	return NewISCPMessage(ISCPCommand(command)), nil
+	return NewISCPMessageForUnit(unitType, ISCPCommand(command)), nil
+}
+
+func isUnitType(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z')
+}
+
+// JSON ----------------------------------------------------------------------
+
+type iscpJSON struct {
+	Version  byte        `json:"version,omitempty"`
+	UnitType string      `json:"unitType"`
+	Command  ISCPCommand `json:"command"`
+}
+
+func (j iscpJSON) toISCP() (*ISCPMessage, error) {
+	unitType := unitTypeReceiver
+	if j.UnitType != "" {
+		if len(j.UnitType) != 1 || !isUnitType(j.UnitType[0]) {
+			return nil, ErrBadUnitType
+		}
+		unitType = j.UnitType[0]
+	}
+	return NewISCPMessageForUnit(unitType, j.Command), nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (i *ISCPMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(iscpJSON{
+		UnitType: string(i.unitType),
+		Command:  i.command,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (i *ISCPMessage) UnmarshalJSON(data []byte) error {
+	var j iscpJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+	msg, err := j.toISCP()
+	if err != nil {
+		return err
+	}
+	*i = *msg
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e *EISCPMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(iscpJSON{
+		Version:  e.version,
+		UnitType: string(e.UnitType()),
+		Command:  e.Command(),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (e *EISCPMessage) UnmarshalJSON(data []byte) error {
+	var j iscpJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+	msg, err := j.toISCP()
+	if err != nil {
+		return err
+	}
+	e.message = msg
+	e.version = j.Version
+	if e.version == 0 {
+		e.version = eISCPVersion
+	}
+	return nil
+}
+
+// ParsedMessage is a received message converted to its friendly form.
+type ParsedMessage struct {
+	Name  string      `json:"name"`
+	Value string      `json:"value"`
+	Group ISCPGroup   `json:"group"`
+	Raw   ISCPCommand `json:"raw"`
+	Time  time.Time   `json:"timestamp"`
+	Popup *Popup      `json:"popup,omitempty"`
+}
+
+// ParseMessage converts an ISCP command to a ParsedMessage
+// using the given CommandSet.
+func ParseMessage(commands CommandSet, command ISCPCommand) (*ParsedMessage, error) {
+	name, value, err := commands.ReadCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	group, _ := SplitISCP(command)
+	return &ParsedMessage{
+		Name:  name,
+		Value: value,
+		Group: group,
+		Raw:   command,
+		Time:  time.Now(),
+	}, nil
 }
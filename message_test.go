@@ -1,7 +1,11 @@
 package onkyoctl
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
 	"testing"
 )
 
@@ -37,6 +41,12 @@ func TestISCPParse(t *testing.T) {
 			Data:        []byte("!PWR01\n"),
 			ExpectError: true,
 		},
+		// other unit types
+		{
+			Data:        []byte("!xPWR01\r\n"),
+			ExpectError: false,
+			Command:     "PWR01",
+		},
 		// various end styles
 		{
 			Data:        []byte("!1PWR01\r\n"),
@@ -83,6 +93,20 @@ func TestISCPParse(t *testing.T) {
 	}
 }
 
+func TestISCPUnitType(t *testing.T) {
+	iscp, err := ParseISCP([]byte("!1PWR01\r\n"))
+	assertNoErr(t, err)
+	assertEqual(t, iscp.UnitType(), byte('1'))
+
+	iscp, err = ParseISCP([]byte("!xDCK01\r\n"))
+	assertNoErr(t, err)
+	assertEqual(t, iscp.UnitType(), byte('x'))
+	assertEqual(t, iscp.Command(), ISCPCommand("DCK01"))
+	assertEqual(t, iscp.Format(), "!xDCK01\r\n")
+
+	assertEqual(t, NewISCPMessage("PWR01").UnitType(), byte('1'))
+}
+
 func TestEISCPRaw(t *testing.T) {
 	m := NewEISCPMessage("PWR01")
 	raw := m.Raw()
@@ -108,6 +132,23 @@ func TestEISCPRaw(t *testing.T) {
 	assertEqual(t, payload, []byte("!1PWR01\r\n"))
 }
 
+func TestAppendEISCP(t *testing.T) {
+	buf := make([]byte, 0, 64)
+	buf = AppendEISCP(buf, "PWR01")
+	assertEqual(t, buf, NewEISCPMessage("PWR01").Raw())
+
+	buf = AppendEISCP(buf[:0], "NTIA long title")
+	assertEqual(t, buf, NewEISCPMessage("NTIA long title").Raw())
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = AppendEISCP(buf[:0], "MVL2E")
+	})
+	assertEqual(t, allocs, float64(0))
+
+	prefix := []byte("x")
+	assertEqual(t, AppendEISCP(prefix, "PWR01")[1:], NewEISCPMessage("PWR01").Raw())
+}
+
 func TestEISCPParse(t *testing.T) {
 	m := NewEISCPMessage("PWR01")
 	raw := m.Raw()
@@ -189,3 +230,142 @@ func TestEISCPParse(t *testing.T) {
 	assertNoErr(t, err)
 	assertEqual(t, eiscp.Command(), ISCPCommand("XXX"))
 }
+
+func TestEISCPVersion(t *testing.T) {
+	m := NewEISCPMessage("PWR01")
+	assertEqual(t, m.Version(), byte(0x01))
+
+	raw := m.Raw()
+	raw[12] = 0x02
+
+	// lenient by default
+	eiscp, err := ParseEISCP(raw)
+	assertNoErr(t, err)
+	assertEqual(t, eiscp.Version(), byte(0x02))
+	assertEqual(t, eiscp.Raw()[12], byte(0x02))
+
+	// strict mode rejects unknown versions
+	_, err = ParseEISCPStrict(raw)
+	assertEqual(t, errors.Is(err, ErrUnsupportedVersion), true)
+
+	_, err = ParseEISCPStrict(m.Raw())
+	assertNoErr(t, err)
+}
+
+func TestEISCPReadWrite(t *testing.T) {
+	var buf bytes.Buffer
+
+	n, err := NewEISCPMessage("PWR01").WriteTo(&buf)
+	assertNoErr(t, err)
+	assertEqual(t, n, int64(25))
+	NewEISCPMessage("MVL2E").WriteTo(&buf)
+
+	// reads exactly one message at a time
+	msg, err := ReadEISCP(&buf)
+	assertNoErr(t, err)
+	assertEqual(t, msg.Command(), ISCPCommand("PWR01"))
+
+	msg, err = ReadEISCP(&buf)
+	assertNoErr(t, err)
+	assertEqual(t, msg.Command(), ISCPCommand("MVL2E"))
+
+	_, err = ReadEISCP(&buf)
+	assertEqual(t, err, io.EOF)
+
+	// truncated
+	raw := NewEISCPMessage("PWR01").Raw()
+	_, err = ReadEISCP(bytes.NewReader(raw[:20]))
+	assertEqual(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := ParseEISCP(make([]byte, 4))
+	assertEqual(t, err, error(ErrShortHeader))
+	assertEqual(t, errors.Is(err, ErrFraming), true)
+	assertEqual(t, errors.Is(err, ErrProtocol), false)
+
+	_, err = ParseEISCP(make([]byte, 100))
+	assertEqual(t, err, error(ErrBadMagic))
+
+	raw := NewEISCPMessage("PWR01").Raw()
+	_, err = ParseEISCP(raw[:20])
+	assertEqual(t, err, error(ErrShortPayload))
+
+	_, err = ParseISCP([]byte("!1P"))
+	assertEqual(t, err, error(ErrShortMessage))
+	assertEqual(t, errors.Is(err, ErrProtocol), true)
+
+	_, err = ParseISCP([]byte("?1PWR01"))
+	assertEqual(t, err, error(ErrMissingStart))
+
+	_, err = ParseISCP([]byte("!PWR01"))
+	assertEqual(t, err, error(ErrBadUnitType))
+}
+
+func TestMessageJSON(t *testing.T) {
+	data, err := json.Marshal(NewISCPMessage("PWR01"))
+	assertNoErr(t, err)
+	assertEqual(t, string(data), `{"unitType":"1","command":"PWR01"}`)
+
+	iscp := &ISCPMessage{}
+	err = json.Unmarshal([]byte(`{"unitType":"x","command":"DCK01"}`), iscp)
+	assertNoErr(t, err)
+	assertEqual(t, iscp.UnitType(), byte('x'))
+	assertEqual(t, iscp.Command(), ISCPCommand("DCK01"))
+
+	err = json.Unmarshal([]byte(`{"unitType":"X","command":"DCK01"}`), iscp)
+	assertErr(t, err)
+
+	data, err = json.Marshal(NewEISCPMessage("MVL2E"))
+	assertNoErr(t, err)
+	assertEqual(t, string(data), `{"version":1,"unitType":"1","command":"MVL2E"}`)
+
+	eiscp := &EISCPMessage{}
+	err = json.Unmarshal([]byte(`{"command":"MVL2E"}`), eiscp)
+	assertNoErr(t, err)
+	assertEqual(t, eiscp.Raw(), NewEISCPMessage("MVL2E").Raw())
+}
+
+func TestParsedMessage(t *testing.T) {
+	msg, err := ParseMessage(BasicCommands(), "PWR01")
+	assertNoErr(t, err)
+	assertEqual(t, msg.Name, "power")
+	assertEqual(t, msg.Value, "on")
+	assertEqual(t, msg.Group, ISCPGroup("PWR"))
+	assertEqual(t, msg.Raw, ISCPCommand("PWR01"))
+
+	data, err := json.Marshal(msg)
+	assertNoErr(t, err)
+	var decoded ParsedMessage
+	err = json.Unmarshal(data, &decoded)
+	assertNoErr(t, err)
+	assertEqual(t, decoded.Name, msg.Name)
+	assertEqual(t, decoded.Time.Equal(msg.Time), true)
+
+	_, err = ParseMessage(BasicCommands(), "XXX01")
+	assertErr(t, err)
+}
+
+func BenchmarkEISCPRaw(b *testing.B) {
+	b.ReportAllocs()
+	m := NewEISCPMessage("NTMA01:23/04:56")
+	for i := 0; i < b.N; i++ {
+		m.Raw()
+	}
+}
+
+func BenchmarkAppendEISCP(b *testing.B) {
+	b.ReportAllocs()
+	buf := make([]byte, 0, 64)
+	for i := 0; i < b.N; i++ {
+		buf = AppendEISCP(buf[:0], "NTMA01:23/04:56")
+	}
+}
+
+func BenchmarkEISCPWriteTo(b *testing.B) {
+	b.ReportAllocs()
+	m := NewEISCPMessage("NTMA01:23/04:56")
+	for i := 0; i < b.N; i++ {
+		m.WriteTo(io.Discard)
+	}
+}
@@ -0,0 +1,75 @@
+package onkyoctl
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrVetoed can be returned by middleware to stop a message.
+var ErrVetoed = errors.New("vetoed by middleware")
+
+// Middleware inspects messages before they are sent or handled.
+//
+// Send is called for every outgoing command and Receive for every
+// incoming message. Both return the command to use instead, which allows
+// to modify it, e.g. to limit the volume. Returning an error stops the
+// message: SendISCP returns the error, received messages are dropped.
+// A middleware may also block to delay a message.
+// Either function may be nil.
+type Middleware struct {
+	Send    func(cmd ISCPCommand) (ISCPCommand, error)
+	Receive func(cmd ISCPCommand) (ISCPCommand, error)
+}
+
+type middlewares struct {
+	chain []Middleware
+	lock  sync.RWMutex
+}
+
+func (m *middlewares) add(mw Middleware) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.chain = append(m.chain, mw)
+}
+
+func (m *middlewares) list() []Middleware {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.chain
+}
+
+// send passes cmd through the Send functions in the order they were added.
+func (m *middlewares) send(cmd ISCPCommand) (ISCPCommand, error) {
+	var err error
+	for _, mw := range m.list() {
+		if mw.Send == nil {
+			continue
+		}
+		cmd, err = mw.Send(cmd)
+		if err != nil {
+			return "", err
+		}
+	}
+	return cmd, nil
+}
+
+// receive passes cmd through the Receive functions in the order they were added.
+func (m *middlewares) receive(cmd ISCPCommand) (ISCPCommand, error) {
+	var err error
+	for _, mw := range m.list() {
+		if mw.Receive == nil {
+			continue
+		}
+		cmd, err = mw.Receive(cmd)
+		if err != nil {
+			return "", err
+		}
+	}
+	return cmd, nil
+}
+
+// Use adds a middleware for outgoing commands and incoming messages.
+// Middleware is called in the order it was added.
+func (d *Device) Use(mw Middleware) {
+	d.middleware.add(mw)
+}
@@ -0,0 +1,88 @@
+package onkyoctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMiddlewareSend(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+	server := newMockServer()
+
+	server.Start()
+	defer server.Stop()
+	device.Start()
+	defer device.Stop()
+	if !server.WaitConnected() {
+		t.Fatal("initial connect failed")
+	}
+	device.client.WaitConnect(time.Second)
+
+	// veto loud volume, turn "down" into a fixed level
+	device.Use(Middleware{
+		Send: func(cmd ISCPCommand) (ISCPCommand, error) {
+			if cmd == "MVL64" {
+				return cmd, ErrVetoed
+			}
+			return cmd, nil
+		},
+	})
+	device.Use(Middleware{
+		Send: func(cmd ISCPCommand) (ISCPCommand, error) {
+			if cmd == "MVLDOWN" {
+				return "MVL14", nil
+			}
+			return cmd, nil
+		},
+	})
+
+	// nothing is sent, the next message is the rewritten one
+	assertErr(t, device.SendCommand("volume", 50))
+
+	assertNoErr(t, device.SendCommand("volume", "down"))
+	data, err := server.ReadRaw()
+	assertNoErr(t, err)
+	msg, err := ParseEISCP(data)
+	assertNoErr(t, err)
+	assertEqual(t, msg.Command(), ISCPCommand("MVL14"))
+}
+
+func TestMiddlewareReceive(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+
+	device.Use(Middleware{
+		Receive: func(cmd ISCPCommand) (ISCPCommand, error) {
+			if cmd == "PWR00" {
+				return cmd, ErrVetoed
+			}
+			return cmd, nil
+		},
+	})
+	device.Use(Middleware{
+		Receive: func(cmd ISCPCommand) (ISCPCommand, error) {
+			if cmd == "AMTTG" {
+				return "AMT01", nil
+			}
+			return cmd, nil
+		},
+	})
+
+	var raw []ISCPCommand
+	device.OnRaw(func(cmd ISCPCommand) {
+		raw = append(raw, cmd)
+	})
+
+	device.handleReceived("PWR01")
+	device.handleReceived("PWR00")
+	device.handleReceived("AMTTG")
+
+	assertEqual(t, raw, []ISCPCommand{"PWR01", "AMT01"})
+	power, _ := device.Value("power")
+	assertEqual(t, power.Value, "on")
+	mute, _ := device.Value("mute")
+	assertEqual(t, mute.Value, "on")
+}
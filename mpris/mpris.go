@@ -0,0 +1,369 @@
+// Package mpris makes the network player of a Device available as an
+// MPRIS2 media player on D-Bus, so desktop media controls and tools like
+// playerctl can control it.
+//
+// Playback is controlled with NTC commands, the metadata is taken from
+// the title (NTI), artist (NAT) and album (NAL) and the play status (NST)
+// and time (NTM) reported by the receiver.
+// These commands must be in the command set of the Device,
+// see BasicCommands and examples/commands.yaml.
+//
+// See https://specifications.freedesktop.org/mpris-spec/latest/
+package mpris
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+const (
+	objectPath  = "/org/mpris/MediaPlayer2"
+	rootIface   = "org.mpris.MediaPlayer2"
+	playerIface = "org.mpris.MediaPlayer2.Player"
+	busPrefix   = "org.mpris.MediaPlayer2."
+	trackPrefix = "/org/akeil/onkyoctl/track/"
+	noTrack     = "/org/mpris/MediaPlayer2/TrackList/NoTrack"
+
+	sendTimeout = 2 * time.Second
+)
+
+// Playback status values.
+const (
+	Playing = "Playing"
+	Paused  = "Paused"
+	Stopped = "Stopped"
+)
+
+// Player is an MPRIS2 player for a Device.
+type Player struct {
+	device   *onkyo.Device
+	name     string
+	identity string
+	props    *prop.Properties
+	status   string
+	metadata map[string]dbus.Variant
+	track    int
+	lock     sync.Mutex
+}
+
+// NewPlayer creates a Player for the given device.
+// The player is registered as "org.mpris.MediaPlayer2.<name>".
+func NewPlayer(device *onkyo.Device, name string) *Player {
+	return &Player{
+		device:   device,
+		name:     name,
+		identity: fmt.Sprintf("Onkyo %v", device.Host),
+		status:   Stopped,
+		metadata: map[string]dbus.Variant{
+			"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath(noTrack)),
+		},
+	}
+}
+
+// Run registers the player on the given bus connection
+// and serves until ctx is done.
+func (p *Player) Run(ctx context.Context, conn *dbus.Conn) error {
+	err := p.export(conn)
+	if err != nil {
+		return err
+	}
+
+	reply, err := conn.RequestName(busPrefix+p.name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return err
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("bus name %v is already taken", busPrefix+p.name)
+	}
+	defer conn.ReleaseName(busPrefix + p.name)
+
+	unsubscribe := p.device.Subscribe(p.update)
+	defer unsubscribe()
+
+	for _, name := range []string{"play-status", "title", "artist", "album"} {
+		p.device.Query(name)
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+func (p *Player) export(conn *dbus.Conn) error {
+	err := conn.Export(root{}, objectPath, rootIface)
+	if err != nil {
+		return err
+	}
+	err = conn.ExportWithMap(player{p}, playerMethods, objectPath, playerIface)
+	if err != nil {
+		return err
+	}
+
+	p.props, err = prop.Export(conn, objectPath, prop.Map{
+		rootIface: {
+			"CanQuit":             constant(false),
+			"CanRaise":            constant(false),
+			"HasTrackList":        constant(false),
+			"Identity":            constant(p.identity),
+			"SupportedUriSchemes": constant([]string{}),
+			"SupportedMimeTypes":  constant([]string{}),
+		},
+		playerIface: {
+			"PlaybackStatus": changing(p.status),
+			"Metadata":       changing(p.metadata),
+			"Volume":         changing(0.0),
+			"Position":       {Value: int64(0), Emit: prop.EmitFalse},
+			"Rate":           constant(1.0),
+			"MinimumRate":    constant(1.0),
+			"MaximumRate":    constant(1.0),
+			"CanGoNext":      constant(true),
+			"CanGoPrevious":  constant(true),
+			"CanPlay":        constant(true),
+			"CanPause":       constant(true),
+			"CanSeek":        constant(false),
+			"CanControl":     constant(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	node := &introspect.Node{
+		Name: objectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:       rootIface,
+				Methods:    introspect.Methods(root{}),
+				Properties: p.props.Introspection(rootIface),
+			},
+			{
+				Name:       playerIface,
+				Methods:    playerIntrospection(),
+				Properties: p.props.Introspection(playerIface),
+			},
+		},
+	}
+	return conn.Export(introspect.NewIntrospectable(node), objectPath,
+		"org.freedesktop.DBus.Introspectable")
+}
+
+func constant(v interface{}) *prop.Prop {
+	return &prop.Prop{Value: v, Emit: prop.EmitConst}
+}
+
+func changing(v interface{}) *prop.Prop {
+	return &prop.Prop{Value: v, Emit: prop.EmitTrue}
+}
+
+// update is called for every message from the device.
+func (p *Player) update(m *onkyo.ParsedMessage) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	_, param := onkyo.SplitISCP(m.Raw)
+	switch m.Group {
+	case "NST":
+		p.status = playbackStatus(param)
+		p.props.SetMust(playerIface, "PlaybackStatus", p.status)
+	case "NTI":
+		// a new title is a new track
+		p.track++
+		p.metadata = map[string]dbus.Variant{
+			"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath(fmt.Sprintf("%v%d", trackPrefix, p.track))),
+			"xesam:title":   dbus.MakeVariant(param),
+		}
+		p.props.SetMust(playerIface, "Metadata", p.metadata)
+	case "NAT":
+		p.setMetadata("xesam:artist", []string{param})
+	case "NAL":
+		p.setMetadata("xesam:album", param)
+	case "NTM":
+		position, length, err := parseTime(param)
+		if err != nil {
+			return
+		}
+		p.props.SetMust(playerIface, "Position", position.Microseconds())
+		old, ok := p.metadata["mpris:length"]
+		if !ok || old.Value() != length.Microseconds() {
+			p.setMetadata("mpris:length", length.Microseconds())
+		}
+	case "MVL":
+		volume, err := strconv.ParseFloat(m.Value, 64)
+		if err != nil {
+			return
+		}
+		// relative to a maximum of 100
+		p.props.SetMust(playerIface, "Volume", clamp(volume/100))
+	}
+}
+
+func (p *Player) setMetadata(key string, value interface{}) {
+	metadata := make(map[string]dbus.Variant, len(p.metadata)+1)
+	for k, v := range p.metadata {
+		metadata[k] = v
+	}
+	metadata[key] = dbus.MakeVariant(value)
+	p.metadata = metadata
+	p.props.SetMust(playerIface, "Metadata", p.metadata)
+}
+
+func (p *Player) send(cmd onkyo.ISCPCommand) *dbus.Error {
+	err := p.device.SendISCP(cmd, sendTimeout)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// playbackStatus returns the MPRIS status for the NST parameter,
+// e.g. "P--" (playing, no repeat, no shuffle).
+func playbackStatus(param string) string {
+	if param == "" {
+		return Stopped
+	}
+	switch param[0] {
+	case 'P', 'F', 'R':
+		// fast forward and rewind count as playing
+		return Playing
+	case 'p':
+		return Paused
+	}
+	return Stopped
+}
+
+// parseTime parses the NTM parameter "mm:ss/mm:ss" or "hh:mm:ss/hh:mm:ss"
+// into the elapsed and total time.
+func parseTime(param string) (time.Duration, time.Duration, error) {
+	parts := strings.Split(param, "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid time %q", param)
+	}
+	elapsed, err := parseDuration(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	total, err := parseDuration(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return elapsed, total, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	fields := strings.Split(s, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			// unknown times are reported as "--:--"
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		d = d*60 + time.Duration(n)*time.Second
+	}
+	return d, nil
+}
+
+func clamp(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// root implements the org.mpris.MediaPlayer2 methods.
+type root struct{}
+
+// Raise is not supported.
+func (root) Raise() *dbus.Error {
+	return nil
+}
+
+// Quit is not supported.
+func (root) Quit() *dbus.Error {
+	return nil
+}
+
+// playerMethods maps method names that differ from the D-Bus names,
+// Seek would clash with io.Seeker.
+var playerMethods = map[string]string{
+	"SeekBy": "Seek",
+}
+
+func playerIntrospection() []introspect.Method {
+	methods := introspect.Methods(player{})
+	for i, m := range methods {
+		name, ok := playerMethods[m.Name]
+		if ok {
+			methods[i].Name = name
+		}
+	}
+	return methods
+}
+
+// player implements the org.mpris.MediaPlayer2.Player methods.
+type player struct {
+	p *Player
+}
+
+func (pl player) Next() *dbus.Error {
+	return pl.p.send("NTCTRUP")
+}
+
+func (pl player) Previous() *dbus.Error {
+	return pl.p.send("NTCTRDN")
+}
+
+func (pl player) Pause() *dbus.Error {
+	return pl.p.send("NTCPAUSE")
+}
+
+func (pl player) PlayPause() *dbus.Error {
+	pl.p.lock.Lock()
+	status := pl.p.status
+	pl.p.lock.Unlock()
+
+	if status == Playing {
+		return pl.Pause()
+	}
+	return pl.Play()
+}
+
+func (pl player) Stop() *dbus.Error {
+	return pl.p.send("NTCSTOP")
+}
+
+func (pl player) Play() *dbus.Error {
+	return pl.p.send("NTCPLAY")
+}
+
+// SeekBy is not supported (CanSeek is false).
+func (pl player) SeekBy(offset int64) *dbus.Error {
+	return nil
+}
+
+// SetPosition is not supported (CanSeek is false).
+func (pl player) SetPosition(track dbus.ObjectPath, position int64) *dbus.Error {
+	return nil
+}
+
+// OpenUri is not supported.
+func (pl player) OpenUri(uri string) *dbus.Error {
+	return dbus.MakeFailedError(fmt.Errorf("cannot open %v", uri))
+}
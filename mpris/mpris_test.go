@@ -0,0 +1,45 @@
+package mpris
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlaybackStatus(t *testing.T) {
+	cases := map[string]string{
+		"P--": Playing,
+		"F--": Playing,
+		"p-S": Paused,
+		"S--": Stopped,
+		"E--": Stopped,
+		"":    Stopped,
+	}
+	for param, expected := range cases {
+		actual := playbackStatus(param)
+		if actual != expected {
+			t.Errorf("Expected %v for %q, got %v", expected, param, actual)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	elapsed, total, err := parseTime("01:05/04:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed != 65*time.Second || total != 270*time.Second {
+		t.Errorf("Unexpected time %v/%v", elapsed, total)
+	}
+
+	_, total, err = parseTime("00:01/01:02:03")
+	if err != nil || total != time.Hour+2*time.Minute+3*time.Second {
+		t.Errorf("Unexpected time %v (%v)", total, err)
+	}
+
+	for _, param := range []string{"--:--/--:--", "01:05", "1/2", ""} {
+		_, _, err = parseTime(param)
+		if err == nil {
+			t.Errorf("Expected error for %q", param)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package onkyoctl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ISCP groups for the network player.
+const (
+	titleGroup    ISCPGroup = "NTI"
+	artistGroup   ISCPGroup = "NAT"
+	albumGroup    ISCPGroup = "NAL"
+	playTimeGroup ISCPGroup = "NTM"
+	playStatus    ISCPGroup = "NST"
+)
+
+// NowPlaying describes what the network player is playing.
+// Status is the raw NST value, e.g. "P--" for playing.
+// Elapsed and Total are zero if unknown, e.g. for a radio stream.
+type NowPlaying struct {
+	Title   string
+	Artist  string
+	Album   string
+	Status  string
+	Elapsed time.Duration
+	Total   time.Duration
+}
+
+// NowPlayingCallback receives what is playing when it changes.
+type NowPlayingCallback func(NowPlaying)
+
+// ParsePlayTime parses the parameter of an NTM message, e.g.
+// "01:23/04:56" or "1:02:03/1:30:00", into the elapsed and total time.
+// Unknown times like "--:--" are returned as zero.
+func ParsePlayTime(param string) (time.Duration, time.Duration, error) {
+	parts := strings.Split(param, "/")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("%w %q", ErrInvalidParam, param)
+	}
+	elapsed, err := parseClockTime(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w %q", ErrInvalidParam, param)
+	}
+	total, err := parseClockTime(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w %q", ErrInvalidParam, param)
+	}
+	return elapsed, total, nil
+}
+
+// parseClockTime parses "mm:ss" or "hh:mm:ss".
+func parseClockTime(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.Trim(s, "-:") == "" {
+		return 0, nil
+	}
+
+	fields := strings.Split(s, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var d time.Duration
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second, nil
+}
+
+// nowPlaying keeps track of what the network player is playing.
+type nowPlaying struct {
+	current      NowPlaying
+	lastPosition time.Time
+	interval     time.Duration
+	lock         sync.Mutex
+}
+
+// update applies a message to the current state.
+// It returns the new state and whether it should be reported.
+func (n *nowPlaying) update(group ISCPGroup, param string, now time.Time) (NowPlaying, bool) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	before := n.current
+	switch group {
+	case titleGroup:
+		n.current.Title = param
+	case artistGroup:
+		n.current.Artist = param
+	case albumGroup:
+		n.current.Album = param
+	case playStatus:
+		n.current.Status = param
+	case playTimeGroup:
+		elapsed, total, err := ParsePlayTime(param)
+		if err != nil {
+			return n.current, false
+		}
+		n.current.Elapsed, n.current.Total = elapsed, total
+		if n.current == before {
+			return n.current, false
+		}
+		// position updates arrive every second, report them less often
+		if n.interval > 0 && now.Sub(n.lastPosition) < n.interval {
+			return n.current, false
+		}
+		n.lastPosition = now
+		return n.current, true
+	default:
+		return n.current, false
+	}
+	return n.current, n.current != before
+}
+
+func (n *nowPlaying) get() NowPlaying {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.current
+}
+
+// handleNowPlaying updates what is playing from network player messages,
+// also if they are not in the command set.
+func (d *Device) handleNowPlaying(cmd ISCPCommand) {
+	group, param := SplitISCP(cmd)
+	if param == queryParam {
+		return
+	}
+	current, changed := d.playing.update(group, param, d.clock.Now())
+	if changed && d.onNowPlaying != nil {
+		d.onNowPlaying(current)
+	}
+}
+
+// NowPlaying returns what the network player is playing,
+// as far as it was reported by the device.
+func (d *Device) NowPlaying() NowPlaying {
+	return d.playing.get()
+}
+
+// OnNowPlaying sets a callback that is called when what is playing changes.
+// Changes of the play time are reported at most once per
+// Config.PositionInterval.
+func (d *Device) OnNowPlaying(callback NowPlayingCallback) {
+	d.onNowPlaying = callback
+}
@@ -0,0 +1,66 @@
+package onkyoctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePlayTime(t *testing.T) {
+	elapsed, total, err := ParsePlayTime("01:05/04:30")
+	assertNoErr(t, err)
+	assertEqual(t, elapsed, 65*time.Second)
+	assertEqual(t, total, 270*time.Second)
+
+	_, total, err = ParsePlayTime("00:01/1:02:03")
+	assertNoErr(t, err)
+	assertEqual(t, total, time.Hour+2*time.Minute+3*time.Second)
+
+	// unknown length, e.g. for radio
+	elapsed, total, err = ParsePlayTime("00:10/--:--")
+	assertNoErr(t, err)
+	assertEqual(t, elapsed, 10*time.Second)
+	assertEqual(t, total, time.Duration(0))
+
+	for _, param := range []string{"01:05", "1/2", "", "aa:bb/00:01"} {
+		_, _, err = ParsePlayTime(param)
+		assertErr(t, err)
+	}
+}
+
+func TestNowPlayingThrottle(t *testing.T) {
+	n := &nowPlaying{interval: 5 * time.Second}
+	start := time.Now()
+
+	_, changed := n.update("NTI", "Song", start)
+	assertEqual(t, changed, true)
+	_, changed = n.update("NTI", "Song", start)
+	assertEqual(t, changed, false)
+
+	_, changed = n.update("NTM", "00:01/03:00", start)
+	assertEqual(t, changed, true)
+	_, changed = n.update("NTM", "00:02/03:00", start.Add(time.Second))
+	assertEqual(t, changed, false)
+	current, changed := n.update("NTM", "00:06/03:00", start.Add(5*time.Second))
+	assertEqual(t, changed, true)
+	assertEqual(t, current.Elapsed, 6*time.Second)
+
+	// other changes are reported at once
+	_, changed = n.update("NAT", "Artist", start.Add(6*time.Second))
+	assertEqual(t, changed, true)
+}
+
+func TestDeviceNowPlaying(t *testing.T) {
+	device := NewDevice(testConfig())
+
+	var reported NowPlaying
+	device.OnNowPlaying(func(n NowPlaying) {
+		reported = n
+	})
+	device.handleReceived("NTISmells Like Teen Spirit")
+	device.handleReceived("NATNirvana")
+	device.handleReceived("NTM01:23/05:01")
+
+	assertEqual(t, reported.Artist, "Nirvana")
+	assertEqual(t, reported.Elapsed, 83*time.Second)
+	assertEqual(t, device.NowPlaying().Title, "Smells Like Teen Spirit")
+}
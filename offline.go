@@ -0,0 +1,92 @@
+package onkyoctl
+
+import (
+	"time"
+)
+
+// OfflinePolicy controls what happens to commands
+// that are sent while the client is not connected.
+type OfflinePolicy string
+
+const (
+	// OfflineError rejects the command with ErrNotConnected.
+	OfflineError OfflinePolicy = "error"
+	// OfflineDrop silently discards the command.
+	OfflineDrop OfflinePolicy = "drop"
+	// OfflineQueue keeps the command and sends it after reconnecting.
+	OfflineQueue OfflinePolicy = "queue"
+
+	defaultOfflineQueueSize = 32
+	defaultOfflineMaxAge    = time.Minute
+)
+
+// offlineQueue holds commands while the client is disconnected.
+// It is only used from the client loop.
+type offlineQueue struct {
+	policy  OfflinePolicy
+	size    int
+	maxAge  time.Duration
+	pending []sendTask
+	clock   Clock
+}
+
+func newOfflineQueue(policy OfflinePolicy, size int, maxAge time.Duration) *offlineQueue {
+	if policy == "" {
+		policy = OfflineError
+	}
+	if size <= 0 {
+		size = defaultOfflineQueueSize
+	}
+	return &offlineQueue{
+		policy: policy,
+		size:   size,
+		maxAge: maxAge,
+		clock:  systemClock{},
+	}
+}
+
+// rejects tells whether Send should fail immediately when not connected.
+func (q *offlineQueue) rejects() bool {
+	return q.policy != OfflineDrop && q.policy != OfflineQueue
+}
+
+// add handles a task that cannot be sent because we are not connected.
+func (q *offlineQueue) add(t sendTask) {
+	switch q.policy {
+	case OfflineDrop:
+		t.Reply <- nil
+	case OfflineQueue:
+		if len(q.pending) >= q.size {
+			// drop the oldest
+			q.pending[0].Reply <- ErrNotConnected
+			q.pending = q.pending[1:]
+		}
+		q.pending = append(q.pending, t)
+	default:
+		t.Reply <- ErrNotConnected
+	}
+}
+
+// take removes all pending tasks that are not expired.
+func (q *offlineQueue) take() []sendTask {
+	tasks := make([]sendTask, 0, len(q.pending))
+	for _, t := range q.pending {
+		if q.maxAge > 0 && q.clock.Now().Sub(t.Created) > q.maxAge {
+			t.Reply <- ErrNotConnected
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	q.pending = nil
+	return tasks
+}
+
+func (c *client) flushOffline() {
+	tasks := c.offline.take()
+	if len(tasks) > 0 {
+		c.log.Debug("Send %v queued messages", len(tasks))
+	}
+	for _, t := range tasks {
+		c.doSend(t)
+	}
+}
@@ -0,0 +1,77 @@
+package onkyoctl
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestTask(cmd ISCPCommand, created time.Time) sendTask {
+	return sendTask{Command: cmd, Reply: make(chan error, 1), Created: created}
+}
+
+func TestOfflineQueue(t *testing.T) {
+	q := newOfflineQueue(OfflineQueue, 2, time.Minute)
+	assertEqual(t, q.rejects(), false)
+
+	old := newTestTask("PWR01", time.Now().Add(-2*time.Minute))
+	first := newTestTask("MVL10", time.Now())
+	second := newTestTask("MVL20", time.Now())
+	q.add(old)
+	q.add(first)
+	q.add(second)
+
+	// queue full, oldest is dropped
+	assertEqual(t, <-old.Reply, ErrNotConnected)
+
+	tasks := q.take()
+	assertEqual(t, len(tasks), 2)
+	assertEqual(t, tasks[0].Command, ISCPCommand("MVL10"))
+	assertEqual(t, len(q.take()), 0)
+
+	// expired
+	q.add(newTestTask("PWR01", time.Now().Add(-2*time.Minute)))
+	assertEqual(t, len(q.take()), 0)
+
+	// drop
+	q = newOfflineQueue(OfflineDrop, 0, 0)
+	task := newTestTask("PWR01", time.Now())
+	q.add(task)
+	assertNoErr(t, <-task.Reply)
+	assertEqual(t, len(q.take()), 0)
+
+	// error is the default
+	q = newOfflineQueue("", 0, 0)
+	assertEqual(t, q.rejects(), true)
+	task = newTestTask("PWR01", time.Now())
+	q.add(task)
+	assertEqual(t, <-task.Reply, ErrNotConnected)
+}
+
+func TestOfflineQueueFlush(t *testing.T) {
+	server := newMockServer()
+	server.Start()
+	defer server.Stop()
+
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	c.offline = newOfflineQueue(OfflineQueue, 0, time.Minute)
+	ctx := context.Background()
+	c.Start(ctx)
+	defer c.Stop(ctx)
+
+	// queued while disconnected
+	assertNoErr(t, c.Send(validCommand, 0))
+
+	c.Connect(ctx)
+	if !server.WaitConnected() {
+		t.Log("Client did not connect")
+		t.Fail()
+		return
+	}
+
+	data, err := server.ReadRaw()
+	assertNoErr(t, err)
+	msg, err := ParseEISCP(data)
+	assertNoErr(t, err)
+	assertEqual(t, msg.Command(), validCommand)
+}
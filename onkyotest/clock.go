@@ -0,0 +1,158 @@
+package onkyotest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+// Clock is an onkyoctl.Clock that stands still until Advance is called.
+// Use it as Config.Clock to test reconnect delays and timeouts
+// without waiting.
+type Clock struct {
+	now    time.Time
+	timers []*fakeTimer
+	lock   sync.Mutex
+}
+
+// NewClock creates a Clock that starts at the given time.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now implements onkyoctl.Clock.
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// After implements onkyoctl.Clock.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer implements onkyoctl.Clock.
+func (c *Clock) NewTimer(d time.Duration) onkyo.Timer {
+	return c.add(d, 0)
+}
+
+// NewTicker implements onkyoctl.Clock.
+func (c *Clock) NewTicker(d time.Duration) onkyo.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.add(d, d)}
+}
+
+func (c *Clock) add(d, period time.Duration) *fakeTimer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t := &fakeTimer{
+		clock:  c,
+		when:   c.now.Add(d),
+		period: period,
+		ch:     make(chan time.Time, 1),
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Timers returns the number of active timers and tickers.
+func (c *Clock) Timers() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.timers)
+}
+
+// WaitTimers waits until there are at least n active timers and tickers,
+// e.g. to make sure a goroutine waits before calling Advance.
+func (c *Clock) WaitTimers(n int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for c.Timers() < n {
+		if time.Now().After(deadline) {
+			return ErrTimeout
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// Advance moves the clock forward and fires the timers and tickers
+// that are due, in order.
+// Like time.Ticker, tickers drop ticks for slow receivers.
+func (c *Clock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	target := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].when.Before(c.timers[j].when)
+		})
+		if len(c.timers) == 0 || c.timers[0].when.After(target) {
+			break
+		}
+
+		t := c.timers[0]
+		c.now = t.when
+		select {
+		case t.ch <- t.when:
+		default:
+		}
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			c.timers = c.timers[1:]
+		}
+	}
+	c.now = target
+}
+
+func (c *Clock) remove(t *fakeTimer) bool {
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTimer implements onkyoctl.Timer and onkyoctl.Ticker.
+type fakeTimer struct {
+	clock  *Clock
+	when   time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	active := t.clock.remove(t)
+	t.when = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	return active
+}
+
+// fakeTicker implements onkyoctl.Ticker.
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
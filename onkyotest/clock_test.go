@@ -0,0 +1,95 @@
+package onkyotest
+
+import (
+	"testing"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2021, 3, 1, 20, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+
+	timer := c.NewTimer(time.Second)
+	ticker := c.NewTicker(400 * time.Millisecond)
+	stopped := c.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Error("Expected Stop to report an active timer")
+	}
+
+	c.Advance(500 * time.Millisecond)
+	if c.Now() != start.Add(500*time.Millisecond) {
+		t.Errorf("Unexpected time %v", c.Now())
+	}
+	select {
+	case <-timer.C():
+		t.Error("Timer fired too early")
+	case tick := <-ticker.C():
+		if tick != start.Add(400*time.Millisecond) {
+			t.Errorf("Unexpected tick %v", tick)
+		}
+	}
+
+	c.Advance(500 * time.Millisecond)
+	select {
+	case fired := <-timer.C():
+		if fired != start.Add(time.Second) {
+			t.Errorf("Unexpected time %v", fired)
+		}
+	default:
+		t.Error("Timer did not fire")
+	}
+	select {
+	case <-stopped.C():
+		t.Error("Stopped timer fired")
+	default:
+	}
+
+	ticker.Stop()
+	if c.Timers() != 0 {
+		t.Errorf("Expected no timers, got %v", c.Timers())
+	}
+}
+
+func TestClockReconnect(t *testing.T) {
+	r, err := NewReceiver("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	clock := NewClock(time.Now())
+	cfg := onkyo.DefaultConfig()
+	cfg.Host = r.Host()
+	cfg.Port = r.Port()
+	cfg.AllowReconnect = true
+	cfg.ReconnectSeconds = 10
+	cfg.WatchdogSeconds = 0
+	cfg.Clock = clock
+
+	d := onkyo.NewDevice(cfg)
+	d.Start()
+	defer d.Stop()
+	err = r.WaitConnected(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Disconnect()
+	err = clock.WaitTimers(1, time.Second)
+	if err != nil {
+		t.Fatal("Reconnect was not scheduled")
+	}
+	// the delay is between 5s and 10s (jitter)
+	clock.Advance(4 * time.Second)
+	if r.WaitConnected(50*time.Millisecond) == nil {
+		t.Error("Reconnected too early")
+	}
+
+	clock.Advance(6 * time.Second)
+	err = r.WaitConnected(time.Second)
+	if err != nil {
+		t.Error("Did not reconnect")
+	}
+}
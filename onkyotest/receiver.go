@@ -0,0 +1,308 @@
+// Package onkyotest provides a fake Onkyo receiver for testing
+// integrations without hardware.
+//
+// The Receiver accepts eISCP connections, keeps the current value for each
+// configured command group and replies to commands and queries like a real
+// receiver does:
+//
+//	r, err := onkyotest.NewReceiver("127.0.0.1:0")
+//	// ...
+//	defer r.Close()
+//	r.Set("PWR00")
+//	r.Set("MVL20")
+//
+//	cfg := onkyoctl.DefaultConfig()
+//	cfg.Host = r.Host()
+//	cfg.Port = r.Port()
+//
+// Like a real receiver, it serves one client at a time;
+// a new connection closes the existing one.
+package onkyotest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+const (
+	queryParam       = "QSTN"
+	notAvailable     = "N/A"
+	receivedCapacity = 64
+)
+
+// ErrTimeout is returned when an expected event does not happen in time.
+var ErrTimeout = errors.New("timeout")
+
+// ErrNotConnected is returned by Send when no client is connected.
+var ErrNotConnected = errors.New("no client connected")
+
+// Receiver is a fake receiver listening for eISCP connections.
+type Receiver struct {
+	listener  net.Listener
+	state     map[onkyo.ISCPGroup]string
+	conn      net.Conn
+	received  chan onkyo.ISCPCommand
+	connected chan bool
+	latency   time.Duration
+	lock      sync.Mutex
+	wait      sync.WaitGroup
+}
+
+// NewReceiver starts a Receiver listening on addr.
+// Use port 0 (e.g. "127.0.0.1:0") to pick a free port.
+func NewReceiver(addr string) (*Receiver, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Receiver{
+		listener:  l,
+		state:     make(map[onkyo.ISCPGroup]string),
+		received:  make(chan onkyo.ISCPCommand, receivedCapacity),
+		connected: make(chan bool, 1),
+	}
+	r.wait.Add(1)
+	go r.accept()
+	return r, nil
+}
+
+// Addr returns the address the Receiver listens on.
+func (r *Receiver) Addr() string {
+	return r.listener.Addr().String()
+}
+
+// Host returns the host part of Addr.
+func (r *Receiver) Host() string {
+	return r.listener.Addr().(*net.TCPAddr).IP.String()
+}
+
+// Port returns the port the Receiver listens on.
+func (r *Receiver) Port() int {
+	return r.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Set sets the value for a command group, e.g. "PWR01".
+// The Receiver replies to commands and queries only for groups
+// that have a value, others are answered with "N/A".
+func (r *Receiver) Set(cmd onkyo.ISCPCommand) {
+	group, param := onkyo.SplitISCP(cmd)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.state[group] = param
+}
+
+// State returns the current value for a command group.
+func (r *Receiver) State(group onkyo.ISCPGroup) (string, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	param, ok := r.state[group]
+	return param, ok
+}
+
+// SetLatency sets a delay before each reply, like a slow receiver.
+func (r *Receiver) SetLatency(latency time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.latency = latency
+}
+
+// Send sends an unsolicited message to the connected client,
+// e.g. a status change after the volume was changed with the remote.
+// The value for the group is updated.
+func (r *Receiver) Send(cmd onkyo.ISCPCommand) error {
+	r.Set(cmd)
+	return r.write(cmd)
+}
+
+// Replay sends the received frames from a capture to the client with the
+// original timing, see onkyoctl.Replay. Frames are sent as they were
+// recorded, frames from serial connections are sent as eISCP.
+// The values for the groups are updated.
+func (r *Receiver) Replay(ctx context.Context, records []*onkyo.CaptureRecord, speed float64) error {
+	return onkyo.Replay(ctx, records, speed, func(record *onkyo.CaptureRecord) error {
+		if record.Direction != onkyo.Received {
+			return nil
+		}
+		msg, err := record.Message()
+		if err != nil {
+			// send as it is, the client should deal with it
+			return r.writeRaw(record.Frame)
+		}
+		r.Set(msg.Command())
+		if !bytes.HasPrefix(record.Frame, []byte("ISCP")) {
+			return r.writeRaw(msg.Raw())
+		}
+		return r.writeRaw(record.Frame)
+	})
+}
+
+// Next returns the next command the Receiver got from the client.
+func (r *Receiver) Next(timeout time.Duration) (onkyo.ISCPCommand, error) {
+	select {
+	case cmd := <-r.received:
+		return cmd, nil
+	case <-time.After(timeout):
+		return "", ErrTimeout
+	}
+}
+
+// WaitConnected waits until a client connects.
+func (r *Receiver) WaitConnected(timeout time.Duration) error {
+	select {
+	case <-r.connected:
+		return nil
+	case <-time.After(timeout):
+		return ErrTimeout
+	}
+}
+
+// Disconnect closes the connection to the current client.
+func (r *Receiver) Disconnect() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+}
+
+// Close stops listening and closes the client connection.
+func (r *Receiver) Close() error {
+	err := r.listener.Close()
+	r.Disconnect()
+	r.wait.Wait()
+	return err
+}
+
+func (r *Receiver) accept() {
+	defer r.wait.Done()
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		// new connection closes the existing one
+		r.Disconnect()
+		r.lock.Lock()
+		r.conn = conn
+		r.lock.Unlock()
+
+		select {
+		case r.connected <- true:
+		default:
+		}
+
+		r.wait.Add(1)
+		go r.read(conn)
+	}
+}
+
+func (r *Receiver) read(conn net.Conn) {
+	defer r.wait.Done()
+	defer conn.Close()
+	for {
+		msg, err := onkyo.ReadEISCP(conn)
+		if err != nil {
+			return
+		}
+		cmd := msg.Command()
+		if len(cmd) < 3 {
+			continue
+		}
+
+		select {
+		case r.received <- cmd:
+		default:
+			// nobody is reading, see Next
+		}
+
+		reply, latency := r.handle(cmd)
+		if latency > 0 {
+			time.Sleep(latency)
+		}
+		onkyo.NewEISCPMessage(reply).WriteTo(conn)
+	}
+}
+
+// handle applies a command to the state and returns the reply
+// and the delay before it is sent.
+func (r *Receiver) handle(cmd onkyo.ISCPCommand) (onkyo.ISCPCommand, time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.apply(cmd), r.latency
+}
+
+func (r *Receiver) apply(cmd onkyo.ISCPCommand) onkyo.ISCPCommand {
+	group, param := onkyo.SplitISCP(cmd)
+
+	current, ok := r.state[group]
+	if !ok {
+		return reply(group, notAvailable)
+	}
+	if param == queryParam {
+		return reply(group, current)
+	}
+
+	next, err := applyParam(current, param)
+	if err != nil {
+		return reply(group, notAvailable)
+	}
+	r.state[group] = next
+	return reply(group, next)
+}
+
+// applyParam returns the new value after param was sent.
+// Relative changes (UP, DOWN, TG) are applied to hex values.
+func applyParam(current, param string) (string, error) {
+	switch param {
+	case "UP", "DOWN":
+		n, err := strconv.ParseInt(current, 16, 32)
+		if err != nil {
+			return "", err
+		}
+		if param == "UP" {
+			n++
+		} else if n > 0 {
+			n--
+		}
+		return fmt.Sprintf("%0*X", len(current), n), nil
+	case "TG":
+		switch current {
+		case "00":
+			return "01", nil
+		case "01":
+			return "00", nil
+		}
+		return "", fmt.Errorf("cannot toggle %q", current)
+	}
+	return param, nil
+}
+
+func (r *Receiver) write(cmd onkyo.ISCPCommand) error {
+	return r.writeRaw(onkyo.NewEISCPMessage(cmd).Raw())
+}
+
+func (r *Receiver) writeRaw(frame []byte) error {
+	r.lock.Lock()
+	conn := r.conn
+	r.lock.Unlock()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	_, err := conn.Write(frame)
+	return err
+}
+
+func reply(group onkyo.ISCPGroup, param string) onkyo.ISCPCommand {
+	return onkyo.ISCPCommand(string(group) + param)
+}
@@ -0,0 +1,180 @@
+package onkyotest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	onkyo "github.com/akeil/onkyoctl"
+)
+
+func startDevice(t *testing.T, r *Receiver) *onkyo.Device {
+	cfg := onkyo.DefaultConfig()
+	cfg.Host = r.Host()
+	cfg.Port = r.Port()
+	cfg.AutoConnect = true
+	cfg.Commands = onkyo.BasicCommands()
+
+	d := onkyo.NewDevice(cfg)
+	d.Start()
+	t.Cleanup(d.Stop)
+	return d
+}
+
+func TestReceiver(t *testing.T) {
+	r, err := NewReceiver("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Set("PWR00")
+	r.Set("MVL20")
+
+	d := startDevice(t, r)
+
+	value, err := d.QuerySync("power")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "off" {
+		t.Errorf("Expected power off, got %v", value)
+	}
+
+	_, err = d.SendCommandSync("volume", "up")
+	if err != nil {
+		t.Fatal(err)
+	}
+	param, _ := r.State("MVL")
+	if param != "21" {
+		t.Errorf("Expected volume 21, got %v", param)
+	}
+
+	cmd, err := r.Next(time.Second)
+	if err != nil || cmd != "PWRQSTN" {
+		t.Errorf("Expected PWRQSTN, got %v, %v", cmd, err)
+	}
+
+	r.SetLatency(50 * time.Millisecond)
+	start := time.Now()
+	_, err = d.QuerySync("volume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("Expected reply after latency")
+	}
+	r.SetLatency(0)
+
+	// unknown groups are not available
+	_, err = d.QuerySync("mute")
+	if err == nil {
+		t.Error("Expected error for N/A")
+	}
+}
+
+func TestReceiverSend(t *testing.T) {
+	r, err := NewReceiver("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Set("PWR00")
+
+	if r.Send("PWR01") != ErrNotConnected {
+		t.Error("Expected ErrNotConnected")
+	}
+
+	d := startDevice(t, r)
+	err = r.WaitConnected(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- d.WaitFor(ctx, "power", "on")
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	err = r.Send("PWR00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Send("PWR01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = <-done
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestApplyParam(t *testing.T) {
+	cases := []struct {
+		current, param, expected string
+	}{
+		{"00", "01", "01"},
+		{"1F", "UP", "20"},
+		{"00", "DOWN", "00"},
+		{"0A", "DOWN", "09"},
+		{"01", "TG", "00"},
+	}
+	for _, c := range cases {
+		actual, err := applyParam(c.current, c.param)
+		if err != nil || actual != c.expected {
+			t.Errorf("Expected %v for %v+%v, got %v, %v", c.expected, c.current, c.param, actual, err)
+		}
+	}
+
+	_, err := applyParam("10", "TG")
+	if err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestReceiverReplay(t *testing.T) {
+	r, err := NewReceiver("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	d := startDevice(t, r)
+	err = r.WaitConnected(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(chan string, 4)
+	d.OnMessage(func(name, value string) {
+		messages <- name + "=" + value
+	})
+
+	start := time.Now()
+	records := []*onkyo.CaptureRecord{
+		{Time: start, Direction: onkyo.Sent, Frame: onkyo.NewEISCPMessage("PWRQSTN").Raw()},
+		{Time: start, Direction: onkyo.Received, Frame: onkyo.NewEISCPMessage("PWR01").Raw()},
+		{Time: start.Add(10 * time.Millisecond), Direction: onkyo.Received, Frame: []byte("!1AMT01")},
+	}
+	err = r.Replay(context.Background(), records, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"power=on", "mute=on"} {
+		select {
+		case m := <-messages:
+			if m != expected {
+				t.Errorf("Expected %v, got %v", expected, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Did not receive %v", expected)
+		}
+	}
+	param, _ := r.State("AMT")
+	if param != "01" {
+		t.Errorf("Expected state 01 for AMT, got %v", param)
+	}
+}
@@ -0,0 +1,29 @@
+package onkyoctl
+
+const networkControlGroup ISCPGroup = "NTC"
+
+// Play starts playback on the network player (network services, USB).
+// Like the other playback methods, it works without a "network-control"
+// command in the command set.
+func (d *Device) Play() error {
+	return d.networkControl("PLAY")
+}
+
+// Pause pauses playback on the network player.
+func (d *Device) Pause() error {
+	return d.networkControl("PAUSE")
+}
+
+// Next skips to the next track.
+func (d *Device) Next() error {
+	return d.networkControl("TRUP")
+}
+
+// Previous skips to the previous track.
+func (d *Device) Previous() error {
+	return d.networkControl("TRDN")
+}
+
+func (d *Device) networkControl(op string) error {
+	return d.SendISCP(ISCPCommand(string(networkControlGroup)+op), 0)
+}
@@ -0,0 +1,39 @@
+package onkyoctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlaybackControl(t *testing.T) {
+	cfg := testConfig()
+	device := NewDevice(cfg)
+	server := newMockServer()
+
+	server.Start()
+	defer server.Stop()
+	device.Start()
+	defer device.Stop()
+	if !server.WaitConnected() {
+		t.Fatal("initial connect failed")
+	}
+	device.client.WaitConnect(time.Second)
+
+	controls := []struct {
+		fn       func() error
+		expected ISCPCommand
+	}{
+		{device.Play, "NTCPLAY"},
+		{device.Pause, "NTCPAUSE"},
+		{device.Next, "NTCTRUP"},
+		{device.Previous, "NTCTRDN"},
+	}
+	for _, c := range controls {
+		assertNoErr(t, c.fn())
+		data, err := server.ReadRaw()
+		assertNoErr(t, err)
+		msg, err := ParseEISCP(data)
+		assertNoErr(t, err)
+		assertEqual(t, msg.Command(), c.expected)
+	}
+}
@@ -0,0 +1,93 @@
+package onkyoctl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ISCP groups for popup messages of the network player.
+const (
+	popupGroup       ISCPGroup = "NPU"
+	menuMessageGroup ISCPGroup = "NMS"
+)
+
+// popupName is the name of messages with a Popup.
+const popupName = "popup"
+
+// Popup is a message the receiver shows on screen, e.g. an error like
+// "network unavailable" or a login prompt for a network service.
+type Popup struct {
+	Type    string   `json:"type"`
+	Title   string   `json:"title"`
+	Message string   `json:"message"`
+	Buttons []string `json:"buttons,omitempty"`
+}
+
+// popupTypes are the first character of an NPU message.
+var popupTypes = map[byte]string{
+	'T': "top",
+	'L': "list",
+}
+
+// ParsePopup parses the parameter of an NPU message,
+// a type character followed by title, message and buttons,
+// separated by null characters.
+func ParsePopup(param string) (*Popup, error) {
+	if param == "" {
+		return nil, fmt.Errorf("%w %q", ErrInvalidParam, param)
+	}
+	p := &Popup{Type: popupTypes[param[0]]}
+	if p.Type == "" {
+		return nil, fmt.Errorf("unknown popup type %q", param[0])
+	}
+
+	parts := strings.Split(strings.TrimRight(param[1:], "\x00"), "\x00")
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			p.Title = part
+		case i == 1:
+			p.Message = part
+		case part != "":
+			p.Buttons = append(p.Buttons, part)
+		}
+	}
+	return p, nil
+}
+
+// handlePopup publishes NPU and NMS messages as messages named "popup",
+// also if they are not in the command set.
+// It returns true if the message was a popup.
+func (d *Device) handlePopup(cmd ISCPCommand) bool {
+	group, param := SplitISCP(cmd)
+	var popup *Popup
+	switch group {
+	case popupGroup:
+		p, err := ParsePopup(param)
+		if err != nil {
+			d.log.Warning("Error reading popup: %v", err)
+			return true
+		}
+		popup = p
+	case menuMessageGroup:
+		// a plain text message
+		popup = &Popup{Type: "message", Message: param}
+	default:
+		return false
+	}
+
+	now := d.clock.Now()
+	d.log.Debug("Received popup %q", popup.Message)
+	if d.callback != nil {
+		d.callback(popupName, popup.Message)
+	}
+	d.publish(&ParsedMessage{
+		Name:  popupName,
+		Value: popup.Message,
+		Group: group,
+		Raw:   cmd,
+		Time:  now,
+		Popup: popup,
+	})
+	return true
+}
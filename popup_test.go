@@ -0,0 +1,46 @@
+package onkyoctl
+
+import (
+	"testing"
+)
+
+func TestParsePopup(t *testing.T) {
+	p, err := ParsePopup("TSpotify\x00Please log in\x00OK\x00Cancel\x00")
+	assertNoErr(t, err)
+	assertEqual(t, p.Type, "top")
+	assertEqual(t, p.Title, "Spotify")
+	assertEqual(t, p.Message, "Please log in")
+	assertEqual(t, p.Buttons, []string{"OK", "Cancel"})
+
+	p, err = ParsePopup("LError")
+	assertNoErr(t, err)
+	assertEqual(t, p.Title, "Error")
+	assertEqual(t, p.Message, "")
+
+	_, err = ParsePopup("")
+	assertErr(t, err)
+	_, err = ParsePopup("XTitle")
+	assertErr(t, err)
+}
+
+func TestDevicePopup(t *testing.T) {
+	device := NewDevice(testConfig())
+
+	var received *ParsedMessage
+	device.Subscribe(func(m *ParsedMessage) {
+		received = m
+	})
+
+	// not in the command set
+	device.handleReceived("NPUTNetwork\x00Network unavailable\x00")
+	if received == nil || received.Popup == nil {
+		t.Fatal("popup not published")
+	}
+	assertEqual(t, received.Name, "popup")
+	assertEqual(t, received.Value, "Network unavailable")
+	assertEqual(t, received.Popup.Title, "Network")
+
+	device.handleReceived("NMSNo Media")
+	assertEqual(t, received.Group, ISCPGroup("NMS"))
+	assertEqual(t, received.Popup.Message, "No Media")
+}
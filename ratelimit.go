@@ -0,0 +1,122 @@
+package onkyoctl
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const defaultRateBurst = 5
+
+// ErrRateLimited is returned when a client exceeds its message budget.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimiter is a token bucket rate limiter with one bucket per client.
+//
+// Bridges (e.g. an HTTP API) use it to make sure that a single client
+// cannot monopolize the connection to the receiver.
+type RateLimiter struct {
+	rate    float64
+	burst   int
+	buckets map[string]*bucket
+	swept   time.Time
+	clock   Clock
+	lock    sync.Mutex
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter that allows `rate` messages per second
+// with bursts of up to `burst` messages for each client.
+// A rate of zero or less disables rate limiting.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*bucket),
+		clock:   systemClock{},
+	}
+}
+
+// SetClock replaces the system clock used to refill the buckets,
+// e.g. with the Clock from package onkyotest.
+func (r *RateLimiter) SetClock(clock Clock) {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.clock = clock
+}
+
+// Allow takes one token from the bucket for the given client.
+// It returns ErrRateLimited if no token is available.
+func (r *RateLimiter) Allow(client string) error {
+	if r == nil || r.rate <= 0 {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := r.clock.Now()
+	r.sweep(now)
+	b, ok := r.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(r.burst), last: now}
+		r.buckets[client] = b
+	}
+
+	// refill
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+	b.tokens += elapsed * r.rate
+	if b.tokens > float64(r.burst) {
+		b.tokens = float64(r.burst)
+	}
+
+	if b.tokens < 1 {
+		return ErrRateLimited
+	}
+	b.tokens--
+	return nil
+}
+
+// sweep removes the buckets that have been refilled completely.
+// A full bucket is the same as no bucket, so idle clients do not use memory.
+// To keep Allow cheap, sweep runs at most once per refill period.
+func (r *RateLimiter) sweep(now time.Time) {
+	full := time.Duration(float64(r.burst) / r.rate * float64(time.Second))
+	if now.Sub(r.swept) < full {
+		return
+	}
+	r.swept = now
+	for client, b := range r.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*r.rate >= float64(r.burst) {
+			delete(r.buckets, client)
+		}
+	}
+}
+
+// RetryAfter returns how long the given client has to wait for the next token.
+func (r *RateLimiter) RetryAfter(client string) time.Duration {
+	if r == nil || r.rate <= 0 {
+		return 0
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	b, ok := r.buckets[client]
+	if !ok || b.tokens >= 1 {
+		return 0
+	}
+	missing := 1 - b.tokens
+	return time.Duration(missing / r.rate * float64(time.Second))
+}
@@ -0,0 +1,73 @@
+package onkyoctl
+
+import (
+	"testing"
+	"time"
+)
+
+// manualClock is a Clock whose time only changes with advance.
+type manualClock struct {
+	systemClock
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.now
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestRateLimiter(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1614626103, 0)}
+	r := NewRateLimiter(1, 3)
+	r.SetClock(clock)
+
+	// burst
+	assertNoErr(t, r.Allow("a"))
+	assertNoErr(t, r.Allow("a"))
+	assertNoErr(t, r.Allow("a"))
+	assertEqual(t, r.Allow("a"), ErrRateLimited)
+	assertEqual(t, r.RetryAfter("a"), time.Second)
+
+	// other clients have their own budget
+	assertNoErr(t, r.Allow("b"))
+	assertEqual(t, r.RetryAfter("b"), r.RetryAfter("unknown"))
+
+	// refill
+	clock.advance(500 * time.Millisecond)
+	assertEqual(t, r.Allow("a"), ErrRateLimited)
+	clock.advance(500 * time.Millisecond)
+	assertNoErr(t, r.Allow("a"))
+	assertEqual(t, r.Allow("a"), ErrRateLimited)
+
+	// disabled
+	r = NewRateLimiter(0, 0)
+	for i := 0; i < 10; i++ {
+		assertNoErr(t, r.Allow("a"))
+	}
+}
+
+func TestRateLimiterEvict(t *testing.T) {
+	clock := &manualClock{now: time.Unix(1614626103, 0)}
+	r := NewRateLimiter(10, 2)
+	r.SetClock(clock)
+
+	assertNoErr(t, r.Allow("idle"))
+	assertNoErr(t, r.Allow("busy"))
+	assertNoErr(t, r.Allow("busy"))
+	assertEqual(t, len(r.buckets), 2)
+
+	// no sweep within the refill period of 200ms
+	clock.advance(150 * time.Millisecond)
+	assertNoErr(t, r.Allow("busy"))
+	assertEqual(t, len(r.buckets), 2)
+
+	// "idle" has been refilled, "busy" has not
+	clock.advance(100 * time.Millisecond)
+	assertNoErr(t, r.Allow("busy"))
+	assertEqual(t, len(r.buckets), 1)
+	_, ok := r.buckets["busy"]
+	assertEqual(t, ok, true)
+}
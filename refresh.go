@@ -0,0 +1,51 @@
+package onkyoctl
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// startRefresh queries each command in d.refresh at its interval
+// until ctx is done.
+func (d *Device) startRefresh(ctx context.Context) {
+	for name, interval := range d.refresh {
+		if interval <= 0 {
+			continue
+		}
+		go d.refreshLoop(ctx, name, interval)
+	}
+}
+
+func (d *Device) refreshLoop(ctx context.Context, name string, interval time.Duration) {
+	ticker := d.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			d.refreshOne(name)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// refreshAll queries all commands in d.refresh,
+// e.g. after a reconnect when the state may be outdated.
+func (d *Device) refreshAll() {
+	names := make([]string, 0, len(d.refresh))
+	for name := range d.refresh {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		d.refreshOne(name)
+	}
+}
+
+func (d *Device) refreshOne(name string) {
+	err := d.Query(name)
+	if err != nil {
+		d.log.Debug("Refresh %q failed: %v", name, err)
+	}
+}
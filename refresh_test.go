@@ -0,0 +1,38 @@
+package onkyoctl
+
+import (
+	"testing"
+)
+
+func TestRefresh(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	cfg.QueryCoalesceWindow = 0
+	cfg.Refresh = "power:100ms"
+	device := NewDevice(cfg)
+	server := newMockServer()
+
+	server.Start()
+	defer server.Stop()
+	device.Start()
+	defer device.Stop()
+	if !server.WaitConnected() {
+		t.Fatal("initial connect failed")
+	}
+
+	// once after connect, then periodically
+	for i := 0; i < 2; i++ {
+		var data []byte
+		var err error
+		for tries := 0; tries < 5; tries++ {
+			data, err = server.ReadRaw()
+			if err == nil {
+				break
+			}
+		}
+		assertNoErr(t, err)
+		msg, err := ParseEISCP(data)
+		assertNoErr(t, err)
+		assertEqual(t, msg.Command(), ISCPCommand("PWRQSTN"))
+	}
+}
@@ -0,0 +1,134 @@
+package onkyoctl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const scenePrefix = "scene."
+
+// Scene is a named sequence of commands, e.g. to switch on the receiver,
+// select an input and set the volume.
+//
+// In the config, scenes are defined in [scene.<name>] sections with
+// the steps as a comma separated list. A step is a command and its value
+// or "wait" and a duration:
+//
+//	[scene.movie-night]
+//	Steps = power on, wait 2s, input game, volume 40
+type Scene struct {
+	Name  string
+	Steps []SceneStep
+}
+
+// SceneStep is a single step of a Scene.
+// Steps with a non-zero Wait only pause before the next step.
+type SceneStep struct {
+	Name  string
+	Value string
+	Wait  time.Duration
+}
+
+func (s SceneStep) String() string {
+	if s.Wait > 0 {
+		return fmt.Sprintf("wait %v", s.Wait)
+	}
+	return fmt.Sprintf("%v %v", s.Name, s.Value)
+}
+
+// ParseScene creates a Scene from a comma separated list of steps.
+func ParseScene(name, steps string) (*Scene, error) {
+	scene := &Scene{Name: name}
+	for _, step := range strings.Split(steps, ",") {
+		fields := strings.Fields(step)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid step %q in scene %q", strings.TrimSpace(step), name)
+		}
+
+		if fields[0] == "wait" {
+			wait, err := time.ParseDuration(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid step %q in scene %q: %v", strings.TrimSpace(step), name, err)
+			}
+			scene.Steps = append(scene.Steps, SceneStep{Wait: wait})
+		} else {
+			scene.Steps = append(scene.Steps, SceneStep{Name: fields[0], Value: fields[1]})
+		}
+	}
+
+	if len(scene.Steps) == 0 {
+		return nil, fmt.Errorf("scene %q has no steps", name)
+	}
+	return scene, nil
+}
+
+// Scene returns the named scene from the config.
+func (c *Config) Scene(name string) (*Scene, error) {
+	s, ok := c.scenes[name]
+	if !ok {
+		return nil, fmt.Errorf("no scene %q", name)
+	}
+	return s, nil
+}
+
+// Scenes returns the names of the configured scenes.
+func (c *Config) Scenes() []string {
+	names := make([]string, 0, len(c.scenes))
+	for name := range c.scenes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns the steps in the format used by ParseScene.
+func (s *Scene) String() string {
+	steps := make([]string, len(s.Steps))
+	for i, step := range s.Steps {
+		steps[i] = step.String()
+	}
+	return strings.Join(steps, ", ")
+}
+
+// RunScene executes the steps of a scene in order.
+//
+// Each command is sent with SendCommandSync and report is called with
+// the result of every step. Failed steps do not stop the scene;
+// an error is returned if any of the steps failed.
+func (d *Device) RunScene(scene *Scene, report func(SceneStep, error)) error {
+	ctx := d.context()
+	failed := 0
+	for _, step := range scene.Steps {
+		var err error
+		if step.Wait > 0 {
+			select {
+			case <-time.After(step.Wait):
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		} else {
+			_, err = d.SendCommandSync(step.Name, step.Value)
+		}
+
+		if err != nil {
+			failed++
+		}
+		if report != nil {
+			report(step, err)
+		}
+		if step.Wait > 0 && err != nil {
+			// the device was stopped
+			break
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%v of %v steps in scene %q failed", failed, len(scene.Steps), scene.Name)
+	}
+	return nil
+}
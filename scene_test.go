@@ -0,0 +1,66 @@
+package onkyoctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScene(t *testing.T) {
+	scene, err := ParseScene("movie-night", "power on, wait 2s, input game,volume 40")
+	assertNoErr(t, err)
+	assertEqual(t, len(scene.Steps), 4)
+	assertEqual(t, scene.Steps[0], SceneStep{Name: "power", Value: "on"})
+	assertEqual(t, scene.Steps[1], SceneStep{Wait: 2 * time.Second})
+	assertEqual(t, scene.String(), "power on, wait 2s, input game, volume 40")
+
+	_, err = ParseScene("bad", "power")
+	assertErr(t, err)
+	_, err = ParseScene("bad", "wait forever")
+	assertErr(t, err)
+	_, err = ParseScene("empty", "")
+	assertErr(t, err)
+}
+
+func TestConfigScenes(t *testing.T) {
+	cfg, err := ReadConfig([]byte(`
+[scene.movie-night]
+Steps = power on, input game
+
+[scene.off]
+Steps = power off
+`))
+	assertNoErr(t, err)
+	assertEqual(t, cfg.Scenes(), []string{"movie-night", "off"})
+
+	scene, err := cfg.Scene("off")
+	assertNoErr(t, err)
+	assertEqual(t, scene.Steps, []SceneStep{{Name: "power", Value: "off"}})
+
+	_, err = cfg.Scene("party")
+	assertErr(t, err)
+
+	_, err = ReadConfig([]byte("[scene.bad]\nSteps = power\n"))
+	assertErr(t, err)
+}
+
+func TestRunScene(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = NewBasicCommandSet([]Command{
+		{Name: "power", Group: "PWR", ParamType: OnOff, ResponseTimeout: 10 * time.Millisecond},
+	})
+	device := NewDevice(cfg)
+
+	scene, err := ParseScene("test", "power on, wait 10ms, no-such-command on")
+	assertNoErr(t, err)
+
+	results := make([]error, 0)
+	err = device.RunScene(scene, func(step SceneStep, err error) {
+		results = append(results, err)
+	})
+	assertErr(t, err)
+	assertEqual(t, len(results), 3)
+	// not started
+	assertErr(t, results[0])
+	assertNoErr(t, results[1])
+	assertErr(t, results[2])
+}
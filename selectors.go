@@ -0,0 +1,136 @@
+package onkyoctl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupported is returned for input selectors the device does not have.
+var ErrUnsupported = errors.New("not supported by the device")
+
+// selectorGroups maps the input selector groups to their zone.
+var selectorGroups = map[ISCPGroup]int{
+	"SLI": 1,
+	"SLZ": 2,
+	"SL3": 3,
+	"SL4": 4,
+}
+
+// supportedCommands rejects input selectors that are not in the selector
+// list reported by the device (NRI). Everything is allowed until the
+// device has reported its selectors.
+type supportedCommands struct {
+	CommandSet
+	info *deviceInfo
+}
+
+func (s *supportedCommands) CreateCommand(name string, param interface{}) (ISCPCommand, error) {
+	cmd, err := s.CommandSet.CreateCommand(name, param)
+	if err != nil {
+		return "", err
+	}
+	group, code := SplitISCP(cmd)
+	zone, ok := selectorGroups[group]
+	if !ok || !isSelectorCode(code) {
+		return cmd, nil
+	}
+
+	selectors := s.info.selectors()
+	if len(selectors) == 0 {
+		return cmd, nil
+	}
+	for _, sel := range selectors {
+		if sel.ID == code && sel.InZone(zone) {
+			return cmd, nil
+		}
+	}
+	valid := supportedValues(s.CommandSet, group, selectors, zone)
+	return "", fmt.Errorf("%w: %v %q, valid are: %v", ErrUnsupported, name, param,
+		strings.Join(valid, ", "))
+}
+
+func (s *supportedCommands) Commands() []Command {
+	return ListCommands(s.CommandSet)
+}
+
+func (s *supportedCommands) ForName(name string) (Command, error) {
+	lookup, ok := s.CommandSet.(commandLookup)
+	if !ok {
+		return Command{}, fmt.Errorf("%w %q", ErrUnknownCommand, name)
+	}
+	return lookup.ForName(name)
+}
+
+func (s *supportedCommands) ForGroup(group ISCPGroup) (Command, error) {
+	lookup, ok := s.CommandSet.(commandLookup)
+	if !ok {
+		return Command{}, fmt.Errorf("unknown ISCP group %q", group)
+	}
+	return lookup.ForGroup(group)
+}
+
+// isSelectorCode tells whether an SLI parameter selects an input,
+// as opposed to e.g. "UP" or "QSTN".
+func isSelectorCode(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, r := range code {
+		if !strings.ContainsRune("0123456789ABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// supportedValues returns the friendly values for the selectors in a zone.
+// Selectors that are not in the command's lookup are listed by their code.
+func supportedValues(commands CommandSet, group ISCPGroup, selectors []Selector, zone int) []string {
+	// all zones use the same codes as SLI
+	var lookup map[string]string
+	if l, ok := commands.(commandLookup); ok {
+		c, err := l.ForGroup(group)
+		if err != nil {
+			c, err = l.ForGroup("SLI")
+		}
+		if err == nil {
+			lookup = c.Lookup
+		}
+	}
+	values := make([]string, 0, len(selectors))
+	for _, sel := range selectors {
+		if !sel.InZone(zone) {
+			continue
+		}
+		value, ok := lookup[sel.ID]
+		if !ok {
+			value = sel.ID
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+func (d *deviceInfo) selectors() []Selector {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.current.Selectors
+}
+
+// SupportedInputs returns the input selectors the device has in the
+// given zone (1 for the main zone), as reported in response to RequestInfo.
+// It returns nil if the device has not reported its selectors.
+func (d *Device) SupportedInputs(zone int) []string {
+	selectors := d.hardware.selectors()
+	if len(selectors) == 0 {
+		return nil
+	}
+	group := ISCPGroup("SLI")
+	for g, z := range selectorGroups {
+		if z == zone {
+			group = g
+		}
+	}
+	return supportedValues(d.commandSet(), group, selectors, zone)
+}
@@ -0,0 +1,135 @@
+package onkyoctl
+
+import (
+	"errors"
+	"time"
+)
+
+// QueuePolicy controls what happens to commands
+// that are sent while the send queue is full.
+type QueuePolicy string
+
+const (
+	// QueueBlock waits for a free slot, at most SendQueueTimeout.
+	QueueBlock QueuePolicy = "block"
+	// QueueError rejects the command with ErrQueueFull.
+	QueueError QueuePolicy = "error"
+	// QueueDropOldest discards the oldest waiting command.
+	QueueDropOldest QueuePolicy = "drop-oldest"
+
+	defaultSendQueueSize    = 32
+	defaultSendQueueTimeout = 5 * time.Second
+)
+
+// Priority decides the order in which waiting commands are sent.
+// Commands with a higher priority are sent before waiting commands
+// with a lower priority, e.g. user input before background queries.
+type Priority string
+
+const (
+	// PriorityHigh is for commands that should not wait, e.g. power or mute.
+	PriorityHigh Priority = "high"
+	// PriorityNormal is the default.
+	PriorityNormal Priority = "normal"
+	// PriorityLow is for background traffic, e.g. queries.
+	PriorityLow Priority = "low"
+)
+
+// ErrQueueFull is returned when a command does not fit into the send queue.
+var ErrQueueFull = errors.New("send queue full")
+
+// setSendQueue replaces the send queue, it must be called before the
+// client is started.
+func (c *client) setSendQueue(size int, policy QueuePolicy, timeout time.Duration) {
+	if size <= 0 {
+		size = defaultSendQueueSize
+	}
+	if policy == "" {
+		policy = QueueBlock
+	}
+	if timeout <= 0 {
+		timeout = defaultSendQueueTimeout
+	}
+	c.sendHigh = make(chan sendTask, size)
+	c.send = make(chan sendTask, size)
+	c.sendLow = make(chan sendTask, size)
+	c.queuePolicy = policy
+	c.queueTimeout = timeout
+}
+
+// queue returns the send queue for the given priority.
+func (c *client) queue(p Priority) chan sendTask {
+	switch p {
+	case PriorityHigh:
+		return c.sendHigh
+	case PriorityLow:
+		return c.sendLow
+	default:
+		return c.send
+	}
+}
+
+// enqueue adds a task to the send queue according to the queue policy.
+func (c *client) enqueue(t sendTask) error {
+	queue := c.queue(t.Priority)
+	switch c.queuePolicy {
+	case QueueError:
+		select {
+		case queue <- t:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	case QueueDropOldest:
+		for {
+			select {
+			case queue <- t:
+				return nil
+			default:
+			}
+			// the client loop may have taken a task in the meantime
+			select {
+			case old := <-queue:
+				c.log.Warning("Send queue full, dropping %v", old.Command)
+				c.stats.droppedSend()
+				old.Reply <- ErrQueueFull
+			default:
+			}
+		}
+	default:
+		select {
+		case queue <- t:
+			return nil
+		default:
+		}
+		// a stopped client will not free a slot
+		select {
+		case queue <- t:
+			return nil
+		case <-c.doneChan():
+			return ErrNotConnected
+		case <-c.clock.After(c.queueTimeout):
+			return ErrQueueFull
+		}
+	}
+}
+
+// sendNext sends the given task after all waiting tasks
+// with a higher priority.
+func (c *client) sendNext(t sendTask) {
+	higher := []chan sendTask{c.sendHigh}
+	if t.Priority == PriorityLow {
+		higher = append(higher, c.send)
+	}
+	for _, queue := range higher {
+		for done := false; !done; {
+			select {
+			case h := <-queue:
+				c.doSend(h)
+			default:
+				done = true
+			}
+		}
+	}
+	c.doSend(t)
+}
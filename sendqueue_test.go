@@ -0,0 +1,98 @@
+package onkyoctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendQueueError(t *testing.T) {
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	c.setSendQueue(1, QueueError, 0)
+
+	assertNoErr(t, c.enqueue(newTestTask("PWR01", time.Now())))
+	assertEqual(t, c.enqueue(newTestTask("PWR00", time.Now())), ErrQueueFull)
+	assertEqual(t, len(c.send), 1)
+}
+
+func TestSendQueueDropOldest(t *testing.T) {
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	c.setSendQueue(2, QueueDropOldest, 0)
+
+	first := newTestTask("MVL10", time.Now())
+	assertNoErr(t, c.enqueue(first))
+	assertNoErr(t, c.enqueue(newTestTask("MVL20", time.Now())))
+	assertNoErr(t, c.enqueue(newTestTask("MVL30", time.Now())))
+
+	assertEqual(t, <-first.Reply, ErrQueueFull)
+	assertEqual(t, c.stats.get().DroppedSends, uint64(1))
+	assertEqual(t, (<-c.send).Command, ISCPCommand("MVL20"))
+	assertEqual(t, (<-c.send).Command, ISCPCommand("MVL30"))
+}
+
+func TestSendQueueBlock(t *testing.T) {
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	c.setSendQueue(1, "", 50*time.Millisecond)
+	assertEqual(t, c.queuePolicy, QueueBlock)
+
+	assertNoErr(t, c.enqueue(newTestTask("PWR01", time.Now())))
+	start := time.Now()
+	assertEqual(t, c.enqueue(newTestTask("PWR00", time.Now())), ErrQueueFull)
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("did not wait for a free slot")
+	}
+
+	// a free slot ends the wait
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-c.send
+	}()
+	c.queueTimeout = time.Second
+	assertNoErr(t, c.enqueue(newTestTask("PWR00", time.Now())))
+
+	// a stopped client ends the wait
+	c.done = make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(c.done)
+	}()
+	start = time.Now()
+	assertEqual(t, c.enqueue(newTestTask("MVL20", time.Now())), ErrNotConnected)
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("kept waiting after stop")
+	}
+}
+
+func TestSendPriority(t *testing.T) {
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	// not connected, sent tasks end up in the offline queue in order
+	c.offline = newOfflineQueue(OfflineQueue, 0, time.Minute)
+
+	task := func(cmd ISCPCommand, p Priority) sendTask {
+		t := newTestTask(cmd, time.Now())
+		t.Priority = p
+		return t
+	}
+	assertNoErr(t, c.enqueue(task("MVL10", PriorityNormal)))
+	assertNoErr(t, c.enqueue(task("PWR01", PriorityHigh)))
+	assertNoErr(t, c.enqueue(task("AMT01", PriorityHigh)))
+
+	c.sendNext(task("PWRQSTN", PriorityLow))
+
+	var sent []ISCPCommand
+	for _, t := range c.offline.take() {
+		sent = append(sent, t.Command)
+	}
+	assertEqual(t, sent, []ISCPCommand{"PWR01", "AMT01", "MVL10", "PWRQSTN"})
+}
+
+func TestDevicePriority(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+
+	assertEqual(t, device.priority("PWR01"), PriorityHigh)
+	assertEqual(t, device.priority("PWRQSTN"), PriorityHigh)
+	assertEqual(t, device.priority("MVL20"), PriorityNormal)
+	assertEqual(t, device.priority("MVLQSTN"), PriorityLow)
+	assertEqual(t, device.priority("XYZQSTN"), PriorityLow)
+}
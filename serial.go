@@ -0,0 +1,87 @@
+package onkyoctl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/tarm/serial"
+)
+
+const (
+	// TransportTCP connects to the device over the network (eISCP).
+	TransportTCP = "tcp"
+	// TransportSerial connects to the device over RS-232 (ISCP).
+	TransportSerial = "serial"
+
+	defaultBaudRate = 9600
+)
+
+// iscpFraming is used for serial connections.
+//
+// Messages are sent as "!1<COMMAND>\r",
+// the device terminates its messages with EOF (0x1A) and/or CR/LF.
+type iscpFraming struct{}
+
+func (i iscpFraming) encode(buf []byte, cmd ISCPCommand) []byte {
+	buf = append(buf, iscpStart...)
+	buf = append(buf, unitTypeReceiver)
+	buf = append(buf, cmd...)
+	return append(buf, '\r')
+}
+
+func (i iscpFraming) read(r *bufio.Reader) ([]byte, error) {
+	line := make([]byte, 0, 32)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if b == eof || b == cr || b == lf {
+			// skip empty lines between messages
+			if len(line) == 0 {
+				continue
+			}
+			return line, nil
+		}
+
+		if len(line) >= maxMessageSize {
+			return nil, ErrPayloadTooLarge
+		}
+		line = append(line, b)
+	}
+}
+
+func (i iscpFraming) decode(data []byte) (ISCPCommand, error) {
+	msg, err := ParseISCP(data)
+	if err != nil {
+		return "", err
+	}
+	return msg.Command(), nil
+}
+
+// serialDialer opens the serial port with the given device path
+// and baud rate (8N1).
+//
+// Reads block until data arrives. With a read timeout, the port reports
+// a silent receiver as EOF, which looks like a closed connection.
+// A stalled serial link is detected by the watchdog instead.
+func serialDialer(device string, baud int) func() (io.ReadWriteCloser, error) {
+	if baud <= 0 {
+		baud = defaultBaudRate
+	}
+	return func() (io.ReadWriteCloser, error) {
+		return serial.OpenPort(&serial.Config{
+			Name: device,
+			Baud: baud,
+		})
+	}
+}
+
+// unknownTransport returns a dialer that fails for an unsupported transport.
+func unknownTransport(name string) func() (io.ReadWriteCloser, error) {
+	return func() (io.ReadWriteCloser, error) {
+		return nil, fmt.Errorf("unknown transport %q", name)
+	}
+}
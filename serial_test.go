@@ -0,0 +1,42 @@
+package onkyoctl
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestISCPFraming(t *testing.T) {
+	f := iscpFraming{}
+
+	assertEqual(t, f.encode(nil, "PWR01"), []byte("!1PWR01\r"))
+
+	r := bufio.NewReader(strings.NewReader("!1PWR01\x1a\r\n!1MVL2E\x1a"))
+
+	data, err := f.read(r)
+	assertNoErr(t, err)
+	cmd, err := f.decode(data)
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("PWR01"))
+
+	data, err = f.read(r)
+	assertNoErr(t, err)
+	cmd, err = f.decode(data)
+	assertNoErr(t, err)
+	assertEqual(t, cmd, ISCPCommand("MVL2E"))
+
+	_, err = f.read(r)
+	assertErr(t, err)
+
+	_, err = f.decode([]byte("PWR01"))
+	assertErr(t, err)
+}
+
+func TestUnknownTransport(t *testing.T) {
+	cfg := testConfig()
+	cfg.Transport = "carrier-pigeon"
+	device := NewDevice(cfg)
+
+	_, err := device.client.createConn()
+	assertErr(t, err)
+}
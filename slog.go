@@ -0,0 +1,80 @@
+//go:build go1.21
+// +build go1.21
+
+package onkyoctl
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// NewSlogLogger returns a Logger that writes to the given slog.Handler.
+//
+// Messages about ISCP traffic and the connection carry structured
+// attributes like "direction", "group", "command" and "state".
+func NewSlogLogger(h slog.Handler) Logger {
+	return &slogLogger{slog.New(h)}
+}
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// LevelTrace is the slog level used for Trace messages.
+const LevelTrace = slog.LevelDebug - 4
+
+var slogLevels = map[LogLevel]slog.Level{
+	Trace:   LevelTrace,
+	Debug:   slog.LevelDebug,
+	Info:    slog.LevelInfo,
+	Warning: slog.LevelWarn,
+	Error:   slog.LevelError,
+}
+
+func (l *slogLogger) Trace(msg string, v ...interface{}) {
+	l.Log(Trace, fmt.Sprintf(msg, v...), nil)
+}
+
+func (l *slogLogger) Debug(msg string, v ...interface{}) {
+	l.Log(Debug, fmt.Sprintf(msg, v...), nil)
+}
+
+func (l *slogLogger) Info(msg string, v ...interface{}) {
+	l.Log(Info, fmt.Sprintf(msg, v...), nil)
+}
+
+func (l *slogLogger) Warning(msg string, v ...interface{}) {
+	l.Log(Warning, fmt.Sprintf(msg, v...), nil)
+}
+
+func (l *slogLogger) Error(msg string, v ...interface{}) {
+	l.Log(Error, fmt.Sprintf(msg, v...), nil)
+}
+
+// WithFields implements ContextLogger.
+func (l *slogLogger) WithFields(fields Fields) Logger {
+	args := make([]interface{}, 0, len(fields))
+	for _, k := range sortedFields(fields) {
+		args = append(args, slog.Any(k, fields[k]))
+	}
+	return &slogLogger{l.logger.With(args...)}
+}
+
+// Log implements FieldLogger.
+func (l *slogLogger) Log(level LogLevel, msg string, fields Fields) {
+	lvl, ok := slogLevels[level]
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	if !l.logger.Enabled(ctx, lvl) {
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, k := range sortedFields(fields) {
+		attrs = append(attrs, slog.Any(k, fields[k]))
+	}
+	l.logger.LogAttrs(ctx, lvl, msg, attrs...)
+}
@@ -0,0 +1,56 @@
+//go:build go1.21
+// +build go1.21
+
+package onkyoctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	l.Debug("not logged")
+	l.Warning("Error reading %q", "PWR")
+	logFields(l, Info, messageFields("recv", "PWR01"), "<- recv: %v", "PWR01")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assertEqual(t, len(lines), 2)
+
+	var record map[string]interface{}
+	assertNoErr(t, json.Unmarshal([]byte(lines[0]), &record))
+	assertEqual(t, record["level"], "WARN")
+	assertEqual(t, record["msg"], `Error reading "PWR"`)
+
+	assertNoErr(t, json.Unmarshal([]byte(lines[1]), &record))
+	assertEqual(t, record["msg"], "<- recv: PWR01")
+	assertEqual(t, record["direction"], "recv")
+	assertEqual(t, record["group"], "PWR")
+	assertEqual(t, record["command"], "PWR01")
+}
+
+func TestSlogTrace(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: LevelTrace}))
+	logTrace(l, 2, Received, []byte("!1PWR01"))
+	assertEqual(t, strings.Contains(buf.String(), "conn=2 dir=recv len=7 data=21 31 50 57 52 30 31"), true)
+}
+
+func TestSlogWithFields(t *testing.T) {
+	var buf bytes.Buffer
+	base := NewSlogLogger(slog.NewJSONHandler(&buf, nil))
+	l := WithFields(base, Fields{"device": "office", "host": "192.168.1.3"})
+	logFields(l, Info, Fields{"state": "connected"}, "Connection state changed")
+
+	var record map[string]interface{}
+	assertNoErr(t, json.Unmarshal(buf.Bytes(), &record))
+	assertEqual(t, record["msg"], "Connection state changed")
+	assertEqual(t, record["device"], "office")
+	assertEqual(t, record["host"], "192.168.1.3")
+	assertEqual(t, record["state"], "connected")
+}
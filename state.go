@@ -0,0 +1,51 @@
+package onkyoctl
+
+import (
+	"sync"
+	"time"
+)
+
+// state keeps the last value received for each command.
+type state struct {
+	values map[string]HistoryEntry
+	lock   sync.RWMutex
+}
+
+func newState() *state {
+	return &state{values: make(map[string]HistoryEntry)}
+}
+
+func (s *state) set(name, value string, t time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values[name] = HistoryEntry{Time: t, Value: value}
+}
+
+func (s *state) get(name string) (HistoryEntry, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	e, ok := s.values[name]
+	return e, ok
+}
+
+func (s *state) all() map[string]HistoryEntry {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	result := make(map[string]HistoryEntry, len(s.values))
+	for name, e := range s.values {
+		result[name] = e
+	}
+	return result
+}
+
+// State returns the last value received for each command.
+// Only commands the device has reported since the start are included.
+func (d *Device) State() map[string]HistoryEntry {
+	return d.state.all()
+}
+
+// Value returns the last value received for the given friendly name.
+// The second return value is false if no value was received yet.
+func (d *Device) Value(name string) (HistoryEntry, bool) {
+	return d.state.get(name)
+}
@@ -0,0 +1,111 @@
+package onkyoctl
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats holds counters for the connection to the device.
+type Stats struct {
+	BytesIn    uint64
+	BytesOut   uint64
+	FramesIn   uint64
+	FramesOut  uint64
+	Connects   uint64
+	Reconnects uint64
+	SendErrors uint64
+	// DroppedCallbacks counts events that were not passed to the
+	// callbacks because the callback queue was full.
+	DroppedCallbacks uint64
+	// DroppedSends counts commands that were discarded
+	// because the send queue was full.
+	DroppedSends  uint64
+	LastReceived  time.Time
+	LastSent      time.Time
+	LastConnected time.Time
+}
+
+// StatsCallback is called with the current Stats whenever they change.
+type StatsCallback func(Stats)
+
+type statsCounter struct {
+	stats    Stats
+	callback StatsCallback
+	clock    Clock
+	lock     sync.Mutex
+}
+
+func (s *statsCounter) get() Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.stats
+}
+
+func (s *statsCounter) update(fn func(*Stats)) {
+	s.lock.Lock()
+	fn(&s.stats)
+	current := s.stats
+	callback := s.callback
+	s.lock.Unlock()
+
+	if callback != nil {
+		callback(current)
+	}
+}
+
+func (s *statsCounter) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+func (s *statsCounter) setCallback(callback StatsCallback) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.callback = callback
+}
+
+func (s *statsCounter) received(n int) {
+	s.update(func(st *Stats) {
+		st.BytesIn += uint64(n)
+		st.FramesIn++
+		st.LastReceived = s.now()
+	})
+}
+
+func (s *statsCounter) sent(n int) {
+	s.update(func(st *Stats) {
+		st.BytesOut += uint64(n)
+		st.FramesOut++
+		st.LastSent = s.now()
+	})
+}
+
+func (s *statsCounter) droppedCallback() {
+	s.update(func(st *Stats) {
+		st.DroppedCallbacks++
+	})
+}
+
+func (s *statsCounter) droppedSend() {
+	s.update(func(st *Stats) {
+		st.DroppedSends++
+	})
+}
+
+func (s *statsCounter) sendError() {
+	s.update(func(st *Stats) {
+		st.SendErrors++
+	})
+}
+
+func (s *statsCounter) connected() {
+	s.update(func(st *Stats) {
+		if st.Connects > 0 {
+			st.Reconnects++
+		}
+		st.Connects++
+		st.LastConnected = s.now()
+	})
+}
@@ -0,0 +1,31 @@
+package onkyoctl
+
+import (
+	"testing"
+)
+
+func TestStatsCounter(t *testing.T) {
+	s := &statsCounter{}
+
+	calls := 0
+	s.setCallback(func(Stats) {
+		calls++
+	})
+
+	s.connected()
+	s.received(20)
+	s.received(30)
+	s.sent(25)
+	s.sendError()
+	s.connected()
+
+	stats := s.get()
+	assertEqual(t, stats.BytesIn, uint64(50))
+	assertEqual(t, stats.FramesIn, uint64(2))
+	assertEqual(t, stats.BytesOut, uint64(25))
+	assertEqual(t, stats.FramesOut, uint64(1))
+	assertEqual(t, stats.SendErrors, uint64(1))
+	assertEqual(t, stats.Connects, uint64(2))
+	assertEqual(t, stats.Reconnects, uint64(1))
+	assertEqual(t, calls, 6)
+}
@@ -0,0 +1,126 @@
+package onkyoctl
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// throttle limits how often messages for a command are delivered
+// to callbacks and subscribers. Messages that arrive too early are
+// held back, only the last one is delivered at the end of the interval.
+type throttle struct {
+	intervals map[string]time.Duration
+	last      map[string]time.Time
+	pending   map[string]*heldMessage
+	clock     Clock
+	lock      sync.Mutex
+}
+
+// heldMessage is the last message held back for a command
+// and the timer that delivers it.
+type heldMessage struct {
+	m     *ParsedMessage
+	timer Timer
+	stop  chan struct{}
+}
+
+func newThrottle(intervals map[string]time.Duration, clock Clock) *throttle {
+	return &throttle{
+		intervals: intervals,
+		last:      make(map[string]time.Time),
+		pending:   make(map[string]*heldMessage),
+		clock:     clock,
+	}
+}
+
+func (t *throttle) setIntervals(intervals map[string]time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.intervals = intervals
+}
+
+// hold returns true if the message must not be delivered now.
+// deliver is called with the last held message when the interval is over.
+// If ctx is done before that, the held message is dropped.
+func (t *throttle) hold(ctx context.Context, m *ParsedMessage, deliver func(*ParsedMessage)) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	interval := t.intervals[m.Name]
+	if interval <= 0 {
+		return false
+	}
+	now := t.clock.Now()
+	elapsed := now.Sub(t.last[m.Name])
+	if elapsed >= interval {
+		t.last[m.Name] = now
+		return false
+	}
+
+	if h, waiting := t.pending[m.Name]; waiting {
+		h.m = m
+		return true
+	}
+	h := &heldMessage{
+		m:     m,
+		timer: t.clock.NewTimer(interval - elapsed),
+		stop:  make(chan struct{}),
+	}
+	t.pending[m.Name] = h
+	go func() {
+		select {
+		case <-h.timer.C():
+			if held := t.take(m.Name, h); held != nil {
+				deliver(held)
+			}
+		case <-ctx.Done():
+			h.timer.Stop()
+			t.take(m.Name, h)
+		case <-h.stop:
+		}
+	}()
+	return true
+}
+
+// take removes the held message for name if it still belongs to h.
+func (t *throttle) take(name string, h *heldMessage) *ParsedMessage {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.pending[name] != h {
+		return nil
+	}
+	delete(t.pending, name)
+	t.last[name] = t.clock.Now()
+	return h.m
+}
+
+// reset stops all pending timers and drops the held messages.
+func (t *throttle) reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for name, h := range t.pending {
+		h.timer.Stop()
+		close(h.stop)
+		delete(t.pending, name)
+	}
+}
+
+// parseIntervals reads "name:interval" pairs as used by Config.Throttle
+// and Config.Refresh.
+func parseIntervals(s string) (map[string]time.Duration, error) {
+	pairs, err := parseLabels(s)
+	if err != nil {
+		return nil, err
+	}
+	intervals := make(map[string]time.Duration, len(pairs))
+	for name, value := range pairs {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval for %q: %w", name, err)
+		}
+		intervals[name] = d
+	}
+	return intervals, nil
+}
@@ -0,0 +1,83 @@
+package onkyoctl
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottle(t *testing.T) {
+	th := newThrottle(map[string]time.Duration{"volume": 50 * time.Millisecond}, systemClock{})
+	delivered := make(chan *ParsedMessage, 1)
+	deliver := func(m *ParsedMessage) {
+		delivered <- m
+	}
+
+	// first one passes, then the last one wins
+	assertEqual(t, th.hold(context.Background(), &ParsedMessage{Name: "volume", Value: "20"}, deliver), false)
+	assertEqual(t, th.hold(context.Background(), &ParsedMessage{Name: "volume", Value: "21"}, deliver), true)
+	assertEqual(t, th.hold(context.Background(), &ParsedMessage{Name: "volume", Value: "22"}, deliver), true)
+	// not throttled
+	assertEqual(t, th.hold(context.Background(), &ParsedMessage{Name: "power", Value: "on"}, deliver), false)
+
+	select {
+	case m := <-delivered:
+		assertEqual(t, m.Value, "22")
+	case <-time.After(time.Second):
+		t.Fatal("held message not delivered")
+	}
+	select {
+	case m := <-delivered:
+		t.Errorf("unexpected message %v", m.Value)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestThrottleDropOnCancel(t *testing.T) {
+	th := newThrottle(map[string]time.Duration{"volume": 50 * time.Millisecond}, systemClock{})
+	delivered := make(chan *ParsedMessage, 1)
+	deliver := func(m *ParsedMessage) {
+		delivered <- m
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assertEqual(t, th.hold(ctx, &ParsedMessage{Name: "volume", Value: "20"}, deliver), false)
+	assertEqual(t, th.hold(ctx, &ParsedMessage{Name: "volume", Value: "21"}, deliver), true)
+	cancel()
+
+	select {
+	case m := <-delivered:
+		t.Errorf("unexpected message %v", m.Value)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestThrottleReset(t *testing.T) {
+	th := newThrottle(map[string]time.Duration{"volume": 50 * time.Millisecond}, systemClock{})
+	delivered := make(chan *ParsedMessage, 1)
+	deliver := func(m *ParsedMessage) {
+		delivered <- m
+	}
+
+	assertEqual(t, th.hold(context.Background(), &ParsedMessage{Name: "volume", Value: "20"}, deliver), false)
+	assertEqual(t, th.hold(context.Background(), &ParsedMessage{Name: "volume", Value: "21"}, deliver), true)
+	th.reset()
+
+	select {
+	case m := <-delivered:
+		t.Errorf("unexpected message %v", m.Value)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestParseIntervals(t *testing.T) {
+	intervals, err := parseIntervals("volume:250ms, Play-Time:1s")
+	assertNoErr(t, err)
+	assertEqual(t, intervals, map[string]time.Duration{
+		"volume":    250 * time.Millisecond,
+		"play-time": time.Second,
+	})
+
+	_, err = parseIntervals("volume:often")
+	assertErr(t, err)
+}
@@ -2,11 +2,13 @@ package onkyoctl
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +22,11 @@ const (
 	Disconnecting
 )
 
+const (
+	defaultDialTimeout  = 3 * time.Second
+	defaultWriteTimeout = 5 * time.Second
+)
+
 var (
 	ErrNotConnected = errors.New("not connected")
 	ErrTimeout      = errors.New("timeout")
@@ -29,60 +36,176 @@ var (
 type MessageHandler func(ISCPCommand)
 
 type sendTask struct {
-	Command ISCPCommand
-	Reply   chan error
+	Command  ISCPCommand
+	Reply    chan error
+	Created  time.Time
+	Priority Priority
 }
 
 type client struct {
 	host           string
 	port           int
-	timeout        time.Duration
+	dialTimeout    time.Duration
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
 	state          ConnectionState
-	conn           net.Conn
+	conn           io.ReadWriteCloser
+	dial           func() (io.ReadWriteCloser, error)
+	dialTCP        DialFunc
+	socket         socketOptions
+	framing        framing
+	offline        *offlineQueue
+	stats          statsCounter
 	connLock       sync.Mutex
-	done           chan bool
+	running        bool
+	loopGen        int64 // atomic
+	loopBeat       int64 // atomic, unix nanos
+	reading        int64 // atomic, connID of the running read loop or 0
+	version        int32 // atomic, eISCP version of the last message
+	connID         int   // counts connections, for trace logs
+	clock          Clock
+	sendBuf        []byte
+	sendBufLock    sync.Mutex
+	dispatcher     *dispatcher
+	watchdog       time.Duration
+	captureFile    string
+	captureWriter  *CaptureWriter
+	frameCB        func(CaptureRecord)
+	done           chan struct{} // closed when the client is stopped
 	wantConnect    chan bool
 	wantDisconnect chan bool
 	received       chan ISCPCommand
+	sendHigh       chan sendTask
 	send           chan sendTask
+	sendLow        chan sendTask
+	queuePolicy    QueuePolicy
+	queueTimeout   time.Duration
 	handler        MessageHandler
 	connectionCB   func(ConnectionState)
+	errorCB        func(error)
 	log            Logger
 }
 
 func newClient(host string, port int, log Logger) *client {
-	return &client{
+	c := &client{
 		host:           host,
 		port:           port,
-		timeout:        3 * time.Second,
+		dialTimeout:    defaultDialTimeout,
+		writeTimeout:   defaultWriteTimeout,
 		state:          Disconnected,
-		done:           make(chan bool),
 		wantConnect:    make(chan bool),
 		wantDisconnect: make(chan bool),
 		received:       make(chan ISCPCommand, 32),
-		send:           make(chan sendTask, 32),
+		sendHigh:       make(chan sendTask, defaultSendQueueSize),
+		send:           make(chan sendTask, defaultSendQueueSize),
+		sendLow:        make(chan sendTask, defaultSendQueueSize),
+		queuePolicy:    QueueBlock,
+		framing:        eiscpFraming{},
+		socket:         socketOptions{noDelay: true},
+		offline:        newOfflineQueue(OfflineError, 0, 0),
+		clock:          systemClock{},
 		log:            log,
 	}
+	c.setCallbackQueue(0)
+	return c
+}
+
+// setCallbackQueue sets the size of the queue for callbacks, see dispatcher.
+func (c *client) setCallbackQueue(size int) {
+	c.dispatcher = newDispatcher(size, func(r interface{}) {
+		c.log.Error("Panic in callback: %v", r)
+		c.reportError(fmt.Errorf("callback: panic: %v", r))
+	})
+}
+
+// setClock sets the clock for the client, its statistics and offline queue.
+func (c *client) setClock(clock Clock) {
+	c.clock = clock
+	c.stats.clock = clock
+	c.offline.clock = clock
 }
 
 // public interface -----------------------------------------------------------
 
-func (c *client) Start() {
-	// if started, ignore
-	go c.loop()
+// Start starts the client loop.
+// The client is stopped when the given context is done.
+func (c *client) Start(ctx context.Context) {
+	c.connLock.Lock()
+	if c.running {
+		c.connLock.Unlock()
+		return
+	}
+	c.running = true
+	done := make(chan struct{})
+	c.done = done
+	c.connLock.Unlock()
+
+	if c.captureFile != "" {
+		w, err := OpenCapture(c.captureFile)
+		if err != nil {
+			c.log.Error("Cannot open capture file: %v", err)
+		}
+		c.captureWriter = w
+	}
+
+	c.startLoop()
+	if c.watchdog > 0 {
+		go c.supervise(c.watchdog, done)
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.log.Debug("Context done: %v", ctx.Err())
+			c.Stop(context.Background())
+		case <-done:
+		}
+	}()
+}
+
+// Stop disconnects and stops the client loop.
+// It does not wait for the loop, which disconnects when it sees the request;
+// a stalled loop cannot block the caller.
+// The context is kept for compatibility and not used.
+func (c *client) Stop(ctx context.Context) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	if !c.running {
+		return
+	}
+	c.running = false
+	close(c.done)
+}
+
+// doneChan returns the channel that is closed when the current run ends.
+func (c *client) doneChan() chan struct{} {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return c.done
 }
 
-func (c *client) Stop() {
-	// if stopped, ignore
-	c.done <- true
+func (c *client) isRunning() bool {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return c.running
 }
 
-func (c *client) Connect() {
-	c.wantConnect <- true
+// Connect requests a connection to the device.
+// Waits until the request is accepted or ctx is done.
+func (c *client) Connect(ctx context.Context) {
+	select {
+	case c.wantConnect <- true:
+	case <-ctx.Done():
+	}
 }
 
-func (c *client) Disconnect() {
-	c.wantDisconnect <- true
+// Disconnect requests to close the connection to the device.
+// Waits until the request is accepted or ctx is done.
+func (c *client) Disconnect(ctx context.Context) {
+	select {
+	case c.wantDisconnect <- true:
+	case <-ctx.Done():
+	}
 }
 
 func (c *client) WaitConnect(timeout time.Duration) bool {
@@ -90,8 +213,9 @@ func (c *client) WaitConnect(timeout time.Duration) bool {
 		return true
 	}
 
-	t := time.After(timeout)
-	ticker := time.NewTimer(50 * time.Millisecond)
+	t := c.clock.After(timeout)
+	// polls in real time, only the timeout depends on the clock
+	ticker := time.NewTicker(50 * time.Millisecond)
 	defer ticker.Stop()
 	for {
 		select {
@@ -112,11 +236,20 @@ func (c *client) State() ConnectionState {
 }
 
 func (c *client) Send(cmd ISCPCommand, timeout time.Duration) error {
-	if c.isState(Disconnected, Disconnecting) {
+	return c.SendPriority(cmd, timeout, PriorityNormal)
+}
+
+// SendPriority sends a command, waiting commands with a lower priority
+// are sent after it.
+func (c *client) SendPriority(cmd ISCPCommand, timeout time.Duration, p Priority) error {
+	if c.offline.rejects() && c.isState(Disconnected, Disconnecting) {
 		return ErrNotConnected
 	}
 	reply := make(chan error, 1)
-	c.send <- sendTask{Command: cmd, Reply: reply}
+	err := c.enqueue(sendTask{Command: cmd, Reply: reply, Created: c.clock.Now(), Priority: p})
+	if err != nil {
+		return err
+	}
 
 	if timeout <= 0 {
 		return nil
@@ -125,32 +258,113 @@ func (c *client) Send(cmd ISCPCommand, timeout time.Duration) error {
 	select {
 	case err := <-reply:
 		return err
-	case <-time.After(timeout):
+	case <-c.clock.After(timeout):
 		return ErrTimeout
 	}
 }
 
-func (c *client) loop() {
+// startLoop starts a new client loop.
+// A loop that is already running will exit after its current iteration.
+func (c *client) startLoop() {
+	gen := atomic.AddInt64(&c.loopGen, 1)
+	c.beat()
+	go c.loop(gen, c.doneChan())
+}
+
+// isCurrent tells whether the loop with the given generation
+// was not replaced by the watchdog.
+func (c *client) isCurrent(gen int64) bool {
+	return atomic.LoadInt64(&c.loopGen) == gen
+}
+
+func (c *client) loop(gen int64, done chan struct{}) {
+	defer c.recoverLoop("client loop")
+
+	var heartbeat <-chan time.Time
+	if c.watchdog > 0 {
+		ticker := c.clock.NewTicker(c.watchdog / 4)
+		defer ticker.Stop()
+		heartbeat = ticker.C()
+	}
+
 	for {
+		// handle is the event, requeue passes it on to the current loop
+		// if this one was replaced while it waited
+		var handle, requeue func()
 		select {
-		case <-c.done:
-			c.doDone()
+		case <-heartbeat:
+			handle = c.beat
+		case <-done:
+			if c.isCurrent(gen) {
+				c.doDone()
+			}
 			return
 		case <-c.wantDisconnect:
-			c.doDisconnect()
+			handle = c.doDisconnect
+			requeue = func() {
+				select {
+				case c.wantDisconnect <- true:
+				case <-done:
+				}
+			}
 		case <-c.wantConnect:
-			c.doConnect()
+			handle = c.doConnect
+			requeue = func() {
+				select {
+				case c.wantConnect <- true:
+				case <-done:
+				}
+			}
 		case cmd := <-c.received:
-			c.doReceive(cmd)
+			handle = func() { c.doReceive(cmd) }
+			requeue = func() {
+				select {
+				case c.received <- cmd:
+				case <-done:
+				}
+			}
+		case task := <-c.sendHigh:
+			handle = func() { c.doSend(task) }
+			requeue = func() { c.requeueTask(c.sendHigh, task, done) }
 		case task := <-c.send:
-			c.doSend(task)
+			handle = func() { c.sendNext(task) }
+			requeue = func() { c.requeueTask(c.send, task, done) }
+		case task := <-c.sendLow:
+			handle = func() { c.sendNext(task) }
+			requeue = func() { c.requeueTask(c.sendLow, task, done) }
+		}
+
+		if !c.isCurrent(gen) {
+			c.log.Debug("Replaced client loop exits")
+			if requeue != nil {
+				go requeue()
+			}
+			return
 		}
+		handle()
+	}
+}
+
+// requeueTask passes a task to the loop that replaced a stalled one.
+// The task fails if the client is stopped first.
+func (c *client) requeueTask(queue chan sendTask, t sendTask, done chan struct{}) {
+	select {
+	case queue <- t:
+	case <-done:
+		t.Reply <- ErrNotConnected
 	}
 }
 
 func (c *client) doDone() {
 	c.log.Debug("Done")
 	c.doDisconnect()
+	if c.captureWriter != nil {
+		err := c.captureWriter.Close()
+		if err != nil {
+			c.log.Warning("Error closing capture file: %v", err)
+		}
+		c.captureWriter = nil
+	}
 }
 
 // Connection handling --------------------------------------------------------
@@ -167,20 +381,51 @@ func (c *client) isState(states ...ConnectionState) bool {
 	return false
 }
 
-func (c *client) changeState(s ConnectionState, conn net.Conn) {
+// changeState sets the connection state.
+// The connection is set when the state changes to Connected
+// and cleared when it changes to Disconnected.
+func (c *client) changeState(s ConnectionState, conn io.ReadWriteCloser) {
 	c.connLock.Lock()
 	defer c.connLock.Unlock()
+	c.setState(s, conn)
+}
 
+// setState changes the state, connLock must be held.
+func (c *client) setState(s ConnectionState, conn io.ReadWriteCloser) {
 	c.state = s
-	if conn != nil {
+	switch s {
+	case Connected:
 		c.conn = conn
+	case Disconnected:
+		c.conn = nil
 	}
 
 	if c.connectionCB != nil {
-		go func() {
+		c.dispatch(func() {
 			c.connectionCB(s)
-		}()
+		})
+	}
+}
+
+// connection returns the current connection or nil if not connected.
+func (c *client) connection() io.ReadWriteCloser {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	return c.conn
+}
+
+// connectionLost changes the state to Disconnected
+// if the given connection is still the current connection.
+// The caller is responsible for closing the connection.
+func (c *client) connectionLost(conn io.ReadWriteCloser) bool {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
+	if conn == nil || c.conn != conn || c.state != Connected {
+		return false
 	}
+	c.setState(Disconnected, nil)
+	return true
 }
 
 func (c *client) doConnect() {
@@ -197,13 +442,25 @@ func (c *client) doConnect() {
 		return
 	}
 
+	c.socket.apply(conn, c.log)
+	c.stats.connected()
+	c.connID++
+	atomic.StoreInt64(&c.reading, int64(c.connID))
 	c.changeState(Connected, conn)
-	go c.readLoop(c.conn) // TODO: not thread safe
+	go c.readLoop(conn, c.connID)
+
+	c.flushOffline()
 }
 
-func (c *client) createConn() (net.Conn, error) {
+func (c *client) createConn() (io.ReadWriteCloser, error) {
+	if c.dial != nil {
+		return c.dial()
+	}
 	addr := fmt.Sprintf("%v:%v", c.host, c.port)
-	return net.DialTimeout(protocol, addr, c.timeout)
+	if c.dialTCP != nil {
+		return c.dialTCP(protocol, addr)
+	}
+	return net.DialTimeout(protocol, addr, c.dialTimeout)
 }
 
 func (c *client) doDisconnect() {
@@ -212,93 +469,251 @@ func (c *client) doDisconnect() {
 	}
 	c.log.Debug("Disconnect")
 
-	c.changeState(Disconnecting, c.conn)
+	conn := c.connection()
+	c.changeState(Disconnecting, nil)
 	// wait for outgoing messages?
-	err := c.conn.Close() // TODO: not thread safe
-	if err != nil {
-		c.log.Warning("Error closing connection: %v", err)
+	if conn != nil {
+		err := conn.Close()
+		if err != nil {
+			c.log.Warning("Error closing connection: %v", err)
+		}
 	}
 	c.changeState(Disconnected, nil)
 }
 
-func (c *client) readLoop(conn net.Conn) {
+func (c *client) readLoop(conn io.ReadWriteCloser, connID int) {
+	// a read loop for an old connection may exit after the new one started
+	defer atomic.CompareAndSwapInt64(&c.reading, int64(connID), 0)
+	defer c.recoverLoop("read loop")
 	defer func() {
-		if c.isState(Connected) {
+		if c.connectionLost(conn) {
 			// unexpected close of connection, assume server side close
 			// and attempt reconnect
-			c.changeState(Disconnected, nil)
+			conn.Close()
 		}
 	}()
 
 	r := bufio.NewReader(conn)
-	buf := make([]byte, headerSize) // reused
 
 	for {
-		// read header
-		_, err := r.Read(buf)
+		err := c.awaitFrame(conn, r)
+		if isTimeout(err) {
+			// the receiver was silent, the connection is still fine
+			continue
+		}
+		data, err := c.framing.read(r)
 		if err != nil {
-			if err == io.EOF {
+			if isConnError(err) {
 				// assume server side close
+				c.log.Debug("Read loop exits: %v", err)
 				return
 			}
-			c.log.Warning("Read error: %v", err)
-			// return
+			c.log.Warning("Discard bad message: %v", err)
 			continue
 		}
-		c.log.Debug("<- recv (H): %v", buf)
-		_, payloadSize, err := ParseHeader(buf)
+		c.capture(Received, data)
+		c.stats.received(len(data))
+		logTrace(c.log, connID, Received, data)
+
+		cmd, err := c.framing.decode(data)
 		if err != nil {
 			c.log.Warning("Discard bad message: %v", err)
 			continue
 		}
+		c.setVersion(data)
+		logFields(c.log, Debug, messageFields("recv", cmd), "<- recv: %v", cmd)
+
+		c.received <- cmd
+	}
+}
+
+// awaitFrame waits for the first byte of the next frame.
+// The read timeout only applies here, a timeout within a frame would leave
+// the reader in the middle of it.
+func (c *client) awaitFrame(conn io.ReadWriteCloser, r *bufio.Reader) error {
+	d, ok := conn.(deadliner)
+	if !ok || c.readTimeout <= 0 {
+		return nil
+	}
+	d.SetReadDeadline(time.Now().Add(c.readTimeout))
+	_, err := r.Peek(1)
+	d.SetReadDeadline(time.Time{})
+	return err
+}
+
+// setVersion remembers the version from the header of an eISCP message.
+func (c *client) setVersion(data []byte) {
+	if _, ok := c.framing.(eiscpFraming); !ok {
+		return
+	}
+	_, _, version, err := ParseHeaderVersion(data)
+	if err == nil {
+		atomic.StoreInt32(&c.version, int32(version))
+	}
+}
+
+// iscpVersion returns the eISCP version of the last received message,
+// 0 if none was received.
+func (c *client) iscpVersion() int {
+	return int(atomic.LoadInt32(&c.version))
+}
+
+// isTimeout tells whether err is caused by the read deadline.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isConnError tells whether err is caused by the connection
+// rather than by the message data.
+func isConnError(err error) bool {
+	var parseErr *ParseError
+	return !errors.As(err, &parseErr)
+}
+
+// deadliner is implemented by connections that support timeouts.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
 
-		// read payload
-		payload := make([]byte, payloadSize)
-		_, err = r.Read(payload)
+// socketOptions are applied to TCP connections after connecting.
+// Zero buffer sizes keep the system defaults.
+type socketOptions struct {
+	noDelay     bool
+	readBuffer  int
+	writeBuffer int
+}
+
+// tcpConn is implemented by *net.TCPConn.
+type tcpConn interface {
+	SetNoDelay(noDelay bool) error
+	SetReadBuffer(bytes int) error
+	SetWriteBuffer(bytes int) error
+}
+
+func (s socketOptions) apply(conn io.ReadWriteCloser, log Logger) {
+	t, ok := conn.(tcpConn)
+	if !ok {
+		return
+	}
+	err := t.SetNoDelay(s.noDelay)
+	if err != nil {
+		log.Warning("Failed to set TCP_NODELAY: %v", err)
+	}
+	if s.readBuffer > 0 {
+		err = t.SetReadBuffer(s.readBuffer)
 		if err != nil {
-			if err == io.EOF {
-				// assume server side close
-				return
-			}
-			c.log.Warning("Read error: %v", err)
-			//return
-			continue
+			log.Warning("Failed to set read buffer size: %v", err)
 		}
-		c.log.Debug("<- recv (P): %v", payload)
-
-		iscp, err := ParseISCP(payload)
+	}
+	if s.writeBuffer > 0 {
+		err = t.SetWriteBuffer(s.writeBuffer)
 		if err != nil {
-			c.log.Warning("Discard invalid message: %v", err)
-			continue
+			log.Warning("Failed to set write buffer size: %v", err)
 		}
+	}
+}
+
+// framing converts between ISCP commands and the data on the wire.
+type framing interface {
+	// encode appends the data to send for a command to buf.
+	encode(buf []byte, cmd ISCPCommand) []byte
+	// read reads the raw data for one message.
+	read(r *bufio.Reader) ([]byte, error)
+	// decode parses the data returned from read.
+	decode(data []byte) (ISCPCommand, error)
+}
+
+// eiscpFraming is used for network connections.
+type eiscpFraming struct {
+	strict bool
+}
+
+func (e eiscpFraming) encode(buf []byte, cmd ISCPCommand) []byte {
+	return AppendEISCP(buf, cmd)
+}
 
-		c.received <- iscp.Command()
+func (e eiscpFraming) read(r *bufio.Reader) ([]byte, error) {
+	return readFrame(r)
+}
+
+func (e eiscpFraming) decode(data []byte) (ISCPCommand, error) {
+	msg, err := parseEISCP(data, e.strict)
+	if err != nil {
+		return "", err
 	}
+	return msg.Command(), nil
 }
 
 // send + receive -------------------------------------------------------------
 
 func (c *client) doSend(t sendTask) {
-	if !c.isState(Connected) {
-		c.log.Warning("Discard message (not connected): %v", t.Command)
-		t.Reply <- ErrNotConnected
+	conn := c.connection()
+	if conn == nil || !c.isState(Connected) {
+		logFields(c.log, Warning, messageFields("send", t.Command),
+			"Cannot send message (not connected): %v", t.Command)
+		c.offline.add(t)
 		return
 	}
-	conn := c.conn // TODO: not thread safe
 
-	msg := NewEISCPMessage(t.Command)
-	c.log.Debug("-> send: %v", t.Command)
-	_, err := conn.Write(msg.Raw())
+	data := c.framing.encode(c.takeSendBuf(), t.Command)
+	defer c.putSendBuf(data)
+	logFields(c.log, Debug, messageFields("send", t.Command), "-> send: %v", t.Command)
+	d, ok := conn.(deadliner)
+	if ok && c.writeTimeout > 0 {
+		d.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	n, err := conn.Write(data)
 	if err != nil {
-		c.log.Error("Error writing to connection: %v", err)
+		fields := messageFields("send", t.Command)
+		fields["error"] = err.Error()
+		logFields(c.log, Error, fields, "Error writing to connection: %v", err)
+		c.stats.sendError()
+		// a failed write, e.g. because the write deadline was exceeded,
+		// means the connection is dead
+		if c.connectionLost(conn) {
+			conn.Close()
+		}
+	} else {
+		c.capture(Sent, data)
+		c.stats.sent(n)
+		logTrace(c.log, c.connID, Sent, data)
 	}
 	t.Reply <- err
 }
 
+// takeSendBuf returns the reusable send buffer. A loop that stalls in
+// a write keeps its buffer, the loop that replaces it gets a new one.
+func (c *client) takeSendBuf() []byte {
+	c.sendBufLock.Lock()
+	defer c.sendBufLock.Unlock()
+	buf := c.sendBuf
+	c.sendBuf = nil
+	return buf[:0]
+}
+
+func (c *client) putSendBuf(buf []byte) {
+	c.sendBufLock.Lock()
+	defer c.sendBufLock.Unlock()
+	c.sendBuf = buf
+}
+
 func (c *client) doReceive(cmd ISCPCommand) {
 	c.log.Debug("<- handle: %v", cmd)
 	if c.handler != nil {
-		c.handler(cmd)
+		c.dispatch(func() {
+			c.handler(cmd)
+		})
+	}
+}
+
+// dispatch runs a callback after the ones posted before it,
+// see dispatcher. Callbacks are dropped if the queue is full.
+func (c *client) dispatch(fn func()) {
+	if !c.dispatcher.post(fn) {
+		c.log.Warning("Callback queue full, dropping event (slow callback?)")
+		c.stats.droppedCallback()
 	}
 }
 
@@ -0,0 +1,163 @@
+package onkyoctl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// stalledConn accepts no writes and blocks reads until closed.
+type stalledConn struct {
+	closed chan bool
+}
+
+func (s *stalledConn) Read(p []byte) (int, error) {
+	<-s.closed
+	return 0, errors.New("closed")
+}
+
+func (s *stalledConn) Write(p []byte) (int, error) {
+	return 0, errors.New("i/o timeout")
+}
+
+func (s *stalledConn) Close() error {
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+	return nil
+}
+
+func TestWriteErrorDisconnects(t *testing.T) {
+	conn := &stalledConn{closed: make(chan bool)}
+
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	c.dial = func() (io.ReadWriteCloser, error) {
+		return conn, nil
+	}
+	ctx := context.Background()
+	c.Start(ctx)
+	defer c.Stop(ctx)
+
+	c.Connect(ctx)
+	if !c.WaitConnect(time.Second) {
+		t.Log("Client did not connect")
+		t.Fail()
+		return
+	}
+
+	err := c.Send(validCommand, time.Second)
+	assertErr(t, err)
+	assertEqual(t, c.State(), Disconnected)
+
+	select {
+	case <-conn.closed:
+	default:
+		t.Log("Connection was not closed")
+		t.Fail()
+	}
+}
+
+type tunedConn struct {
+	stalledConn
+	noDelay     bool
+	readBuffer  int
+	writeBuffer int
+}
+
+func (t *tunedConn) SetNoDelay(noDelay bool) error {
+	t.noDelay = noDelay
+	return nil
+}
+
+func (t *tunedConn) SetReadBuffer(bytes int) error {
+	t.readBuffer = bytes
+	return nil
+}
+
+func (t *tunedConn) SetWriteBuffer(bytes int) error {
+	t.writeBuffer = bytes
+	return nil
+}
+
+func TestSocketOptions(t *testing.T) {
+	conn := &tunedConn{}
+	socketOptions{noDelay: true, readBuffer: 2048}.apply(conn, NewLogger(NoLog))
+	assertEqual(t, conn.noDelay, true)
+	assertEqual(t, conn.readBuffer, 2048)
+	assertEqual(t, conn.writeBuffer, 0)
+}
+
+func TestReadTimeoutKeepsConnection(t *testing.T) {
+	server := newMockServer()
+	server.Start()
+	defer server.Stop()
+
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	c.readTimeout = 20 * time.Millisecond
+	handled := make(chan ISCPCommand, 1)
+	c.handler = func(cmd ISCPCommand) {
+		handled <- cmd
+	}
+	ctx := context.Background()
+	c.Start(ctx)
+	defer c.Stop(ctx)
+	c.Connect(ctx)
+	if !server.WaitConnected() || !c.WaitConnect(time.Second) {
+		t.Fatal("initial connect failed")
+	}
+
+	// the receiver is silent for longer than the read timeout
+	time.Sleep(100 * time.Millisecond)
+	assertEqual(t, c.State(), Connected)
+
+	assertNoErr(t, server.Reply("PWR01"))
+	select {
+	case cmd := <-handled:
+		assertEqual(t, cmd, ISCPCommand("PWR01"))
+	case <-time.After(time.Second):
+		t.Fatal("message after read timeout not received")
+	}
+}
+
+func TestReadTimeoutWithinFrame(t *testing.T) {
+	server := newMockServer()
+	server.Start()
+	defer server.Stop()
+
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	c.readTimeout = 20 * time.Millisecond
+	handled := make(chan ISCPCommand, 2)
+	c.handler = func(cmd ISCPCommand) {
+		handled <- cmd
+	}
+	ctx := context.Background()
+	c.Start(ctx)
+	defer c.Stop(ctx)
+	c.Connect(ctx)
+	if !server.WaitConnected() || !c.WaitConnect(time.Second) {
+		t.Fatal("initial connect failed")
+	}
+
+	// the rest of the frame arrives after the read timeout
+	raw := NewEISCPMessage("PWR01").Raw()
+	_, err := server.conn.Write(raw[:10])
+	assertNoErr(t, err)
+	time.Sleep(100 * time.Millisecond)
+	_, err = server.conn.Write(raw[10:])
+	assertNoErr(t, err)
+	assertNoErr(t, server.Reply("MVL20"))
+
+	for _, expected := range []ISCPCommand{"PWR01", "MVL20"} {
+		select {
+		case cmd := <-handled:
+			assertEqual(t, cmd, expected)
+		case <-time.After(time.Second):
+			t.Fatalf("%v not received", expected)
+		}
+	}
+	assertEqual(t, c.State(), Connected)
+}
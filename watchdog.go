@@ -0,0 +1,82 @@
+package onkyoctl
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrLoopStalled is reported when the client loop stops responding.
+	ErrLoopStalled = errors.New("client loop stalled")
+	// ErrReadLoopStopped is reported when the read loop has exited
+	// while the client still considers itself connected.
+	ErrReadLoopStopped = errors.New("read loop stopped")
+)
+
+// supervise periodically checks that the client loop and the read loop
+// are alive and restarts them if they are not.
+func (c *client) supervise(interval time.Duration, stop chan struct{}) {
+	ticker := c.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C():
+			c.checkLoops(interval)
+		}
+	}
+}
+
+func (c *client) checkLoops(interval time.Duration) {
+	last := time.Unix(0, atomic.LoadInt64(&c.loopBeat))
+	if c.clock.Now().Sub(last) > interval {
+		c.log.Warning("Client loop unresponsive since %v, restarting", last)
+		c.reportError(ErrLoopStalled)
+		c.startLoop()
+	}
+
+	if c.isState(Connected) && atomic.LoadInt64(&c.reading) == 0 {
+		c.log.Warning("Read loop not running, resetting connection")
+		c.reportError(ErrReadLoopStopped)
+
+		conn := c.connection()
+		if c.connectionLost(conn) {
+			conn.Close()
+		}
+	}
+}
+
+// beat records a heartbeat for the client loop.
+func (c *client) beat() {
+	atomic.StoreInt64(&c.loopBeat, c.clock.Now().UnixNano())
+}
+
+// recoverLoop is deferred by the long-running goroutines.
+// It turns a panic into an error report so the watchdog can take over.
+func (c *client) recoverLoop(name string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	c.log.Error("Panic in %v: %v", name, r)
+	c.reportError(fmt.Errorf("%v: panic: %v", name, r))
+}
+
+func (c *client) reportError(err error) {
+	if c.errorCB != nil {
+		c.dispatch(func() {
+			// not reported again, that would loop
+			defer func() {
+				r := recover()
+				if r != nil {
+					c.log.Error("Panic in error callback: %v", r)
+				}
+			}()
+			c.errorCB(err)
+		})
+	}
+}
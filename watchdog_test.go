@@ -0,0 +1,149 @@
+package onkyoctl
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stallConn blocks the first write until release is closed.
+type stallConn struct {
+	stalled int32
+	release chan struct{}
+	written chan []byte
+	closed  chan struct{}
+}
+
+func newStallConn() *stallConn {
+	return &stallConn{
+		release: make(chan struct{}),
+		written: make(chan []byte, 8),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (s *stallConn) Write(p []byte) (int, error) {
+	if atomic.CompareAndSwapInt32(&s.stalled, 0, 1) {
+		<-s.release
+		return len(p), nil
+	}
+	s.written <- append([]byte{}, p...)
+	return len(p), nil
+}
+
+func (s *stallConn) Read(p []byte) (int, error) {
+	<-s.closed
+	return 0, net.ErrClosed
+}
+
+func (s *stallConn) Close() error {
+	return nil
+}
+
+func TestWatchdogRestartsLoop(t *testing.T) {
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	c.watchdog = 40 * time.Millisecond
+
+	errors := make(chan error, 8)
+	c.errorCB = func(err error) {
+		errors <- err
+	}
+
+	conn := newStallConn()
+	defer close(conn.release)
+	c.changeState(Connected, conn)
+	// pretend a read loop is running
+	atomic.StoreInt64(&c.reading, 1)
+
+	c.Start(context.Background())
+	defer c.Stop(context.Background())
+	gen := atomic.LoadInt64(&c.loopGen)
+
+	// the write blocks the client loop
+	go c.Send(ISCPCommand("PWR01"), 0)
+
+	select {
+	case err := <-errors:
+		assertEqual(t, err, ErrLoopStalled)
+	case <-time.After(time.Second):
+		t.Fatal("Missing error event for stalled loop")
+	}
+	if atomic.LoadInt64(&c.loopGen) <= gen {
+		t.Error("Client loop was not restarted")
+	}
+
+	// the new loop sends
+	assertNoErr(t, c.Send(ISCPCommand("PWR00"), time.Second))
+	select {
+	case data := <-conn.written:
+		cmd, err := c.framing.decode(data)
+		assertNoErr(t, err)
+		assertEqual(t, cmd, ISCPCommand("PWR00"))
+	case <-time.After(time.Second):
+		t.Fatal("Command was not sent")
+	}
+}
+
+func TestOldReadLoopKeepsNewOne(t *testing.T) {
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+
+	old, other := net.Pipe()
+	other.Close()
+	// the read loop for connection 2 is running
+	atomic.StoreInt64(&c.reading, 2)
+
+	// the loop for connection 1 exits late
+	c.readLoop(old, 1)
+	assertEqual(t, atomic.LoadInt64(&c.reading), int64(2))
+
+	c.readLoop(old, 2)
+	assertEqual(t, atomic.LoadInt64(&c.reading), int64(0))
+}
+
+func TestStopWithStalledLoop(t *testing.T) {
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	c.Start(context.Background())
+	// no loop takes the stop request
+	atomic.AddInt64(&c.loopGen, 1)
+
+	stopped := make(chan bool)
+	go func() {
+		c.Stop(context.Background())
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked on a stalled loop")
+	}
+}
+
+func TestReplacedLoopPassesEvent(t *testing.T) {
+	c := newClient("localhost", testPort, NewLogger(NoLog))
+	handled := make(chan ISCPCommand, 4)
+	c.handler = func(cmd ISCPCommand) {
+		handled <- cmd
+	}
+	c.Start(context.Background())
+	defer c.Stop(context.Background())
+
+	// both loops wait for events, only the new one may handle them
+	c.startLoop()
+	for _, cmd := range []ISCPCommand{"PWR01", "PWR00", "MVL20"} {
+		c.received <- cmd
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-handled:
+		case <-time.After(time.Second):
+			t.Fatal("event lost")
+		}
+	}
+	select {
+	case cmd := <-handled:
+		t.Errorf("%v handled twice", cmd)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
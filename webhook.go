@@ -0,0 +1,209 @@
+package onkyoctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	webhookPrefix = "webhook."
+
+	defaultWebhookRetries    = 3
+	defaultWebhookRetryDelay = time.Second
+	defaultWebhookType       = "application/json"
+	webhookQueueSize         = 16
+	webhookTimeout           = 10 * time.Second
+)
+
+// Webhook sends an HTTP POST to URL when selected values change.
+//
+// In the config, webhooks are defined in [webhook.<name>] sections:
+//
+//	[webhook.power-on]
+//	URL = http://automation.local/hooks/receiver
+//	Filter = power=on, input
+//	Template = {"text": "{{.Name}} is now {{.Value}}"}
+//
+// Filter is a comma separated list of command names, optionally with
+// a value. If it is empty, every message is sent.
+//
+// The body is created from Template (text/template) with the fields of
+// ParsedMessage and Host; without a template, the ParsedMessage is sent
+// as JSON. Failed requests are retried up to Retries times, the delay
+// starts with RetryDelay and doubles with each attempt.
+type Webhook struct {
+	Name        string `ini:"-"`
+	URL         string
+	Filter      []string `delim:","`
+	Template    string
+	ContentType string
+	Retries     int
+	RetryDelay  time.Duration
+}
+
+// webhookData is passed to the template.
+type webhookData struct {
+	ParsedMessage
+	Host string
+}
+
+func defaultWebhook(name string) *Webhook {
+	return &Webhook{
+		Name:        name,
+		ContentType: defaultWebhookType,
+		Retries:     defaultWebhookRetries,
+		RetryDelay:  defaultWebhookRetryDelay,
+	}
+}
+
+// Webhook returns the webhook with the given name.
+func (c *Config) Webhook(name string) (*Webhook, error) {
+	w, ok := c.webhooks[name]
+	if !ok {
+		return nil, fmt.Errorf("no webhook %q", name)
+	}
+	return w, nil
+}
+
+// Webhooks returns the names of the configured webhooks.
+func (c *Config) Webhooks() []string {
+	names := make([]string, 0, len(c.webhooks))
+	for name := range c.webhooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// accept tells if the message matches the filter.
+func (w *Webhook) accept(m *ParsedMessage) bool {
+	if len(w.Filter) == 0 {
+		return true
+	}
+	for _, f := range w.Filter {
+		parts := strings.SplitN(strings.TrimSpace(f), "=", 2)
+		if parts[0] != m.Name {
+			continue
+		}
+		if len(parts) == 1 || strings.TrimSpace(parts[1]) == m.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) parseTemplate() (*template.Template, error) {
+	if w.Template == "" {
+		return nil, nil
+	}
+	tpl, err := template.New(w.Name).Parse(w.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template for webhook %q: %v", w.Name, err)
+	}
+	return tpl, nil
+}
+
+func (w *Webhook) body(tpl *template.Template, data webhookData) ([]byte, error) {
+	if tpl == nil {
+		return json.Marshal(data)
+	}
+	var buf bytes.Buffer
+	err := tpl.Execute(&buf, data)
+	return buf.Bytes(), err
+}
+
+// Run sends requests for messages from the device until ctx is done.
+//
+// Requests are sent one after the other in the order of the messages.
+// If the webhook falls behind, new messages are dropped.
+func (w *Webhook) Run(ctx context.Context, d *Device) error {
+	if w.URL == "" {
+		return fmt.Errorf("no URL for webhook %q", w.Name)
+	}
+	tpl, err := w.parseTemplate()
+	if err != nil {
+		return err
+	}
+
+	queue := make(chan []byte, webhookQueueSize)
+	unsubscribe := d.Subscribe(func(m *ParsedMessage) {
+		if !w.accept(m) {
+			return
+		}
+		body, err := w.body(tpl, webhookData{ParsedMessage: *m, Host: d.Host})
+		if err != nil {
+			d.log.Warning("Webhook %q: %v", w.Name, err)
+			return
+		}
+		select {
+		case queue <- body:
+		default:
+			d.log.Warning("Webhook %q: queue full, dropping %v", w.Name, m.Name)
+		}
+	})
+	defer unsubscribe()
+
+	client := &http.Client{Timeout: webhookTimeout}
+	for {
+		select {
+		case body := <-queue:
+			err := w.send(ctx, client, body)
+			if err != nil {
+				d.log.Warning("Webhook %q failed: %v", w.Name, err)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// send posts the body and retries on failure.
+func (w *Webhook) send(ctx context.Context, client *http.Client, body []byte) error {
+	delay := newBackoff(w.RetryDelay, w.RetryDelay*16)
+	var err error
+	for attempt := 0; attempt <= w.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(delay.next()):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		err = w.post(ctx, client, body)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (w *Webhook) post(ctx context.Context, client *http.Client, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	contentType := w.ContentType
+	if contentType == "" {
+		contentType = defaultWebhookType
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected response %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package onkyoctl
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookConfig(t *testing.T) {
+	cfg, err := ReadConfig([]byte(`
+[webhook.power]
+URL = http://localhost/hook
+Filter = power=on, input
+Template = {{.Name}}: {{.Value}}
+`))
+	assertNoErr(t, err)
+	assertEqual(t, cfg.Webhooks(), []string{"power"})
+
+	w, err := cfg.Webhook("power")
+	assertNoErr(t, err)
+	assertEqual(t, w.URL, "http://localhost/hook")
+	assertEqual(t, w.Filter, []string{"power=on", "input"})
+	assertEqual(t, w.Retries, defaultWebhookRetries)
+
+	_, err = cfg.Webhook("other")
+	assertErr(t, err)
+
+	_, err = ReadConfig([]byte("[webhook.broken]\nTemplate = {{.Name\n"))
+	assertErr(t, err)
+}
+
+func TestWebhookAccept(t *testing.T) {
+	w := &Webhook{Filter: []string{"power=on", " input"}}
+	assertEqual(t, w.accept(&ParsedMessage{Name: "power", Value: "on"}), true)
+	assertEqual(t, w.accept(&ParsedMessage{Name: "power", Value: "off"}), false)
+	assertEqual(t, w.accept(&ParsedMessage{Name: "input", Value: "game"}), true)
+	assertEqual(t, w.accept(&ParsedMessage{Name: "volume", Value: "10"}), false)
+
+	w.Filter = nil
+	assertEqual(t, w.accept(&ParsedMessage{Name: "volume", Value: "10"}), true)
+}
+
+func TestWebhookRun(t *testing.T) {
+	bodies := make(chan string, 4)
+	fail := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail > 0 {
+			fail--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		bodies <- string(data)
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.Commands = BasicCommands()
+	device := NewDevice(cfg)
+
+	w := defaultWebhook("test")
+	w.URL = server.URL
+	w.Filter = []string{"power=on"}
+	w.Template = "{{.Host}} {{.Name}} {{.Value}}"
+	w.RetryDelay = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx, device)
+	}()
+
+	// wait for the subscription
+	time.Sleep(10 * time.Millisecond)
+	device.handleReceived("PWR00")
+	device.handleReceived("PWR01")
+
+	select {
+	case body := <-bodies:
+		// first attempt failed, sent on retry
+		assertEqual(t, body, "localhost power on")
+	case <-time.After(time.Second):
+		t.Error("Webhook was not called")
+	}
+
+	cancel()
+	assertNoErr(t, <-done)
+}
@@ -0,0 +1,57 @@
+package onkyoctl
+
+import (
+	"errors"
+	"net"
+)
+
+const defaultWakeAddress = "255.255.255.255:9"
+
+// ErrUnknownMAC is returned by WakeUp if the MAC address of the device
+// is not known.
+var ErrUnknownMAC = errors.New("MAC address unknown")
+
+// WakeUp sends a Wake-on-LAN magic packet to the device.
+//
+// This is required for receivers with network standby disabled,
+// which cannot be reached over eISCP while switched off.
+// The MAC address is taken from Config.MACAddress.
+func (d *Device) WakeUp() error {
+	d.lifeLock.Lock()
+	mac := d.mac
+	d.lifeLock.Unlock()
+
+	if mac == nil {
+		return ErrUnknownMAC
+	}
+	d.log.Debug("Send wake-on-lan packet for %v to %v", mac, d.wakeAddress)
+
+	conn, err := net.Dial("udp", d.wakeAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(magicPacket(mac))
+	return err
+}
+
+// setMAC sets the MAC address used for WakeUp.
+func (d *Device) setMAC(mac net.HardwareAddr) {
+	d.lifeLock.Lock()
+	defer d.lifeLock.Unlock()
+	d.mac = mac
+}
+
+// magicPacket creates a Wake-on-LAN packet for the given MAC address:
+// six bytes 0xFF followed by 16 repetitions of the MAC address.
+func magicPacket(mac net.HardwareAddr) []byte {
+	packet := make([]byte, 0, 6+16*len(mac))
+	for i := 0; i < 6; i++ {
+		packet = append(packet, 0xFF)
+	}
+	for i := 0; i < 16; i++ {
+		packet = append(packet, mac...)
+	}
+	return packet
+}
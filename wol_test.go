@@ -0,0 +1,36 @@
+package onkyoctl
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMagicPacket(t *testing.T) {
+	mac, _ := net.ParseMAC("00:09:b0:12:34:56")
+	packet := magicPacket(mac)
+
+	assertEqual(t, len(packet), 102)
+	assertEqual(t, packet[0:6], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	assertEqual(t, packet[6:12], []byte(mac))
+	assertEqual(t, packet[96:102], []byte(mac))
+}
+
+func TestWakeUp(t *testing.T) {
+	cfg := testConfig()
+	device := NewDevice(cfg)
+	assertEqual(t, device.WakeUp(), ErrUnknownMAC)
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assertNoErr(t, err)
+	defer l.Close()
+
+	cfg.MACAddress = "00:09:b0:12:34:56"
+	cfg.WakeAddress = l.LocalAddr().String()
+	device = NewDevice(cfg)
+	assertNoErr(t, device.WakeUp())
+
+	buf := make([]byte, 200)
+	n, _, err := l.ReadFrom(buf)
+	assertNoErr(t, err)
+	assertEqual(t, n, 102)
+}
@@ -0,0 +1,107 @@
+package onkyoctl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// zoneNames are the commands that have a variant for each zone,
+// named e.g. "volume-zone2".
+var zoneNames = map[string]bool{
+	"power":  true,
+	"volume": true,
+	"mute":   true,
+	"input":  true,
+	"tuning": true,
+	"preset": true,
+}
+
+// Zone is a view of the device for one zone.
+//
+// Commands like "power" and "volume" are mapped to the commands for the
+// zone, e.g. "volume-zone2", other commands are sent as they are.
+// All zones share the connection of the device.
+type Zone struct {
+	device *Device
+	zone   int
+}
+
+// Zone returns a view of the device for the given zone, 1 is the main zone.
+// The command set must contain the zone commands, see ExtendedCommands.
+func (d *Device) Zone(n int) *Zone {
+	return &Zone{device: d, zone: n}
+}
+
+// Number returns the number of the zone, 1 for the main zone.
+func (z *Zone) Number() int {
+	return z.zone
+}
+
+// suffix is appended to the names of zone commands.
+func (z *Zone) suffix() string {
+	return fmt.Sprintf("-zone%d", z.zone)
+}
+
+// commandName returns the name of the zone's command for name.
+func (z *Zone) commandName(name string) string {
+	if z.zone <= 1 || !zoneNames[name] {
+		return name
+	}
+	return name + z.suffix()
+}
+
+// SendCommand sends a "friendly" command to the zone,
+// e.g. "volume 20" for the zone volume.
+func (z *Zone) SendCommand(name string, param interface{}) error {
+	return z.device.SendCommand(z.commandName(name), param)
+}
+
+// Query sends a QSTN command for the given friendly name in the zone.
+func (z *Zone) Query(name string) error {
+	return z.device.Query(z.commandName(name))
+}
+
+// Value returns the last value received for the given friendly name
+// in the zone.
+func (z *Zone) Value(name string) (HistoryEntry, bool) {
+	return z.device.Value(z.commandName(name))
+}
+
+// Subscribe adds a handler for messages of the zone.
+// Messages for zone commands are passed with the plain name,
+// e.g. "volume" for "volume-zone2". Messages for commands of other zones
+// are not passed on.
+// Call the returned function to remove the handler.
+func (z *Zone) Subscribe(callback func(*ParsedMessage)) func() {
+	return z.device.Subscribe(func(m *ParsedMessage) {
+		name, zone := splitZone(m.Name)
+		if zone == 0 {
+			// commands for all zones, e.g. popup messages
+			if !zoneNames[name] || z.zone <= 1 {
+				callback(m)
+			}
+			return
+		}
+		if zone != z.zone {
+			return
+		}
+		renamed := *m
+		renamed.Name = name
+		callback(&renamed)
+	})
+}
+
+// splitZone splits a name like "volume-zone2" into "volume" and 2.
+// Zone is 0 for names without a zone.
+func splitZone(name string) (string, int) {
+	i := strings.LastIndex(name, "-zone")
+	if i < 0 {
+		return name, 0
+	}
+	zone, err := strconv.Atoi(name[i+len("-zone"):])
+	if err != nil || zone < 2 {
+		return name, 0
+	}
+	return name[:i], zone
+}
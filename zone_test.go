@@ -0,0 +1,82 @@
+package onkyoctl
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZone(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = ExtendedCommands()
+	device := NewDevice(cfg)
+	server := newMockServer()
+
+	server.Start()
+	defer server.Stop()
+	device.Start()
+	defer device.Stop()
+	if !server.WaitConnected() {
+		t.Fatal("initial connect failed")
+	}
+	device.client.WaitConnect(time.Second)
+
+	zone2 := device.Zone(2)
+	assertEqual(t, zone2.Number(), 2)
+	commands := []struct {
+		fn       func() error
+		expected ISCPCommand
+	}{
+		{func() error { return zone2.SendCommand("power", "on") }, "ZPW01"},
+		{func() error { return zone2.SendCommand("volume", 20) }, "ZVL14"},
+		{func() error { return zone2.Query("input") }, "SLZQSTN"},
+		{func() error { return device.Zone(3).SendCommand("mute", "toggle") }, "MT3TG"},
+		{func() error { return device.Zone(1).SendCommand("volume", 20) }, "MVL28"},
+		// not zone specific
+		{func() error { return zone2.SendCommand("dimmer", "dim") }, "DIM01"},
+	}
+	for _, c := range commands {
+		assertNoErr(t, c.fn())
+		data, err := server.ReadRaw()
+		assertNoErr(t, err)
+		msg, err := ParseEISCP(data)
+		assertNoErr(t, err)
+		assertEqual(t, msg.Command(), c.expected)
+	}
+}
+
+func TestZoneSubscribe(t *testing.T) {
+	cfg := testConfig()
+	cfg.Commands = ExtendedCommands()
+	device := NewDevice(cfg)
+
+	var main, zone2 []string
+	device.Zone(1).Subscribe(func(m *ParsedMessage) {
+		main = append(main, m.Name+" "+m.Value)
+	})
+	device.Zone(2).Subscribe(func(m *ParsedMessage) {
+		zone2 = append(zone2, m.Name+" "+m.Value)
+	})
+
+	device.handleReceived("ZVL14")
+	device.handleReceived("MVL28")
+	device.handleReceived("PW301")
+	device.handleReceived("DIM01")
+
+	assertEqual(t, main, []string{"volume 20", "dimmer dim"})
+	assertEqual(t, zone2, []string{"volume 20", "dimmer dim"})
+
+	value, ok := device.Zone(2).Value("volume")
+	assertEqual(t, ok, true)
+	assertEqual(t, value.Value, "20")
+}
+
+func TestSplitZone(t *testing.T) {
+	name, zone := splitZone("volume-zone2")
+	assertEqual(t, name, "volume")
+	assertEqual(t, zone, 2)
+	name, zone = splitZone("volume")
+	assertEqual(t, name, "volume")
+	assertEqual(t, zone, 0)
+	_, zone = splitZone("volume-zone2x")
+	assertEqual(t, zone, 0)
+}